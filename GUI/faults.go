@@ -0,0 +1,55 @@
+package gui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Настройка ошибок, которые эмуляторы весов вносят в передаваемые кадры
+func showEmulatorFaultsMenu(device *logic.Device) {
+	for {
+		showHeader(device)
+
+		faults := logic.Faults()
+		options := []string{}
+		for _, f := range faults {
+			options = append(options, fmt.Sprintf("%s: %s%%", f.Title(), strconv.FormatFloat(device.Faults.Percent[f], 'f', -1, 64)))
+		}
+		delayTitle := "Время задержки ответа: " + device.Faults.DelayTime().String()
+		options = append(options, delayTitle, "Отключить все ошибки", "Назад")
+
+		var selected int
+		survey.AskOne(&survey.Select{
+			Message:  "Ошибки эмуляторов, вероятность на каждый кадр:",
+			Options:  options,
+			PageSize: len(options),
+		}, &selected)
+
+		switch {
+		case selected < len(faults):
+			f := faults[selected]
+			value := strconv.FormatFloat(device.Faults.Percent[f], 'f', -1, 64)
+			if err := survey.AskOne(&survey.Input{Message: f.Title() + ", % кадров:", Default: value}, &value); err != nil {
+				return
+			}
+			if err := device.Faults.Set(f.String(), value); err != nil {
+				device.LastError = err.Error()
+			}
+		case options[selected] == delayTitle:
+			value := device.Faults.DelayTime().String()
+			if err := survey.AskOne(&survey.Input{Message: "Время задержки ответа (например 2s, 500ms):", Default: value}, &value); err != nil {
+				return
+			}
+			if err := device.Faults.Set("delaytime", value); err != nil {
+				device.LastError = err.Error()
+			}
+		case options[selected] == "Отключить все ошибки":
+			device.Faults = logic.FaultSettings{}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package gui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Генерация штрихкодов для печати: тестовый лист в HTML или один штрихкод в PNG/SVG
+func showGenerateMenu(device *logic.Device) {
+	for {
+		showHeader(device)
+
+		var action string
+		survey.AskOne(&survey.Select{
+			Message: "Генерация штрихкодов:",
+			Options: []string{
+				"Тестовый лист (HTML)",
+				"Один штрихкод (PNG или SVG)",
+				"Назад",
+			},
+		}, &action)
+
+		switch action {
+		case "Тестовый лист (HTML)":
+			generateTestSheet(device)
+		case "Один штрихкод (PNG или SVG)":
+			generateBarcode(device)
+		default:
+			return
+		}
+	}
+}
+
+// Тестовый лист для печати. Для встроенного набора рядом записывается список штрихкодов,
+// по которому затем проверяется сканер
+func generateTestSheet(device *logic.Device) {
+	answers := struct {
+		Sheet string
+		HTML  string
+		List  string
+	}{}
+	if err := survey.Ask([]*survey.Question{
+		{Name: "Sheet", Prompt: &survey.Input{Message: "Файл тестового листа (пусто - встроенный набор):", Default: testSheetPath}},
+		{Name: "HTML", Prompt: &survey.Input{Message: "HTML страница для печати:", Default: "test-sheet.html"}},
+	}, &answers); err != nil {
+		return
+	}
+
+	sheet := logic.DefaultTestSheet()
+	if path := strings.TrimSpace(answers.Sheet); path != "" {
+		var err error
+		if sheet, err = logic.LoadTestSheet(path); err != nil {
+			device.LastError = err.Error()
+			return
+		}
+	} else if err := survey.AskOne(&survey.Input{Message: "Список штрихкодов для проверки:", Default: "test-sheet.txt"}, &answers.List); err != nil {
+		return
+	}
+
+	for _, e := range sheet.Entries {
+		if _, err := e.Encode(); err != nil {
+			device.LastError = err.Error()
+			return
+		}
+	}
+	if !writeGenerated(device, answers.HTML, func(f *os.File) error { return logic.WriteTestSheetHTML(f, sheet) }) {
+		return
+	}
+	if answers.List != "" {
+		if !writeGenerated(device, answers.List, func(f *os.File) error { return sheet.Write(f) }) {
+			return
+		}
+		testSheetPath = answers.List
+	}
+	survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
+}
+
+// Один штрихкод. Для GS1 DataMatrix по умолчанию предлагается синтетический код маркировки
+func generateBarcode(device *logic.Device) {
+	var symbology string
+	if err := survey.AskOne(&survey.Select{
+		Message:  "Тип штрихкода:",
+		Options:  logic.GenerateSymbologies,
+		PageSize: len(logic.GenerateSymbologies),
+	}, &symbology); err != nil {
+		return
+	}
+
+	data := ""
+	if symbology == "GS1 DataMatrix" {
+		data = logic.MarkingCode()
+	}
+	if err := survey.AskOne(&survey.Input{
+		Message: "Код:",
+		Default: data,
+		Help:    "Разделитель GS - <GS>, код GS1 можно в виде (01)04601234567893(21)ABC",
+	}, &data); err != nil {
+		return
+	}
+	path := "barcode.png"
+	if err := survey.AskOne(&survey.Input{Message: "Файл (.png или .svg):", Default: path}, &path); err != nil {
+		return
+	}
+
+	e, err := logic.NewSheetEntry(data, symbology)
+	if err != nil {
+		device.LastError = err.Error()
+		return
+	}
+	code, err := logic.EncodeBarcode(e.Symbology, e.Data)
+	if err != nil {
+		device.LastError = err.Error()
+		return
+	}
+	if err := logic.WriteBarcodeFile(path, code, 4); err != nil {
+		device.LastError = err.Error()
+		return
+	}
+	fmt.Println("Записан", path)
+	survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
+}
+
+// Записывает файл, ошибка - в LastError
+func writeGenerated(device *logic.Device, path string, write func(f *os.File) error) bool {
+	f, err := os.Create(path)
+	if err == nil {
+		err = write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		device.LastError = err.Error()
+		return false
+	}
+	fmt.Println("Записан", path)
+	return true
+}
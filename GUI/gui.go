@@ -5,15 +5,14 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/Impuls2003/SAKDeviceToolbox/logic"
-	"golang.org/x/sys/windows"
 )
 
-var user32_dll = windows.NewLazyDLL("user32.dll")
-var GetKeyState = user32_dll.NewProc("GetKeyState")
-
 func Show(device *logic.Device) {
 	// Бесконечный цикл. Выход только из меню, или закрыв приложение
 	for {
@@ -31,8 +30,10 @@ func Show(device *logic.Device) {
 			Options: []string{
 				"Сканер",
 				"Весы",
+				"Весы-сканер",
 				"Echo тест",
 				"Сменить COM порт",
+				"Параметры порта",
 				"Выход",
 			},
 		}
@@ -44,10 +45,14 @@ func Show(device *logic.Device) {
 		switch deviceType {
 		case "Сменить COM порт":
 			showSelectCOMPortMenu(device)
+		case "Параметры порта":
+			showSerialSettingsMenu(device)
 		case "Сканер":
 			showScannerMenu(device)
 		case "Весы":
 			showWeightMenu(device)
+		case "Весы-сканер":
+			showScannerScaleMenu(device)
 		case "Echo тест":
 			showEchoTestMenu(device)
 		case "Выход":
@@ -80,8 +85,14 @@ func showSelectCOMPortMenu(device *logic.Device) {
 	survey.AskOne(prompt, &selected)
 
 	if selected == "Ввести вручную..." {
-		survey.AskOne(&survey.Input{Message: "Введите порт вручную:"}, &selected)
-		selected = "COM" + selected
+		survey.AskOne(&survey.Input{
+			Message: "Введите порт вручную:",
+			Help:    "Номер COM порта (3), имя порта (/dev/ttyUSB0) или адрес: serial:///dev/ttyUSB0?baud=9600, tcp://10.0.0.5:4001, pty://, file://capture.bin",
+		}, &selected)
+		// Только число - это номер COM порта, остальное передаем как есть
+		if _, err := strconv.Atoi(selected); err == nil {
+			selected = "COM" + selected
+		}
 	}
 
 	device.Port = selected
@@ -89,32 +100,74 @@ func showSelectCOMPortMenu(device *logic.Device) {
 
 // Отображает меню работы со сканером
 func showScannerMenu(device *logic.Device) {
-	device.Type = logic.Scanner
+	for {
+		device.Type = logic.Scanner
+		showHeader(device)
+
+		var action string
+		survey.AskOne(&survey.Select{
+			Message: "Сканер:",
+			Options: []string{
+				"Чтение и проверка штрихкодов",
+				"Диагностика настроек сканера",
+				"Замер скорости сканирования",
+				"Проверка по тестовому листу",
+				"Генерация штрихкодов для печати",
+				"Назад",
+			},
+		}, &action)
+
+		switch action {
+		case "Чтение и проверка штрихкодов":
+			showScannerReading(device)
+		case "Диагностика настроек сканера":
+			showScannerDiagnostics(device)
+		case "Замер скорости сканирования":
+			showScannerBenchmark(device)
+		case "Проверка по тестовому листу":
+			showScannerTestSheet(device)
+		case "Генерация штрихкодов для печати":
+			showGenerateMenu(device)
+		default:
+			return
+		}
+	}
+}
+
+// Чтение штрихкодов до нажатия ESC
+func showScannerReading(device *logic.Device) {
 	showHeader(device)
-	fmt.Println("Начато получение данных от сканера. ESC для выхода.")
+	fmt.Println("Начато получение данных от сканера.")
 	if device.Connect() == nil {
+		showEndpoint(device)
 		// Если подключение прошло успешно.
-		// Заходим в бесконечный цикл. Выход из цикла по ESC
-		for {
-			str, err := device.Process()
-			// Если была ошибка - выходим из цикла
-			if err != nil {
-				break
-			}
+		// Читаем данные до нажатия ESC
+		runReadLoop(device, func(str string) {
+			fmt.Println(str)
+		})
 
-			// Если есть что выводить - выводим
-			if str != "" {
-				fmt.Println(str)
-			}
+		device.Disconnect()
+	}
+}
 
-			// Если нажата ESC - выходим из цикла
-			if ESCIsPressed() { // Проверяем состояние ESC. Если нажата - выходим
-				break
-			}
-		}
+// Диагностика: байты каждого сканирования как есть, после выхода - итог по настройкам сканера
+func showScannerDiagnostics(device *logic.Device) {
+	showHeader(device)
+	fmt.Println("Отсканируйте несколько разных штрихкодов.")
+	device.ScanDiag = &logic.ScanDiagnostics{}
+	defer func() { device.ScanDiag = nil }()
 
-		device.Disconnect()
+	if device.Connect() != nil {
+		return
 	}
+	showEndpoint(device)
+	runReadLoop(device, func(str string) {
+		fmt.Println(str)
+	})
+	device.Disconnect()
+
+	fmt.Println(device.ScanDiag.Config())
+	survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
 }
 
 // Отображает меню работы с весами
@@ -126,94 +179,178 @@ func showWeightMenu(device *logic.Device) {
 
 		var weightType string
 
+		options := []string{
+			"CAS",
+			"CAS по запросу (запрос веса: ASCII - D, HEX - 44, DEC - 68)",
+			"Keli",
+			"Massa-K",
+			"Mettler Toledo MT-SICS",
+			"Штрих-М",
+			"Toledo 8142 (непрерывно)",
+			"Toledo 8217 (по запросу W)",
+			"A&D",
+			"Ohaus",
+			"Sartorius SBI",
+			"Modbus RTU",
+		}
+		profileTitle := "Сценарий веса эмуляторов: " + device.Profile.String()
+		faultsTitle := "Ошибки эмуляторов: " + device.Faults.String()
+
+		// Протоколы, описанные в файле настроек
+		custom := map[string]*logic.CustomProtocol{}
+		for _, p := range device.Protocols {
+			option := fmt.Sprintf("%s (%s)", p.Name, p)
+			custom[option] = p
+			options = append(options, option)
+		}
+		options = append(options,
+			"Эмуляция весов CAS непрерывно",
+			"Эмуляция весов CAS по запросу (HEX - 44)",
+			"Эмуляция весов Mettler Toledo MT-SICS",
+			"Эмуляция весов Toledo 8142",
+			"Эмуляция весов Toledo 8217",
+			"Эмуляция весов Keli (по запросу 02 41 03)",
+			"Эмуляция весов Massa-K (протокол 100)",
+			profileTitle,
+			faultsTitle,
+			"Назад",
+		)
+
 		prompt := &survey.Select{
 			Message: "Выберите тип весов:",
-			Options: []string{
-				"CAS",
-				"CAS по запросу (запрос веса: ASCII - D, HEX - 44, DEC - 68)",
-				"Keli",
-				"Massa-K",
-				"Эмуляция весов CAS непрерывно",
-				"Эмуляция весов CAS по запросу (HEX - 44)",
-				"Назад",
-			},
+			Options: options,
 		}
 		// Выводим главное меню
 		survey.AskOne(prompt, &weightType)
 
+		if weightType == profileTitle {
+			showWeightProfileMenu(device)
+			continue
+		}
+		if weightType == faultsTitle {
+			showEmulatorFaultsMenu(device)
+			continue
+		}
+		if p, ok := custom[weightType]; ok {
+			device.Type = logic.ScalesCustom
+			device.Custom = p
+			showWeightReading(device)
+			continue
+		}
+
 		switch weightType {
 		case "CAS":
 			device.Type = logic.ScalesCAS
 		case "CAS по запросу (запрос веса: ASCII - D, HEX - 44, DEC - 68)":
 			device.Type = logic.ScalesCASRequest
 		case "Keli":
-			device.Type = logic.ScalesKeliRequest
+			showKeliMenu(device)
+			continue
 		case "Massa-K":
 			device.Type = logic.ScalesMassaKRequest
+			showMassaKMenu(device)
+			continue
+		case "Mettler Toledo MT-SICS":
+			showMTSICSMenu(device)
+			continue
+		case "Штрих-М":
+			device.Type = logic.ScalesShtrih
+		case "Toledo 8142 (непрерывно)":
+			device.Type = logic.ScalesToledo8142
+		case "Toledo 8217 (по запросу W)":
+			device.Type = logic.ScalesToledo8217
+		case "A&D":
+			showReadModeMenu(device, "A&D", logic.ScalesAND, "Q", logic.ScalesANDContinuous)
+			continue
+		case "Ohaus":
+			showReadModeMenu(device, "Ohaus", logic.ScalesOhaus, "IP", logic.ScalesOhausContinuous)
+			continue
+		case "Sartorius SBI":
+			showReadModeMenu(device, "Sartorius SBI", logic.ScalesSartorius, "ESC P", logic.ScalesSartoriusContinuous)
+			continue
+		case "Modbus RTU":
+			showModbusMenu(device)
+			continue
 		case "Эмуляция весов CAS непрерывно":
 			device.Type = logic.EmulatorCAS
 		case "Эмуляция весов CAS по запросу (HEX - 44)":
 			device.Type = logic.EmulatorCASRequest
+		case "Эмуляция весов Mettler Toledo MT-SICS":
+			device.Type = logic.EmulatorMTSICS
+		case "Эмуляция весов Toledo 8142":
+			device.Type = logic.EmulatorToledo8142
+		case "Эмуляция весов Toledo 8217":
+			device.Type = logic.EmulatorToledo8217
+		case "Эмуляция весов Keli (по запросу 02 41 03)":
+			device.Type = logic.EmulatorKeli
+		case "Эмуляция весов Massa-K (протокол 100)":
+			device.Type = logic.EmulatorMassaK
 		case "Назад":
 			return
 		}
 
-		showHeader(device)
-		fmt.Println("Начато получение данных от весов. ESC для выхода.")
-		if device.Connect() == nil {
-			// Если подключение прошло успешно.
-			// Заходим в бесконечный цикл. Выход из цикла по ESC
-			for {
-				str, err := device.Process()
-				// Если была ошибка - выходим из цикла
-				if err != nil {
-					break
-				}
+		showWeightReading(device)
+	}
+}
 
-				// Если есть что выводить - выводим
-				// Форматируем строку чтобы не было перехода на новую строку
-				if str != "" {
-					fmt.Printf("\rВес: %-100s", str)
-				}
+// Чтение веса до нажатия ESC
+func showWeightReading(device *logic.Device) {
+	showHeader(device)
+	fmt.Println("Начато получение данных от весов.")
+	if device.Connect() == nil {
+		showEndpoint(device)
+		// Если подключение прошло успешно.
+		// Читаем данные до нажатия ESC
+		// Форматируем строку чтобы не было перехода на новую строку
+		runReadLoop(device, func(str string) {
+			fmt.Printf("\rВес: %-50s кадров: %d, ошибок: %d   ", str, device.Stats.Frames, device.Stats.Errors())
+		})
 
-				// Если нажата ESC - выходим из цикла
-				if ESCIsPressed() { // Проверяем состояние ESC. Если нажата - выходим
-					break
-				}
-			}
+		device.Disconnect()
 
-			device.Disconnect()
+		// Итог по ошибкам, которые внес эмулятор
+		if device.Type.IsEmulator() && device.Faults.Enabled() {
+			fmt.Println()
+			fmt.Println("Ошибки эмулятора:", device.FaultStats)
+			survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
 		}
 	}
 }
 
+// Подключается, выполняет одну команду и показывает результат до нажатия Enter
+func runDeviceCommand(device *logic.Device, command func() (string, error)) {
+	showHeader(device)
+	if device.Connect() != nil {
+		return
+	}
+	showEndpoint(device)
+
+	result, err := command()
+	device.Disconnect()
+	if err != nil {
+		return
+	}
+
+	fmt.Println(result)
+	survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
+}
+
 // Отображает меню работы со сканером
 func showEchoTestMenu(device *logic.Device) {
 	device.Type = logic.EchoTest
 	showHeader(device)
-	fmt.Println("Начато Echo тестирование порта. ESC для выхода.")
+	fmt.Println("Начато Echo тестирование порта.")
 	if device.Connect() == nil {
+		showEndpoint(device)
 		// Если подключение прошло успешно.
-		// Заходим в бесконечный цикл. Выход из цикла по ESC
-		for {
-			str, err := device.Process()
-			// Если была ошибка - выходим из цикла
-			if err != nil {
-				break
-			}
-
-			// Если есть что выводить - выводим
-			if str != "" {
-				fmt.Println(str)
-			}
-
-			// Если нажата ESC - выходим из цикла
-			if ESCIsPressed() { // Проверяем состояние ESC. Если нажата - выходим
-				break
-			}
-		}
+		// Читаем данные до нажатия ESC
+		runReadLoop(device, func(str string) {
+			fmt.Println(str)
+		})
 
 		device.Disconnect()
+		fmt.Println(device.Echo)
+		survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
 	}
 }
 
@@ -235,8 +372,12 @@ func clearScreen() {
 func showHeader(device *logic.Device) {
 
 	clearScreen()
-	// Зеленым текущий порт
-	fmt.Printf("Текущий порт: \033[32m%s\033[0m\n", device.Port)
+	// Зеленым текущий порт, рядом параметры для текущего типа устройства
+	if logic.IsSerialPort(device.Port) {
+		fmt.Printf("Текущий порт: \033[32m%s\033[0m (%s)\n", device.Port, device.PortSettings())
+	} else {
+		fmt.Printf("Текущий порт: \033[32m%s\033[0m\n", device.Port)
+	}
 
 	// Если в процессе были ошибки - вывести их на экран красным
 	if device.LastError != "" {
@@ -245,8 +386,118 @@ func showHeader(device *logic.Device) {
 	}
 }
 
-// У функции единственное предназначение. Она проверяет состояние ESC. Если кнопка нажата вернуть true
-func ESCIsPressed() bool {
-	r1, _, _ := GetKeyState.Call(27) // Читаем состояние кнопки ESC.
-	return (r1 > 1)
+// Если подключение отличается от выбранного порта (например pty) - сообщаем куда подключаться
+func showEndpoint(device *logic.Device) {
+	if endpoint := device.Endpoint(); endpoint != device.Port {
+		if logic.IsSerialPort(device.Port) {
+			endpoint += " (" + device.PortSettings().String() + ")"
+		}
+		fmt.Printf("Подключено: \033[32m%s\033[0m\n", endpoint)
+	}
+}
+
+// Подсказка по горячим клавишам в режиме чтения
+const readLoopHotkeys = "ESC - выход, Пробел - пауза, C - очистить экран"
+
+// Цикл чтения данных с устройства до нажатия ESC или ошибки.
+// Process крутится в отдельной горутине, клавиатура читается в фоне,
+// поэтому реакция на клавиши не ждет таймаута чтения порта.
+func runReadLoop(device *logic.Device, print func(str string)) {
+	fmt.Println(readLoopHotkeys)
+
+	keyboard := startKeyboard()
+	defer keyboard.Stop()
+
+	var output sync.Mutex // вывод идет из двух горутин
+	paused := false
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			str, err := device.Process()
+			// Если была ошибка - выходим из цикла
+			if err != nil {
+				return
+			}
+
+			// Если есть что выводить и вывод не на паузе - выводим
+			output.Lock()
+			if str != "" && !paused {
+				print(str)
+			}
+			output.Unlock()
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case key := <-keyboard.C:
+			switch key {
+			case KeyEsc:
+				close(stop)
+				<-done
+				fmt.Println()
+				return
+			case KeySpace:
+				output.Lock()
+				paused = !paused
+				if paused {
+					fmt.Println("\nПауза. Пробел - продолжить.")
+				}
+				output.Unlock()
+			case 'c':
+				output.Lock()
+				clearScreen()
+				fmt.Printf("Текущий порт: \033[32m%s\033[0m\n", device.Endpoint())
+				fmt.Println(readLoopHotkeys)
+				output.Unlock()
+			}
+		}
+	}
+}
+
+// Замер скорости сканирования: время и паузы каждого сканирования, после выхода - итог сессии
+func showScannerBenchmark(device *logic.Device) {
+	showHeader(device)
+
+	window := logic.ScanDuplicateWindowDefault.String()
+	if err := survey.AskOne(&survey.Input{
+		Message: "Повтор того же штрихкода за это время считать дублем:",
+		Default: window,
+		Help:    "Например 500ms, 1s, 3s",
+	}, &window); err != nil {
+		return
+	}
+	duplicateWindow, err := time.ParseDuration(window)
+	if err != nil || duplicateWindow <= 0 {
+		device.LastError = fmt.Sprintf("неверное время %q", window)
+		return
+	}
+
+	device.ScanBench = &logic.ScanBenchmark{DuplicateWindow: duplicateWindow}
+	defer func() { device.ScanBench = nil }()
+
+	fmt.Println("Сканируйте штрихкоды.")
+	if device.Connect() != nil {
+		return
+	}
+	showEndpoint(device)
+	runReadLoop(device, func(str string) {
+		fmt.Println(str)
+	})
+	device.Disconnect()
+
+	fmt.Println(device.ScanBench)
+	survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
 }
@@ -0,0 +1,44 @@
+package gui
+
+import (
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Отображает меню весов Keli: чтение веса по запросу и непрерывно, тара и ноль
+func showKeliMenu(device *logic.Device) {
+	for {
+		device.Type = logic.ScalesKeliRequest
+		showHeader(device)
+
+		var action string
+		survey.AskOne(&survey.Select{
+			Message: "Keli:",
+			Options: []string{
+				"Чтение веса по запросу (HEX 02 41 03)",
+				"Чтение веса, непрерывная передача",
+				"Тара",
+				"Установить ноль",
+				"Назад",
+			},
+		}, &action)
+
+		switch action {
+		case "Чтение веса по запросу (HEX 02 41 03)":
+			showWeightReading(device)
+		case "Чтение веса, непрерывная передача":
+			device.Type = logic.ScalesKeli
+			showWeightReading(device)
+		case "Тара":
+			runDeviceCommand(device, func() (string, error) {
+				return "Тара установлена", device.KeliTare()
+			})
+		case "Установить ноль":
+			runDeviceCommand(device, func() (string, error) {
+				return "Ноль установлен", device.KeliZero()
+			})
+		default:
+			return
+		}
+	}
+}
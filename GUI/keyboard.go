@@ -0,0 +1,124 @@
+package gui
+
+import (
+	"os"
+	"os/signal"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Нажатая клавиша. Буквы приводятся к нижнему регистру латинской раскладки
+type Key rune
+
+const (
+	KeyEsc   Key = 27
+	KeySpace Key = ' '
+	KeyEnter Key = '\r'
+)
+
+// Платформенный источник нажатий: консольный API в Windows, терминал в cbreak режиме в Unix
+type keyReader interface {
+	// Ждет нажатий не дольше timeout. Пустой результат - ничего не нажато
+	ReadKeys(timeout time.Duration) ([]Key, error)
+	// Возвращает консоль в исходное состояние
+	Close()
+}
+
+// Фоновое чтение клавиатуры. Нажатия приходят в канал C
+type Keyboard struct {
+	C    chan Key
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Запускает фоновое чтение клавиатуры.
+// Если stdin не консоль (например вывод перенаправлен) - канал просто молчит.
+func startKeyboard() *Keyboard {
+	kb := &Keyboard{
+		C:    make(chan Key, 16),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	reader, err := openKeyReader()
+	if err != nil {
+		close(kb.done)
+		return kb
+	}
+
+	// Ctrl+C не должен оставлять консоль в режиме без эха
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go func() {
+		defer close(kb.done)
+		defer signal.Stop(interrupt)
+		defer reader.Close()
+
+		for {
+			select {
+			case <-kb.stop:
+				return
+			case <-interrupt:
+				reader.Close()
+				os.Exit(130)
+			default:
+			}
+
+			keys, err := reader.ReadKeys(100 * time.Millisecond)
+			if err != nil {
+				return
+			}
+			for _, k := range keys {
+				// Если никто не успевает читать - лишние нажатия отбрасываем
+				select {
+				case kb.C <- k:
+				default:
+				}
+			}
+		}
+	}()
+
+	return kb
+}
+
+// Останавливает чтение и возвращает консоль в исходное состояние
+func (kb *Keyboard) Stop() {
+	select {
+	case <-kb.stop:
+	default:
+		close(kb.stop)
+	}
+	<-kb.done
+}
+
+// Приводит символ к клавише: нижний регистр, кириллица в латиницу по положению на клавиатуре
+func runeToKey(r rune) Key {
+	r = logic.LatinKey(unicode.ToLower(r))
+	if r == '\n' {
+		r = '\r'
+	}
+	return Key(r)
+}
+
+// Разбирает байты из терминала. Одиночный ESC - это клавиша ESC,
+// ESC с продолжением - управляющая последовательность (стрелки, F1...), ее пропускаем.
+func decodeKeys(buf []byte) []Key {
+	var keys []Key
+	for len(buf) > 0 {
+		if buf[0] == 27 {
+			if len(buf) == 1 {
+				keys = append(keys, KeyEsc)
+			}
+			// Пропускаем последовательность целиком: все остальное в этом чтении - ее часть
+			break
+		}
+		r, size := utf8.DecodeRune(buf)
+		keys = append(keys, runeToKey(r))
+		buf = buf[size:]
+	}
+	return keys
+}
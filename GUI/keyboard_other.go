@@ -0,0 +1,9 @@
+//go:build !windows && !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package gui
+
+import "errors"
+
+func openKeyReader() (keyReader, error) {
+	return nil, errors.New("чтение клавиатуры не поддерживается на этой платформе")
+}
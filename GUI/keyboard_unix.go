@@ -0,0 +1,65 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package gui
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// Чтение клавиатуры из терминала в cbreak режиме: без буферизации строк и без эха.
+// Обработку вывода (OPOST) не трогаем, чтобы \n по-прежнему переводил строку.
+type terminalKeyReader struct {
+	fd  int
+	old *unix.Termios
+}
+
+func openKeyReader() (keyReader, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, unix.ENOTTY
+	}
+
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Lflag &^= unix.ICANON | unix.ECHO
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+
+	return &terminalKeyReader{fd: fd, old: old}, nil
+}
+
+func (r *terminalKeyReader) ReadKeys(timeout time.Duration) ([]Key, error) {
+	fds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+	if err == unix.EINTR {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, 32)
+	n, err = unix.Read(r.fd, buf)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKeys(buf[:n]), nil
+}
+
+func (r *terminalKeyReader) Close() {
+	unix.IoctlSetTermios(r.fd, ioctlSetTermios, r.old)
+}
@@ -0,0 +1,99 @@
+package gui
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var kernel32_dll = windows.NewLazyDLL("kernel32.dll")
+var readConsoleInput = kernel32_dll.NewProc("ReadConsoleInputW")
+var flushConsoleInputBuffer = kernel32_dll.NewProc("FlushConsoleInputBuffer")
+
+const (
+	keyEventType = 0x0001 // KEY_EVENT
+	vkEscape     = 0x1B   // VK_ESCAPE
+	vkSpace      = 0x20   // VK_SPACE
+	vkReturn     = 0x0D   // VK_RETURN
+)
+
+// KEY_EVENT_RECORD
+type keyEventRecord struct {
+	KeyDown         int32
+	RepeatCount     uint16
+	VirtualKeyCode  uint16
+	VirtualScanCode uint16
+	UnicodeChar     uint16
+	ControlKeyState uint32
+}
+
+// INPUT_RECORD. Нас интересуют только события клавиатуры
+type inputRecord struct {
+	EventType uint16
+	_         uint16
+	Event     keyEventRecord
+}
+
+// Чтение клавиатуры через консольный API
+type consoleKeyReader struct {
+	handle windows.Handle
+}
+
+func openKeyReader() (keyReader, error) {
+	handle, err := windows.GetStdHandle(windows.STD_INPUT_HANDLE)
+	if err != nil {
+		return nil, err
+	}
+	var mode uint32
+	// Не консоль - читать нечего
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return nil, err
+	}
+	return &consoleKeyReader{handle: handle}, nil
+}
+
+func (r *consoleKeyReader) ReadKeys(timeout time.Duration) ([]Key, error) {
+	event, err := windows.WaitForSingleObject(r.handle, uint32(timeout/time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	if event != windows.WAIT_OBJECT_0 {
+		return nil, nil
+	}
+
+	var records [16]inputRecord
+	var count uint32
+	ok, _, err := readConsoleInput.Call(
+		uintptr(r.handle),
+		uintptr(unsafe.Pointer(&records[0])),
+		uintptr(len(records)),
+		uintptr(unsafe.Pointer(&count)),
+	)
+	if ok == 0 {
+		return nil, err
+	}
+
+	var keys []Key
+	for _, rec := range records[:count] {
+		if rec.EventType != keyEventType || rec.Event.KeyDown == 0 {
+			continue
+		}
+		switch {
+		case rec.Event.VirtualKeyCode == vkEscape:
+			keys = append(keys, KeyEsc)
+		case rec.Event.VirtualKeyCode == vkSpace:
+			keys = append(keys, KeySpace)
+		case rec.Event.VirtualKeyCode == vkReturn:
+			keys = append(keys, KeyEnter)
+		case rec.Event.UnicodeChar != 0:
+			keys = append(keys, runeToKey(rune(rec.Event.UnicodeChar)))
+		}
+	}
+	return keys, nil
+}
+
+// Сбрасываем непрочитанные нажатия, чтобы они не попали в следующее меню
+func (r *consoleKeyReader) Close() {
+	flushConsoleInputBuffer.Call(uintptr(r.handle))
+}
@@ -0,0 +1,66 @@
+package gui
+
+import (
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Отображает меню весов Massa-K: чтение веса и служебные команды протокола 100
+func showMassaKMenu(device *logic.Device) {
+	for {
+		showHeader(device)
+
+		var action string
+		survey.AskOne(&survey.Select{
+			Message: "Massa-K:",
+			Options: []string{
+				"Чтение веса",
+				"Установить ноль",
+				"Тара = текущий вес",
+				"Сбросить тару",
+				"Параметры весов",
+				"Имя и серийный номер",
+				"Назад",
+			},
+		}, &action)
+
+		switch action {
+		case "Чтение веса":
+			showWeightReading(device)
+		case "Установить ноль":
+			runDeviceCommand(device, func() (string, error) {
+				return "Ноль установлен", device.MassaKSetZero()
+			})
+		case "Тара = текущий вес":
+			runDeviceCommand(device, func() (string, error) {
+				return "Тара установлена", device.MassaKSetTareCurrent()
+			})
+		case "Сбросить тару":
+			runDeviceCommand(device, func() (string, error) {
+				return "Тара сброшена", device.MassaKSetTare(0)
+			})
+		case "Параметры весов":
+			runDeviceCommand(device, func() (string, error) {
+				p, err := device.MassaKScaleParams()
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Макс. нагрузка: %s\nМин. нагрузка: %s\nПоверочный интервал: %s\nМакс. тара: %s\n"+
+					"Фиксация веса: %s\nКод юстировки: %s\nВерсия ПО: %s\nКонтрольная сумма ПО: %s",
+					p.Max, p.Min, p.E, p.Tare, p.Fix, p.Calcode, p.Firmware, p.Checksum), nil
+			})
+		case "Имя и серийный номер":
+			runDeviceCommand(device, func() (string, error) {
+				info, err := device.MassaKInfo()
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Имя: %s\nСерийный номер: %d", info.Name, info.Serial), nil
+			})
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package gui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Отображает меню Modbus RTU: чтение веса по карте регистров, настройка карты и поиск регистра веса
+func showModbusMenu(device *logic.Device) {
+	for {
+		device.Type = logic.ScalesModbus
+		showHeader(device)
+
+		settingsTitle := "Карта регистров: " + device.ModbusSettings().String()
+		var action string
+		survey.AskOne(&survey.Select{
+			Message: "Modbus RTU:",
+			Options: []string{
+				"Чтение веса",
+				settingsTitle,
+				"Сканирование регистров",
+				"Поиск регистра веса",
+				"Назад",
+			},
+		}, &action)
+
+		switch action {
+		case "Чтение веса":
+			showWeightReading(device)
+		case settingsTitle:
+			showModbusSettingsMenu(device)
+		case "Сканирование регистров":
+			from, to, ok := askModbusRange()
+			if !ok {
+				continue
+			}
+			runDeviceCommand(device, func() (string, error) {
+				regs, err := scanModbus(device, from, to)
+				if err != nil {
+					return "", err
+				}
+				var res strings.Builder
+				fmt.Fprintf(&res, "Прочитано регистров: %d\n", len(regs))
+				fmt.Fprintf(&res, "%-8s %-8s %-8s %s\n", "Адрес", "HEX", "uint16", "int16")
+				for _, r := range regs {
+					fmt.Fprintf(&res, "%-8d %04X     %-8d %d\n", r.Address, r.Value, r.Value, int16(r.Value))
+				}
+				return res.String(), nil
+			})
+		case "Поиск регистра веса":
+			showModbusFindMenu(device)
+		default:
+			return
+		}
+	}
+}
+
+// Сканирует регистры, показывая адрес текущего запроса
+func scanModbus(device *logic.Device, from, to uint16) ([]logic.ModbusRegister, error) {
+	regs, err := device.ModbusScan(from, to, func(address uint16) {
+		fmt.Printf("\rЧтение регистра %d из %d...", address, to)
+	})
+	fmt.Println()
+	return regs, err
+}
+
+// Запрашивает диапазон адресов для сканирования
+func askModbusRange() (uint16, uint16, bool) {
+	var from, to string
+	survey.AskOne(&survey.Input{Message: "Начальный адрес:", Default: "0"}, &from)
+	survey.AskOne(&survey.Input{Message: "Конечный адрес:", Default: "99"}, &to)
+
+	f, err1 := strconv.ParseUint(strings.TrimSpace(from), 0, 16)
+	t, err2 := strconv.ParseUint(strings.TrimSpace(to), 0, 16)
+	if err1 != nil || err2 != nil || t < f {
+		return 0, 0, false
+	}
+	return uint16(f), uint16(t), true
+}
+
+// Поиск регистра веса: на весы кладется груз известного веса, регистры сканируются
+// и проверяются во всех форматах. Найденную карту можно сразу применить.
+func showModbusFindMenu(device *logic.Device) {
+	var text string
+	survey.AskOne(&survey.Input{Message: "Положите на весы груз и введите вес, который показывает индикатор:"}, &text)
+	weight, err := logic.ParseDecimal(text)
+	if err != nil || weight.IsZero() {
+		device.LastError = "Нужен ненулевой вес, например 1.250"
+		return
+	}
+	from, to, ok := askModbusRange()
+	if !ok {
+		return
+	}
+
+	var found []logic.ModbusSettings
+	runDeviceCommand(device, func() (string, error) {
+		regs, err := scanModbus(device, from, to)
+		if err != nil {
+			return "", err
+		}
+		found = logic.FindModbusWeight(regs, weight, device.ModbusSettings())
+		if len(found) == 0 {
+			return fmt.Sprintf("Вес %s не найден в %d прочитанных регистрах", weight, len(regs)), nil
+		}
+		return fmt.Sprintf("Найдено вариантов: %d", len(found)), nil
+	})
+	if len(found) == 0 {
+		return
+	}
+
+	options := []string{}
+	for _, s := range found {
+		options = append(options, s.String())
+	}
+	options = append(options, "Не применять")
+
+	var selected int
+	survey.AskOne(&survey.Select{Message: "Применить карту регистров:", Options: options}, &selected)
+	if selected < len(found) {
+		device.SetModbusSettings(found[selected])
+	}
+}
+
+// Редактирование карты регистров Modbus
+func showModbusSettingsMenu(device *logic.Device) {
+	for {
+		showHeader(device)
+		settings := device.ModbusSettings()
+
+		options := []string{
+			fmt.Sprintf("Адрес устройства: %d", settings.Slave),
+			fmt.Sprintf("Функция: %02d", settings.Function),
+			fmt.Sprintf("Адрес регистра: %d", settings.Address),
+			fmt.Sprintf("Формат: %s", settings.Format),
+			fmt.Sprintf("Порядок слов: %s", settings.WordOrder()),
+			fmt.Sprintf("Знаков после запятой: %d", settings.Decimals),
+			fmt.Sprintf("Единица измерения: %s", settings.Unit),
+			"Сохранить в файл настроек",
+			"Назад",
+		}
+
+		var selected int
+		survey.AskOne(&survey.Select{
+			Message:  "Карта регистров Modbus:",
+			Options:  options,
+			PageSize: len(options),
+		}, &selected)
+
+		var name, value string
+		switch selected {
+		case 0:
+			name = "slave"
+			value = askChoice("Адрес устройства:", []string{"1", "2", "3"}, true)
+		case 1:
+			name = "function"
+			value = askChoice("Функция (3 - holding, 4 - input):", []string{"3", "4"}, false)
+		case 2:
+			name = "address"
+			value = askChoice("Адрес регистра (0x - HEX):", []string{"0", "1", "2"}, true)
+		case 3:
+			name = "format"
+			value = askChoice("Формат:", []string{"int16", "uint16", "int32", "uint32", "float32"}, false)
+		case 4:
+			name = "order"
+			value = askChoice("Порядок слов:", []string{"ABCD", "CDAB"}, false)
+		case 5:
+			name = "decimals"
+			value = askChoice("Знаков после запятой:", []string{"0", "1", "2", "3", "4"}, false)
+		case 6:
+			name = "unit"
+			value = askChoice("Единица измерения:", []string{"kg", "g", "t", "lb"}, true)
+		case 7:
+			if err := logic.ConfigFromDevice(device).Save(logic.DefaultConfigPath); err != nil {
+				device.LastError = err.Error()
+			}
+			continue
+		default:
+			return
+		}
+
+		if err := settings.Set(name, value); err != nil {
+			device.LastError = err.Error()
+			continue
+		}
+		device.SetModbusSettings(settings)
+	}
+}
@@ -0,0 +1,71 @@
+package gui
+
+import (
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Отображает меню весов Mettler Toledo MT-SICS: чтение веса тремя способами и служебные команды
+func showMTSICSMenu(device *logic.Device) {
+	for {
+		device.Type = logic.ScalesMTSICS
+		showHeader(device)
+
+		var action string
+		survey.AskOne(&survey.Select{
+			Message: "Mettler Toledo MT-SICS:",
+			Options: []string{
+				"Чтение веса (SI)",
+				"Чтение стабильного веса (S)",
+				"Чтение веса, непрерывная передача (SIR)",
+				"Установить ноль (Z)",
+				"Тара (T)",
+				"Текущая тара (TA)",
+				"Сбросить тару (TAC)",
+				"Модель и серийный номер (I2, I4)",
+				"Назад",
+			},
+		}, &action)
+
+		switch action {
+		case "Чтение веса (SI)":
+			showWeightReading(device)
+		case "Чтение стабильного веса (S)":
+			device.Type = logic.ScalesMTSICSStable
+			showWeightReading(device)
+		case "Чтение веса, непрерывная передача (SIR)":
+			device.Type = logic.ScalesMTSICSContinuous
+			showWeightReading(device)
+		case "Установить ноль (Z)":
+			runDeviceCommand(device, func() (string, error) {
+				return "Ноль установлен", device.MTSICSZero()
+			})
+		case "Тара (T)":
+			runDeviceCommand(device, func() (string, error) {
+				r, err := device.MTSICSTare()
+				return "Тара установлена: " + r.String(), err
+			})
+		case "Текущая тара (TA)":
+			runDeviceCommand(device, func() (string, error) {
+				r, err := device.MTSICSTareValue()
+				return "Тара: " + r.String(), err
+			})
+		case "Сбросить тару (TAC)":
+			runDeviceCommand(device, func() (string, error) {
+				return "Тара сброшена", device.MTSICSClearTare()
+			})
+		case "Модель и серийный номер (I2, I4)":
+			runDeviceCommand(device, func() (string, error) {
+				info, err := device.MTSICSInfo()
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Модель: %s\nСерийный номер: %s", info.Model, info.Serial), nil
+			})
+		default:
+			return
+		}
+	}
+}
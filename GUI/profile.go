@@ -0,0 +1,77 @@
+package gui
+
+import (
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Сценарии веса эмуляторов в меню и параметры, которые для них спрашиваются
+var weightProfileTitles = []struct {
+	Kind   logic.ProfileKind
+	Title  string
+	Params []string
+}{
+	{logic.ProfileRandom, "Случайный вес", nil},
+	{logic.ProfileConstant, "Постоянный вес", []string{"Вес, кг:"}},
+	{logic.ProfileRamp, "Груз ставят и снимают: нарастание, успокоение, ноль", []string{"Вес, кг:", "Показаний нарастания:"}},
+	{logic.ProfileNoise, "Шум вокруг веса", []string{"Вес, кг:", "Амплитуда шума, кг:"}},
+	{logic.ProfileNegative, "Отрицательный вес", []string{"Вес, кг:"}},
+	{logic.ProfileTare, "Вес с тарой", []string{"Вес брутто, кг:", "Тара, кг:"}},
+	{logic.ProfileOverload, "Перегрузка", nil},
+	{logic.ProfileZero, "Ноль", nil},
+	{logic.ProfileCSV, "Последовательность из CSV файла", []string{"Файл:"}},
+}
+
+// Выбор сценария веса для эмуляторов весов
+func showWeightProfileMenu(device *logic.Device) {
+	showHeader(device)
+
+	options := []string{}
+	for _, t := range weightProfileTitles {
+		options = append(options, t.Title)
+	}
+	options = append(options, "Назад")
+
+	var selected int
+	survey.AskOne(&survey.Select{
+		Message:  "Сценарий веса эмуляторов, сейчас " + device.Profile.String() + ":",
+		Options:  options,
+		PageSize: len(options),
+	}, &selected)
+	if selected >= len(weightProfileTitles) {
+		return
+	}
+
+	// Параметры по умолчанию - из текущего сценария того же вида
+	t := weightProfileTitles[selected]
+	defaults := []string{}
+	switch {
+	case device.Profile.Kind != t.Kind:
+	case t.Kind == logic.ProfileCSV:
+		// В пути Windows есть двоеточие
+		defaults = []string{device.Profile.Path}
+	default:
+		defaults = strings.Split(device.Profile.String(), ":")[1:]
+	}
+
+	parts := []string{t.Kind.String()}
+	for i, message := range t.Params {
+		value := ""
+		if i < len(defaults) {
+			value = defaults[i]
+		}
+		if err := survey.AskOne(&survey.Input{Message: message, Default: value}, &value); err != nil {
+			return
+		}
+		parts = append(parts, strings.TrimSpace(value))
+	}
+
+	profile, err := logic.ParseWeightProfile(strings.Join(parts, ":"))
+	if err != nil {
+		device.LastError = err.Error()
+		return
+	}
+	device.Profile = profile
+}
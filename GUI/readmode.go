@@ -0,0 +1,37 @@
+package gui
+
+import (
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Меню выбора способа чтения веса для весов без служебных команд: по запросу или непрерывно
+func showReadModeMenu(device *logic.Device, name string, request logic.DeviceType, command string, continuous logic.DeviceType) {
+	for {
+		device.Type = request
+		showHeader(device)
+
+		requestTitle := fmt.Sprintf("Чтение веса по запросу (%s)", command)
+		var action string
+		survey.AskOne(&survey.Select{
+			Message: name + ":",
+			Options: []string{
+				requestTitle,
+				"Чтение веса, непрерывная передача",
+				"Назад",
+			},
+		}, &action)
+
+		switch action {
+		case requestTitle:
+			showWeightReading(device)
+		case "Чтение веса, непрерывная передача":
+			device.Type = continuous
+			showWeightReading(device)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package gui
+
+import (
+	"fmt"
+
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Весы-сканер с одним кабелем: штрихкоды выводятся списком, вес - в последней строке под ними
+func showScannerScaleMenu(device *logic.Device) {
+	device.Type = logic.ScannerScale
+	showHeader(device)
+	fmt.Println("Начато получение штрихкодов и веса.")
+	if device.Connect() != nil {
+		return
+	}
+	showEndpoint(device)
+
+	weight := ""
+	runReadLoop(device, func(str string) {
+		if device.LastBarcode != nil {
+			// Штрихкод встает на место строки веса, строка веса выводится заново ниже
+			fmt.Printf("\r\033[KШК: %s\n", str)
+		} else {
+			weight = str
+		}
+		fmt.Printf("\r\033[KВес: %-40s кадров: %d, ошибок: %d", weight, device.Stats.Frames, device.Stats.Errors())
+	})
+
+	device.Disconnect()
+}
@@ -0,0 +1,173 @@
+package gui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Названия типов устройств в меню настроек, в порядке показа
+var deviceTypeTitles = []struct {
+	Type  logic.DeviceType
+	Title string
+}{
+	{logic.Scanner, "Сканер"},
+	{logic.ScalesCAS, "Весы CAS"},
+	{logic.ScalesCASRequest, "Весы CAS по запросу"},
+	{logic.ScalesKeliRequest, "Весы Keli по запросу"},
+	{logic.ScalesKeli, "Весы Keli непрерывно"},
+	{logic.ScalesMassaKRequest, "Весы Massa-K"},
+	{logic.ScalesMTSICS, "Весы MT-SICS"},
+	{logic.ScalesMTSICSStable, "Весы MT-SICS, стабильный вес"},
+	{logic.ScalesMTSICSContinuous, "Весы MT-SICS непрерывно"},
+	{logic.ScalesShtrih, "Весы Штрих-М"},
+	{logic.ScalesToledo8142, "Весы Toledo 8142"},
+	{logic.ScalesToledo8217, "Весы Toledo 8217"},
+	{logic.ScannerScale, "Весы-сканер"},
+	{logic.ScalesAND, "Весы A&D по запросу"},
+	{logic.ScalesANDContinuous, "Весы A&D непрерывно"},
+	{logic.ScalesOhaus, "Весы Ohaus по запросу"},
+	{logic.ScalesOhausContinuous, "Весы Ohaus непрерывно"},
+	{logic.ScalesSartorius, "Весы Sartorius по запросу"},
+	{logic.ScalesSartoriusContinuous, "Весы Sartorius непрерывно"},
+	{logic.ScalesModbus, "Весы Modbus RTU"},
+	{logic.ScalesCustom, "Весы по описанию из файла настроек"},
+	{logic.EmulatorCAS, "Эмуляция весов CAS непрерывно"},
+	{logic.EmulatorCASRequest, "Эмуляция весов CAS по запросу"},
+	{logic.EmulatorMTSICS, "Эмуляция весов MT-SICS"},
+	{logic.EmulatorToledo8142, "Эмуляция весов Toledo 8142"},
+	{logic.EmulatorToledo8217, "Эмуляция весов Toledo 8217"},
+	{logic.EmulatorKeli, "Эмуляция весов Keli"},
+	{logic.EmulatorMassaK, "Эмуляция весов Massa-K"},
+	{logic.EchoTest, "Echo тест"},
+}
+
+// Отображает меню параметров порта. Параметры задаются отдельно для каждого типа устройства
+func showSerialSettingsMenu(device *logic.Device) {
+	for {
+		showHeader(device)
+
+		options := []string{}
+		for _, t := range deviceTypeTitles {
+			options = append(options, fmt.Sprintf("%s: %s", t.Title, serialSettingsFor(device, t.Type)))
+		}
+		options = append(options, "Сохранить в файл настроек", "Назад")
+
+		var selected int
+		survey.AskOne(&survey.Select{
+			Message:  "Параметры порта для:",
+			Options:  options,
+			PageSize: len(options),
+		}, &selected)
+
+		switch {
+		case selected < len(deviceTypeTitles):
+			showSerialSettingsEditMenu(device, deviceTypeTitles[selected].Type, deviceTypeTitles[selected].Title)
+		case options[selected] == "Сохранить в файл настроек":
+			if err := logic.ConfigFromDevice(device).Save(logic.DefaultConfigPath); err != nil {
+				device.LastError = err.Error()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Параметры порта для типа устройства, не меняя текущий тип
+func serialSettingsFor(device *logic.Device, t logic.DeviceType) logic.SerialSettings {
+	current := device.Type
+	device.Type = t
+	defer func() { device.Type = current }()
+	return device.SerialSettings()
+}
+
+// Редактирование параметров порта одного типа устройства
+func showSerialSettingsEditMenu(device *logic.Device, t logic.DeviceType, title string) {
+	current := device.Type
+	device.Type = t
+	defer func() { device.Type = current }()
+
+	for {
+		showHeader(device)
+		settings := device.SerialSettings()
+
+		onOff := map[bool]string{true: "вкл", false: "выкл"}
+		flow := map[logic.FlowControl]string{logic.FlowNone: "нет", logic.FlowRTSCTS: "RTS/CTS"}
+		options := []string{
+			fmt.Sprintf("Скорость: %d", settings.BaudRate),
+			fmt.Sprintf("Биты данных: %d", settings.DataBits),
+			fmt.Sprintf("Четность: %s", settings.ParityCode()),
+			fmt.Sprintf("Стоп-биты: %s", settings.StopBitsCode()),
+			fmt.Sprintf("Управление потоком: %s", flow[settings.FlowControl]),
+			fmt.Sprintf("DTR: %s", onOff[settings.DTR]),
+			fmt.Sprintf("RTS: %s", onOff[settings.RTS]),
+			fmt.Sprintf("Таймаут чтения: %s", settings.ReadTimeout),
+			"Сбросить по умолчанию",
+			"Назад",
+		}
+
+		var selected int
+		survey.AskOne(&survey.Select{
+			Message:  title + ":",
+			Options:  options,
+			PageSize: len(options),
+		}, &selected)
+
+		var name, value string
+		switch selected {
+		case 0:
+			name = "baud"
+			value = askChoice("Скорость:", []string{"1200", "2400", "4800", "9600", "19200", "38400", "57600", "115200"}, true)
+		case 1:
+			name = "databits"
+			value = askChoice("Биты данных:", []string{"8", "7", "6", "5"}, false)
+		case 2:
+			name = "parity"
+			value = askChoice("Четность (N - нет, E - четная, O - нечетная, M - маркер, S - пробел):", []string{"N", "E", "O", "M", "S"}, false)
+		case 3:
+			name = "stopbits"
+			value = askChoice("Стоп-биты:", []string{"1", "1.5", "2"}, false)
+		case 4:
+			name = "flow"
+			value = askChoice("Управление потоком:", []string{"none", "rtscts"}, false)
+		case 5:
+			name = "dtr"
+			value = strconv.FormatBool(!settings.DTR)
+		case 6:
+			name = "rts"
+			value = strconv.FormatBool(!settings.RTS)
+		case 7:
+			name = "timeout"
+			value = askChoice("Таймаут чтения:", []string{"100ms", "250ms", "500ms", "1s", "2s"}, true)
+		case 8:
+			delete(device.Settings, t)
+			continue
+		default:
+			return
+		}
+
+		if err := settings.Set(name, value); err != nil {
+			device.LastError = err.Error()
+			continue
+		}
+		device.SetSerialSettings(settings)
+	}
+}
+
+// Выбор значения из списка, при custom - с возможностью ввести свое
+func askChoice(message string, options []string, custom bool) string {
+	if custom {
+		options = append(options, "Другое...")
+	}
+
+	var value string
+	survey.AskOne(&survey.Select{Message: message, Options: options, PageSize: len(options)}, &value)
+
+	if value == "Другое..." {
+		value = ""
+		survey.AskOne(&survey.Input{Message: message}, &value)
+	}
+	return value
+}
@@ -0,0 +1,52 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Последний загруженный тестовый лист: для следующего сканера путь подставляется сам
+var testSheetPath string
+
+// Проверка сканера по тестовому листу: каждый штрихкод листа отмечается как прочитанный,
+// прочитанный с ошибкой или не прочитанный, после выхода - итог PASS/FAIL
+func showScannerTestSheet(device *logic.Device) {
+	showHeader(device)
+
+	path := testSheetPath
+	if err := survey.AskOne(&survey.Input{
+		Message: "Файл тестового листа:",
+		Default: path,
+		Help:    "По строке на штрихкод: код;тип, например 4601234567893;EAN-13",
+	}, &path); err != nil {
+		return
+	}
+	sheet, err := logic.LoadTestSheet(strings.TrimSpace(path))
+	if err != nil {
+		device.LastError = err.Error()
+		return
+	}
+	testSheetPath = sheet.Path
+
+	device.TestSheet = sheet
+	defer func() { device.TestSheet = nil }()
+
+	fmt.Printf("Отсканируйте все штрихкоды листа (%d шт.).\n", len(sheet.Entries))
+	if device.Connect() != nil {
+		return
+	}
+	showEndpoint(device)
+	runReadLoop(device, func(str string) {
+		fmt.Println(str)
+		if sheet.Done() {
+			fmt.Println("Все штрихкоды листа прочитаны, нажмите ESC для итога.")
+		}
+	})
+	device.Disconnect()
+
+	fmt.Println(sheet)
+	survey.AskOne(&survey.Input{Message: "Нажмите Enter для продолжения"}, new(string))
+}
@@ -1,11 +1,27 @@
 package main
 
 import (
+	"os"
+
 	gui "github.com/Impuls2003/SAKDeviceToolbox/GUI"
+	"github.com/Impuls2003/SAKDeviceToolbox/cli"
 	"github.com/Impuls2003/SAKDeviceToolbox/logic"
 )
 
 func main() {
+	// Если переданы аргументы - работаем без меню, в режиме командной строки
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	device := &logic.Device{}
+
+	// Порт и параметры порта из файла настроек, если он есть
+	if cfg, err := logic.LoadConfig(logic.DefaultConfigPath); err != nil {
+		device.LastError = err.Error()
+	} else {
+		cfg.Apply(device)
+	}
+
 	gui.Show(device)
 }
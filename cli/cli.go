@@ -0,0 +1,454 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Коды завершения для скриптов приемки
+const (
+	ExitOK      = 0 // тест пройден
+	ExitFail    = 1 // тест не пройден
+	ExitUsage   = 2 // неверные аргументы
+	ExitTimeout = 3 // за отведенное время данные не получены
+	ExitError   = 4 // ошибка порта или устройства
+)
+
+// Протоколы весов, доступные из командной строки
+var scaleProtocols = []logic.DeviceType{
+	logic.ScalesCAS,
+	logic.ScalesCASRequest,
+	logic.ScalesKeliRequest,
+	logic.ScalesKeli,
+	logic.ScalesMassaKRequest,
+	logic.ScalesMTSICS,
+	logic.ScalesMTSICSStable,
+	logic.ScalesMTSICSContinuous,
+	logic.ScalesShtrih,
+	logic.ScalesToledo8142,
+	logic.ScalesToledo8217,
+	logic.ScannerScale,
+	logic.ScalesAND,
+	logic.ScalesANDContinuous,
+	logic.ScalesOhaus,
+	logic.ScalesOhausContinuous,
+	logic.ScalesSartorius,
+	logic.ScalesSartoriusContinuous,
+	logic.ScalesModbus,
+	logic.EmulatorCAS,
+	logic.EmulatorCASRequest,
+	logic.EmulatorMTSICS,
+	logic.EmulatorToledo8142,
+	logic.EmulatorToledo8217,
+	logic.EmulatorKeli,
+	logic.EmulatorMassaK,
+}
+
+// Параметры порта из командной строки и соответствующие им имена в SerialSettings.Set
+var serialFlags = []struct {
+	flag, name, usage string
+}{
+	{"baud", "baud", "скорость порта"},
+	{"databits", "databits", "бит данных: 5, 6, 7, 8"},
+	{"parity", "parity", "четность: N, O, E, M, S"},
+	{"stopbits", "stopbits", "стоп-бит: 1, 1.5, 2"},
+	{"flow", "flow", "управление потоком: none, rtscts"},
+	{"dtr", "dtr", "начальное состояние DTR: true, false"},
+	{"rts", "rts", "начальное состояние RTS: true, false"},
+	{"read-timeout", "timeout", "таймаут чтения порта, например 500ms"},
+}
+
+// Подкоманда
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"ports", "список доступных COM портов", runPorts},
+		{"scan", "чтение штрихкодов: scan --port COM3 [--count 1] [--timeout 30s] [--diag] [--bench] [--sheet файл]", runScan},
+		{"scale", "чтение веса: scale --port COM3 --protocol cas [--count 1] [--timeout 10s] [--profile ramp:1.25] [--faults drop=10,corrupt=5]", runScale},
+		{"gen", "генерация штрихкодов: gen --type EAN-13 --data 4601234567893 --out code.png|code.svg [--scale 4]; gen --html sheet.html [--sheet файл] [--list sheet.txt]", runGen},
+		{"echo", "echo тест порта с заглушкой Tx-Rx: echo --port COM3 [--iterations 10]", runEcho},
+		{"modbus-scan", "регистры Modbus: modbus-scan --port COM3 [--from 0] [--to 99] [--weight 1.250] [--modbus slave=1]", runModbusScan},
+		{"help", "эта справка", runHelp},
+	}
+}
+
+// Выполняет подкоманду и возвращает код завершения
+func Run(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return ExitUsage
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Неизвестная команда %q\n\n", args[0])
+	printUsage(os.Stderr)
+	return ExitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Использование: saktoolbox <команда> [параметры]")
+	fmt.Fprintln(w, "Без команды запускается интерактивное меню.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Команды:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Протоколы весов: %s и имена протоколов из файла настроек\n", strings.Join(protocolNames(), ", "))
+	fmt.Fprintln(w)
+	fmt.Fprint(w, "Параметры порта (для scan, scale, echo, modbus-scan): --config файл")
+	for _, f := range serialFlags {
+		fmt.Fprintf(w, ", --%s", f.flag)
+	}
+	fmt.Fprintf(w, "\nБез --config используется %s из текущего каталога, если он есть.\n", logic.DefaultConfigPath)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Коды завершения: 0 - успех, 1 - тест не пройден, 2 - неверные аргументы, 3 - таймаут, 4 - ошибка порта или записи файла")
+}
+
+func runHelp(args []string) int {
+	printUsage(os.Stdout)
+	return ExitOK
+}
+
+// Список имен протоколов в алфавитном порядке
+func protocolNames() []string {
+	names := make([]string, 0, len(scaleProtocols))
+	for _, t := range scaleProtocols {
+		names = append(names, t.Code())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Общие параметры подключения
+type portFlags struct {
+	fs      *flag.FlagSet
+	port    string
+	timeout time.Duration
+	config  string
+}
+
+func newFlagSet(name string, pf *portFlags, timeout time.Duration) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&pf.port, "port", "", "порт: COM3, /dev/ttyUSB0, tcp://host:port, pty://, file://capture.bin")
+	fs.DurationVar(&pf.timeout, "timeout", timeout, "максимальное время ожидания данных")
+	fs.StringVar(&pf.config, "config", "", "файл настроек (по умолчанию "+logic.DefaultConfigPath+")")
+	for _, f := range serialFlags {
+		fs.String(f.flag, "", f.usage)
+	}
+	pf.fs = fs
+	return fs
+}
+
+// Разбирает аргументы. Возвращает код завершения, если продолжать не нужно
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK, false
+		}
+		return ExitUsage, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Лишние аргументы: %s\n", strings.Join(fs.Args(), " "))
+		return ExitUsage, false
+	}
+	return ExitOK, true
+}
+
+// Создает устройство: файл настроек, затем параметры порта из командной строки поверх него
+func newDevice(pf *portFlags, deviceType logic.DeviceType) (*logic.Device, int, bool) {
+	path := pf.config
+	if path == "" {
+		path = logic.DefaultConfigPath
+	}
+	cfg, err := logic.LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка в файле настроек: %s\n", err)
+		return nil, ExitUsage, false
+	}
+
+	device := &logic.Device{Port: pf.port, Type: deviceType}
+	cfg.Apply(device)
+	if device.Port == "" {
+		fmt.Fprintln(os.Stderr, "Не указан порт (--port)")
+		return nil, ExitUsage, false
+	}
+
+	settings := device.SerialSettings()
+	for _, f := range serialFlags {
+		if fl := pf.fs.Lookup(f.flag); fl != nil && fl.Value.String() != "" {
+			if err := settings.Set(f.name, fl.Value.String()); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return nil, ExitUsage, false
+			}
+		}
+	}
+	device.SetSerialSettings(settings)
+
+	return device, ExitOK, true
+}
+
+// Подключает устройство. Ошибку выводит в stderr
+func connect(device *logic.Device) bool {
+	if err := device.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка подключения к %s (%s): %s\n", device.Port, device.PortSettings(), device.LastError)
+		return false
+	}
+	if endpoint := device.Endpoint(); endpoint != device.Port {
+		if logic.IsSerialPort(device.Port) {
+			endpoint += " (" + device.PortSettings().String() + ")"
+		}
+		fmt.Fprintf(os.Stderr, "Подключено: %s\n", endpoint)
+	}
+	return true
+}
+
+// Читает результаты Process пока handle не вернет false или не выйдет время.
+// Пустые результаты (таймаут чтения порта) пропускаются.
+func readLoop(device *logic.Device, timeout time.Duration, handle func(str string) bool) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		str, err := device.Process()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %s\n", device.LastError)
+			return ExitError
+		}
+		if str != "" && !handle(str) {
+			return ExitOK
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintln(os.Stderr, "Время ожидания истекло")
+			return ExitTimeout
+		}
+	}
+}
+
+func runPorts(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "Лишние аргументы: %s\n", strings.Join(args, " "))
+		return ExitUsage
+	}
+	for _, name := range logic.GetAvailablePortList() {
+		fmt.Println(name)
+	}
+	return ExitOK
+}
+
+func runScan(args []string) int {
+	var pf portFlags
+	var count int
+	var diag, bench bool
+	var dupWindow time.Duration
+	var sheetPath string
+	fs := newFlagSet("scan", &pf, 30*time.Second)
+	fs.IntVar(&count, "count", 1, "сколько сканирований ждать")
+	fs.BoolVar(&diag, "diag", false, "диагностика настроек сканера: байты как есть, терминатор, префикс, суффикс, раскладка")
+	fs.BoolVar(&bench, "bench", false, "замер скорости: время каждого сканирования, паузы между байтами, повторы")
+	fs.DurationVar(&dupWindow, "dup-window", logic.ScanDuplicateWindowDefault, "повтор того же штрихкода за это время считается дублем (для --bench)")
+	fs.StringVar(&sheetPath, "sheet", "", "файл тестового листа: ждать, пока не будут прочитаны все штрихкоды листа")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	var sheet *logic.TestSheet
+	if sheetPath != "" {
+		var err error
+		if sheet, err = logic.LoadTestSheet(sheetPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+	}
+
+	device, code, ok := newDevice(&pf, logic.Scanner)
+	if !ok {
+		return code
+	}
+	device.TestSheet = sheet
+	if diag {
+		device.ScanDiag = &logic.ScanDiagnostics{}
+	}
+	if bench {
+		device.ScanBench = &logic.ScanBenchmark{DuplicateWindow: dupWindow}
+	}
+	if !connect(device) {
+		return ExitError
+	}
+	defer device.Disconnect()
+
+	// Одно чтение может вернуть несколько сканирований, по строке PASS/FAIL на каждое
+	received, failed := 0, false
+	code = readLoop(device, pf.timeout, func(str string) bool {
+		fmt.Println(str)
+		for _, line := range strings.Split(str, "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "PASS") || strings.HasPrefix(line, "FAIL") {
+				failed = failed || strings.HasPrefix(line, "FAIL")
+				received++
+			}
+		}
+		if sheet != nil {
+			return !sheet.Done()
+		}
+		return received < count
+	})
+	if diag {
+		fmt.Fprintln(os.Stderr, device.ScanDiag.Config())
+	}
+	if bench {
+		fmt.Fprintln(os.Stderr, device.ScanBench)
+	}
+	if sheet != nil {
+		fmt.Fprintln(os.Stderr, sheet)
+		if code != ExitError && !sheet.Passed() {
+			return ExitFail
+		}
+		return code
+	}
+	if code == ExitOK && failed {
+		return ExitFail
+	}
+	return code
+}
+
+func runScale(args []string) int {
+	var pf portFlags
+	var count int
+	var protocol, modbus, profile, faults string
+	fs := newFlagSet("scale", &pf, 10*time.Second)
+	fs.IntVar(&count, "count", 1, "сколько показаний веса получить (для эмуляторов - отправить)")
+	fs.StringVar(&protocol, "protocol", "", "протокол: "+strings.Join(protocolNames(), ", "))
+	fs.StringVar(&modbus, "modbus", "", modbusFlagUsage)
+	fs.StringVar(&profile, "profile", "random", "сценарий веса эмулятора: random, constant:1.25, ramp:1.25:5, noise:1.25:0.02, negative:1.25, tare:1.25:0.3, overload, zero, csv:файл")
+	fs.StringVar(&faults, "faults", "", "ошибки эмулятора, % кадров: drop, delay, noise, truncate, corrupt, checksum, duplicate, delaytime=2s")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	// Если встроенного протокола с таким именем нет - ищем в файле настроек
+	deviceType, ok := logic.ParseDeviceType(protocol)
+	if !ok || !slices.Contains(scaleProtocols, deviceType) {
+		deviceType = logic.ScalesCustom
+	}
+	weightProfile, err := logic.ParseWeightProfile(profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitUsage
+	}
+	faultSettings, err := logic.ParseFaultSettings(faults)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitUsage
+	}
+
+	device, code, ok := newDevice(&pf, deviceType)
+	if !ok {
+		return code
+	}
+	if deviceType == logic.ScalesCustom {
+		if device.Custom = device.FindProtocol(protocol); device.Custom == nil {
+			names := protocolNames()
+			for _, p := range device.Protocols {
+				names = append(names, p.Name)
+			}
+			fmt.Fprintf(os.Stderr, "Неизвестный протокол %q. Доступны: %s\n", protocol, strings.Join(names, ", "))
+			return ExitUsage
+		}
+	}
+	if !applyModbusFlag(device, modbus) {
+		return ExitUsage
+	}
+	device.Profile = weightProfile
+	device.Faults = faultSettings
+	if !connect(device) {
+		return ExitError
+	}
+	defer device.Disconnect()
+
+	received := 0
+	code = readLoop(device, pf.timeout, func(str string) bool {
+		// Штрихкоды весов-сканера выводятся, но показанием не считаются
+		if device.LastBarcode != nil {
+			fmt.Println("ШК:", str)
+			return true
+		}
+		// Сообщения весов об ошибках показанием не считаются
+		if device.LastReading == nil && !deviceType.IsEmulator() {
+			fmt.Fprintln(os.Stderr, str)
+			return true
+		}
+		fmt.Println(str)
+		received++
+		return received < count
+	})
+	fmt.Fprintln(os.Stderr, device.Stats)
+	if device.Faults.Enabled() {
+		fmt.Fprintln(os.Stderr, device.FaultStats)
+	}
+	return code
+}
+
+func runEcho(args []string) int {
+	var pf portFlags
+	var iterations int
+	fs := newFlagSet("echo", &pf, 0)
+	fs.IntVar(&iterations, "iterations", 10, "количество циклов записи-чтения")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	device, code, ok := newDevice(&pf, logic.EchoTest)
+	if !ok {
+		return code
+	}
+	if !connect(device) {
+		return ExitError
+	}
+	defer device.Disconnect()
+
+	// Каждый цикл сам ограничен таймаутом чтения порта, общий таймаут только если задан явно
+	deadline := time.Now().Add(pf.timeout)
+	failed := 0
+	for i := 1; i <= iterations; i++ {
+		str, err := device.Process()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %s\n", device.LastError)
+			return ExitError
+		}
+		fmt.Printf("%d %s\n", i, str)
+		if !strings.HasPrefix(str, "PASS") {
+			failed++
+		}
+		if pf.timeout > 0 && time.Now().After(deadline) {
+			fmt.Fprintln(os.Stderr, "Время ожидания истекло")
+			return ExitTimeout
+		}
+	}
+
+	fmt.Printf("Итого: %d из %d успешно\n", iterations-failed, iterations)
+	fmt.Println(device.Echo)
+	if failed > 0 {
+		return ExitFail
+	}
+	return ExitOK
+}
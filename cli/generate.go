@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+// Генерация штрихкодов: один штрихкод в PNG или SVG, или тестовый лист в HTML
+func runGen(args []string) int {
+	var symbology, data, out, sheetPath, htmlPath, listPath string
+	var scale int
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	fs.StringVar(&symbology, "type", "", "тип штрихкода: "+strings.Join(logic.GenerateSymbologies, ", "))
+	fs.StringVar(&data, "data", "", "код: GS записывается как <GS>, GS1 можно в виде (01)...(21)...; для GS1 DataMatrix без --data - код маркировки Честный знак")
+	fs.StringVar(&out, "out", "", "файл штрихкода: .png или .svg")
+	fs.IntVar(&scale, "scale", 4, "точек на модуль в PNG")
+	fs.StringVar(&sheetPath, "sheet", "", "файл тестового листа для --html (по умолчанию - встроенный набор)")
+	fs.StringVar(&htmlPath, "html", "", "HTML страница с тестовым листом для печати")
+	fs.StringVar(&listPath, "list", "", "записать список штрихкодов листа для scan --sheet")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	switch {
+	case out != "":
+		if symbology == "" {
+			fmt.Fprintln(os.Stderr, "Не указан тип штрихкода: --type")
+			return ExitUsage
+		}
+		if ext := strings.ToLower(filepath.Ext(out)); ext != ".png" && ext != ".svg" {
+			fmt.Fprintf(os.Stderr, "Неизвестный формат %q, нужен .png или .svg\n", out)
+			return ExitUsage
+		}
+		if name, _ := logic.FindSymbology(symbology); data == "" && name == "GS1 DataMatrix" {
+			data = logic.MarkingCode()
+			fmt.Println(data)
+		}
+		e, err := logic.NewSheetEntry(data, symbology)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+		code, err := logic.EncodeBarcode(e.Symbology, e.Data)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitUsage
+		}
+
+		if err := logic.WriteBarcodeFile(out, code, scale); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка записи %s: %s\n", out, err)
+			return ExitError
+		}
+		fmt.Fprintf(os.Stderr, "Записан %s\n", out)
+		return ExitOK
+
+	case htmlPath != "":
+		sheet := logic.DefaultTestSheet()
+		if sheetPath != "" {
+			var err error
+			if sheet, err = logic.LoadTestSheet(sheetPath); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return ExitUsage
+			}
+		}
+		// Сначала проверяется, что строятся все штрихкоды, чтобы не оставить половину страницы
+		for _, e := range sheet.Entries {
+			if _, err := e.Encode(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return ExitUsage
+			}
+		}
+		if code := writeFile(htmlPath, func(w io.Writer) error { return logic.WriteTestSheetHTML(w, sheet) }); code != ExitOK {
+			return code
+		}
+		if listPath != "" {
+			return writeFile(listPath, sheet.Write)
+		}
+		return ExitOK
+	}
+
+	fmt.Fprintln(os.Stderr, "Нужен --out для одного штрихкода или --html для тестового листа")
+	return ExitUsage
+}
+
+// Записывает файл и сообщает, куда
+func writeFile(path string, write func(w io.Writer) error) int {
+	f, err := os.Create(path)
+	if err == nil {
+		err = write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка записи %s: %s\n", path, err)
+		return ExitError
+	}
+	fmt.Fprintf(os.Stderr, "Записан %s\n", path)
+	return ExitOK
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Impuls2003/SAKDeviceToolbox/logic"
+)
+
+const modbusFlagUsage = "карта регистров Modbus: slave=1,function=3,address=0,format=int32,order=ABCD,decimals=3,unit=kg"
+
+// Применяет --modbus поверх карты регистров из файла настроек
+func applyModbusFlag(device *logic.Device, value string) bool {
+	if value == "" {
+		return true
+	}
+
+	settings := device.ModbusSettings()
+	for _, item := range strings.Split(value, ",") {
+		name, v, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Неверный параметр Modbus %q, нужно имя=значение\n", item)
+			return false
+		}
+		if err := settings.Set(name, v); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+	}
+	device.SetModbusSettings(settings)
+	return true
+}
+
+// Сканирование регистров Modbus и поиск регистра с известным весом
+func runModbusScan(args []string) int {
+	var pf portFlags
+	var from, to uint
+	var modbus, weightText string
+	fs := newFlagSet("modbus-scan", &pf, time.Minute)
+	fs.UintVar(&from, "from", 0, "начальный адрес регистра")
+	fs.UintVar(&to, "to", 99, "конечный адрес регистра")
+	fs.StringVar(&weightText, "weight", "", "вес груза на весах: искать регистры с этим значением")
+	fs.StringVar(&modbus, "modbus", "", modbusFlagUsage)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if to > 0xFFFF || to < from {
+		fmt.Fprintln(os.Stderr, "Неверный диапазон адресов")
+		return ExitUsage
+	}
+
+	var weight logic.Decimal
+	if weightText != "" {
+		var err error
+		if weight, err = logic.ParseDecimal(weightText); err != nil || weight.IsZero() {
+			fmt.Fprintf(os.Stderr, "Неверный вес %q, нужен ненулевой\n", weightText)
+			return ExitUsage
+		}
+	}
+
+	device, code, ok := newDevice(&pf, logic.ScalesModbus)
+	if !ok {
+		return code
+	}
+	if !applyModbusFlag(device, modbus) {
+		return ExitUsage
+	}
+	if !connect(device) {
+		return ExitError
+	}
+	defer device.Disconnect()
+
+	regs, err := device.ModbusScan(uint16(from), uint16(to), nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %s\n", device.LastError)
+		return ExitError
+	}
+
+	if weightText == "" {
+		for _, r := range regs {
+			fmt.Printf("%d\t0x%04X\t%d\t%d\n", r.Address, r.Value, r.Value, int16(r.Value))
+		}
+		return ExitOK
+	}
+
+	found := logic.FindModbusWeight(regs, weight, device.ModbusSettings())
+	for _, s := range found {
+		fmt.Printf("address=%d,format=%s,order=%s,decimals=%d\n", s.Address, s.Format, s.WordOrder(), s.Decimals)
+	}
+	if len(found) == 0 {
+		fmt.Fprintf(os.Stderr, "Вес %s не найден в %d прочитанных регистрах\n", weight, len(regs))
+		return ExitFail
+	}
+	return ExitOK
+}
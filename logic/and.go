@@ -0,0 +1,85 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Протокол A&D (GF, GX, FX, EK, HV/HW и совместимые), стандартный формат:
+//
+//	ST,+00123.45  g\r\n
+//
+// Заголовок: ST - стабильно, US - нестабильно, OL - перегрузка, QT - счетный режим,
+// HD - показание зафиксировано. У платформенных весов после заголовка может идти
+// GS/NT/TR (брутто, нетто, тара): "ST,NT,+0012.34kg".
+//
+// Запрос веса - Q CR LF. Непрерывная передача включается командой SIR и выключается C.
+
+const andMaxFrame = 32
+
+// Разбирает одну строку A&D без CR LF
+func decodeANDFrame(line []byte) (Reading, error) {
+	r := Reading{}
+	text := string(line)
+	if len(text) < 4 || text[2] != ',' {
+		return r, fmt.Errorf("нет заголовка A&D в %q", text)
+	}
+
+	switch text[:2] {
+	case "ST", "QT", "HD":
+		r.Stable = true
+	case "US":
+	case "OL":
+		r.Overload = true
+	default:
+		return r, fmt.Errorf("неверный заголовок A&D %q", text[:2])
+	}
+	text = text[3:]
+
+	if len(text) > 3 && text[2] == ',' {
+		switch text[:2] {
+		case "GS":
+		case "NT":
+			r.Mode = WeightNet
+		case "TR":
+			r.Mode = WeightTare
+		default:
+			return r, fmt.Errorf("неверный заголовок A&D %q", text[:2])
+		}
+		text = text[3:]
+	}
+
+	// При перегрузке вместо веса могут быть E или 9
+	if r.Overload {
+		return r, nil
+	}
+
+	weight, unit, ok := parseWeightText(text)
+	if !ok || unit == "" {
+		return r, fmt.Errorf("нет веса A&D в %q", text)
+	}
+	r.Weight = weight
+	r.Unit = strings.ReplaceAll(unit, "pc", "PC")
+	r.Zero = weight.IsZero()
+	return r, nil
+}
+
+// Чтение веса A&D по запросу
+func startReadWeightAND(d *Device) (string, error) {
+	return d.readTextFrameRequest([]byte("Q\r\n"), andMaxFrame, decodeANDFrame)
+}
+
+// Чтение веса A&D непрерывная передача данных
+func startReadWeightANDContinuous(d *Device) (string, error) {
+	return d.readTextFrameContinuous(andMaxFrame, decodeANDFrame)
+}
+
+// Включает непрерывную передачу A&D
+func startANDContinuous(d *Device) error {
+	return d.writeCommand("SIR\r\n")
+}
+
+// Выключает непрерывную передачу A&D
+func stopANDContinuous(d *Device) {
+	d.writeCommand("C\r\n")
+}
@@ -0,0 +1,69 @@
+package logic
+
+import (
+	"strings"
+	"time"
+)
+
+// Штрихкод, считанный сканером
+type Barcode struct {
+	Data      string
+	Symbology string // тип штрихкода: передан сканером или определен по содержимому
+	AIM       string // идентификатор символики AIM, если сканер его передает: "]E0"
+	Raw       []byte
+	Time      time.Time
+	Weighted  *WeightedBarcode // весовой штрихкод EAN-13 с префиксом 20-29
+	GS1       []GS1Element     // элементы кода GS1 и кода маркировки
+	Problems  []string         // что не так со штрихкодом, пусто - проверка пройдена
+}
+
+// Товар и вес из весового штрихкода EAN-13: 2X ТТТТТ ВВВВВ К
+type WeightedBarcode struct {
+	Prefix string  // 20-29
+	Item   string  // код товара, 5 цифр
+	Weight Decimal // вес в кг с тремя знаками (или цена - зависит от настройки весов магазина)
+}
+
+// Строка для вывода оператору: "4601234567893 (EAN-13)".
+// Код GS1 выводится по элементам: "(01)04601234567893(21)ABC (GS1 DataMatrix)"
+func (b Barcode) String() string {
+	data := b.Data
+	if len(b.GS1) > 0 {
+		data = GS1String(b.GS1)
+	}
+	if b.Symbology == "" {
+		return data
+	}
+	return data + " (" + b.Symbology + ")"
+}
+
+// Проверка пройдена
+func (b Barcode) Passed() bool {
+	return len(b.Problems) == 0
+}
+
+// Строка с результатом проверки: "PASS 2212345012342 (EAN-13) товар 12345, вес 1.234"
+// или "FAIL 4601234567890 (EAN-13): неверная контрольная цифра 0, должна быть 3"
+func (b Barcode) Report() string {
+	res := "PASS " + b.String()
+	if !b.Passed() {
+		res = "FAIL " + b.String()
+	}
+	if b.Weighted != nil {
+		res += " товар " + b.Weighted.Item + ", вес " + b.Weighted.Weight.String()
+	}
+	if !b.Passed() {
+		res += ": " + strings.Join(b.Problems, "; ")
+	}
+	return res
+}
+
+// Запоминает штрихкод и возвращает строку для вывода
+func (d *Device) setBarcode(b Barcode) (string, error) {
+	if b.Time.IsZero() {
+		b.Time = time.Now()
+	}
+	b.validate()
+	d.LastBarcode = &b
+	return b.String(), nil
+}
@@ -0,0 +1,197 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Протокол CAS (PD-II, DB-II, ER и совместимые).
+//
+// Полный кадр, 22 байта:
+//
+//	ST,NT,<id><lamp>,<вес 8 символов> kg\r\n
+//
+// Укороченные варианты без номера весов и байта индикаторов:
+//
+//	ST,GS,+  12.345 kg\r\n
+//	US,NT,   0.125kg\r\n
+//
+// Заголовок 1: ST - стабильно, US - нестабильно, OL - перегрузка.
+// Заголовок 2: NT - нетто, GS - брутто. Единицы: kg, g, lb.
+
+const (
+	casMaxFrame  = 32 // длиннее этого кадр CAS быть не может
+	casMinFrame  = 11 // "ST,GS,0 g\r\n"
+	casRequestID = 'D'
+)
+
+// Ищет в буфере следующий кадр CAS.
+// Возвращает показание, количество использованных байт и признак того, что кадр найден.
+// Мусор и битые кадры пропускаются с учетом в счетчиках.
+func nextCASFrame(buf []byte, stats *FrameStats) (Reading, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		// Синхронизация по началу кадра
+		start := casFrameStart(rest)
+		if start < 0 {
+			// Заголовок может быть разрезан на границе чтения - оставляем хвост
+			keep := min(len(rest), 2)
+			stats.SkippedBytes += len(rest) - keep
+			return Reading{}, len(buf) - keep, false
+		}
+		stats.SkippedBytes += start
+		used += start
+		rest = buf[used:]
+
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			if len(rest) > casMaxFrame {
+				// Конца кадра нет слишком долго - это не кадр, ищем следующий заголовок
+				stats.FramingErrors++
+				used += 2
+				continue
+			}
+			// Кадр еще не пришел целиком
+			return Reading{}, used, false
+		}
+
+		frame := rest[:end+1]
+		r, err := decodeCASFrame(frame)
+		if err != nil {
+			stats.FramingErrors++
+			// Внутри битого кадра может начинаться следующий, поэтому сдвигаемся только за заголовок
+			used += 2
+			continue
+		}
+
+		stats.Frames++
+		used += len(frame)
+		return r, used, true
+	}
+}
+
+// Позиция начала кадра: ST, US или OL перед запятой
+func casFrameStart(buf []byte) int {
+	for i := 0; i+2 < len(buf); i++ {
+		if buf[i+2] != ',' {
+			continue
+		}
+		switch string(buf[i : i+2]) {
+		case "ST", "US", "OL":
+			return i
+		}
+	}
+	return -1
+}
+
+// Разбирает один кадр CAS, начинающийся с заголовка и заканчивающийся \n
+func decodeCASFrame(frame []byte) (Reading, error) {
+	r := Reading{Raw: append([]byte(nil), frame...)}
+
+	if len(frame) < casMinFrame || len(frame) > casMaxFrame {
+		return r, fmt.Errorf("неверная длина кадра CAS: %d", len(frame))
+	}
+	if !bytes.HasSuffix(frame, []byte("\r\n")) {
+		return r, fmt.Errorf("кадр CAS не заканчивается CR LF")
+	}
+	body := frame[:len(frame)-2]
+
+	// Заголовок 1 - состояние
+	switch string(body[:2]) {
+	case "ST":
+		r.Stable = true
+	case "US":
+	case "OL":
+		r.Overload = true
+	default:
+		return r, fmt.Errorf("неверный заголовок CAS %q", body[:2])
+	}
+
+	// Заголовок 2 - брутто/нетто
+	if body[2] != ',' || body[5] != ',' {
+		return r, fmt.Errorf("нет разделителя в заголовке CAS")
+	}
+	switch string(body[3:5]) {
+	case "NT":
+		r.Mode = WeightNet
+	case "GS":
+		r.Mode = WeightGross
+	default:
+		return r, fmt.Errorf("неверный заголовок CAS %q", body[3:5])
+	}
+	body = body[6:]
+
+	// Номер весов и байт индикаторов - два байта (обычно двоичных) и запятая. Запятая
+	// в третьем байте бывает и десятичной (12,50kg), поэтому поле убирается, только если
+	// остаток кадра - вес, а весь кадр без удаления весом не читается
+	if len(body) > 3 && body[2] == ',' {
+		if _, _, err := casWeight(body[3:], r.Overload); err == nil {
+			if _, _, err := casWeight(body, r.Overload); err != nil {
+				body = body[3:]
+			}
+		}
+	}
+
+	weight, unit, err := casWeight(body, r.Overload)
+	if err != nil {
+		return r, err
+	}
+	r.Unit = unit
+	if r.Overload {
+		return r, nil
+	}
+	r.Weight = weight
+	r.Zero = weight.IsZero()
+
+	return r, nil
+}
+
+// Вес и единица измерения в конце кадра CAS. При перегрузке вместо веса могут быть
+// любые символы, и проверяется только единица
+func casWeight(body []byte, overload bool) (Decimal, string, error) {
+	text := strings.TrimRight(string(body), " ")
+	unit := ""
+	for _, u := range []string{"kg", "lb", "g"} {
+		if strings.HasSuffix(text, u) {
+			unit = u
+			break
+		}
+	}
+	if unit == "" {
+		return Decimal{}, "", fmt.Errorf("неизвестная единица измерения CAS в %q", text)
+	}
+	text = strings.TrimSpace(strings.TrimSuffix(text, unit))
+	if overload {
+		return Decimal{}, unit, nil
+	}
+
+	weight, err := ParseDecimal(strings.ReplaceAll(text, " ", ""))
+	if err != nil {
+		return Decimal{}, unit, fmt.Errorf("неверный вес CAS %q", text)
+	}
+	return weight, unit, nil
+}
+
+// Разбирает накопленные байты. Возвращает строку показания, если кадр найден
+func (d *Device) takeCASFrame() (string, bool) {
+	r, used, ok := nextCASFrame(d.rx, &d.Stats)
+	d.rx = d.rx[used:]
+	if !ok {
+		return "", false
+	}
+	str, _ := d.setReading(r)
+	return str, true
+}
+
+// Чтение веса CAS непрерывная передача данных
+func startReadWeightCAS(d *Device) (string, error) {
+	return d.readFrames(d.takeCASFrame)
+}
+
+// Чтение веса CAS вес по запросу
+func startReadWeightCASRequest(d *Device) (string, error) {
+	return d.requestFrame([]byte{casRequestID}, d.takeCASFrame)
+}
@@ -0,0 +1,104 @@
+package logic
+
+import "testing"
+
+func TestDecodeCASFrame(t *testing.T) {
+	tests := []struct {
+		frame  string
+		weight Decimal
+		unit   string
+		mode   WeightMode
+		stable bool
+	}{
+		{"ST,GS,   -1.250kg\r\n", NewDecimal(-1250, 3), "kg", WeightGross, true},
+		{"US,NT,+0012.34kg\r\n", NewDecimal(1234, 2), "kg", WeightNet, false},
+		{"ST,GS,0 g\r\n", NewDecimal(0, 0), "g", WeightGross, true},
+		// Номер весов и байт индикаторов
+		{"ST,GS,1\x80,  12.50kg\r\n", NewDecimal(1250, 2), "kg", WeightGross, true},
+		{"ST,NT,01,  12.50lb\r\n", NewDecimal(1250, 2), "lb", WeightNet, true},
+		{"ST,NT,\x01\xbc,   12.34 kg\r\n", NewDecimal(1234, 2), "kg", WeightNet, true}, // как у EmulatorCAS
+		// Десятичная запятая в третьем байте - это вес, а не номер весов
+		{"ST,GS,12,50kg\r\n", NewDecimal(1250, 2), "kg", WeightGross, true},
+		{"ST,GS,   12,5kg\r\n", NewDecimal(125, 1), "kg", WeightGross, true},
+	}
+	for _, tt := range tests {
+		r, err := decodeCASFrame([]byte(tt.frame))
+		if err != nil {
+			t.Errorf("%q: %v", tt.frame, err)
+			continue
+		}
+		if r.Weight != tt.weight || r.Unit != tt.unit || r.Mode != tt.mode || r.Stable != tt.stable {
+			t.Errorf("%q: вес %s %s, режим %v, стабильный %v; нужно %s %s, %v, %v",
+				tt.frame, r.Weight, r.Unit, r.Mode, r.Stable, tt.weight, tt.unit, tt.mode, tt.stable)
+		}
+	}
+}
+
+func TestDecodeCASFrameOverload(t *testing.T) {
+	r, err := decodeCASFrame([]byte("OL,GS,  ------kg\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Overload || r.Unit != "kg" {
+		t.Errorf("перегруз %v, единица %q", r.Overload, r.Unit)
+	}
+}
+
+func TestDecodeCASFrameErrors(t *testing.T) {
+	for _, frame := range []string{
+		"ST,GS,  12.50kg",      // нет CR LF
+		"XX,GS,  12.50kg\r\n",  // неверный заголовок
+		"ST;GS,  12.50kg\r\n",  // нет разделителя
+		"ST,TR,  12.50kg\r\n",  // неверный режим
+		"ST,GS,  12.50oz\r\n",  // неизвестная единица
+		"ST,GS,  12.5x0kg\r\n", // неверный вес
+		"ST,GS,\r\n",           // слишком короткий
+	} {
+		if _, err := decodeCASFrame([]byte(frame)); err == nil {
+			t.Errorf("%q: нет ошибки", frame)
+		}
+	}
+}
+
+// Поток с мусором и битым кадром: кадры находятся, ошибки считаются
+func TestNextCASFrame(t *testing.T) {
+	stream := []byte("xxST,GS,  1.00kg\r\nST,GS,  2.x0kg\r\nST,GS,  3.00kg\r\n")
+	var stats FrameStats
+	var weights []Decimal
+	for {
+		r, used, ok := nextCASFrame(stream, &stats)
+		stream = stream[used:]
+		if !ok {
+			break
+		}
+		weights = append(weights, r.Weight)
+	}
+	if len(weights) != 2 || weights[0] != NewDecimal(100, 2) || weights[1] != NewDecimal(300, 2) {
+		t.Errorf("веса %v", weights)
+	}
+	if stats.Frames != 2 || stats.FramingErrors != 1 {
+		t.Errorf("кадров %d, ошибок %d, нужно 2 и 1", stats.Frames, stats.FramingErrors)
+	}
+}
+
+// Кадр эмулятора CAS с двоичным номером весов читается устройством чтения CAS
+func TestEmulateCASRoundTrip(t *testing.T) {
+	for _, weight := range []Decimal{NewDecimal(1234, emulatorScale), NewDecimal(-550, emulatorScale)} {
+		d := emulatorPair(t, EmulatorCAS, ScalesCAS, weight)
+		r := readWeight(t, d)
+		if r.Weight != weight || r.Unit != "kg" || !r.Stable {
+			t.Errorf("%s: разобрано %s %s, стабильный %v", weight, r.Weight, r.Unit, r.Stable)
+		}
+		if d.Stats.FramingErrors != 0 {
+			t.Errorf("%s: ошибок кадров %d", weight, d.Stats.FramingErrors)
+		}
+	}
+}
+
+// Вес, который не помещается в 8 символов кадра, эмулятор передает как перегрузку
+func TestEmulateCASLongWeight(t *testing.T) {
+	d := emulatorPair(t, EmulatorCAS, ScalesCAS, NewDecimal(12345678, emulatorScale))
+	if r := readWeight(t, d); !r.Overload {
+		t.Errorf("нет перегрузки, вес %s", r.Weight)
+	}
+}
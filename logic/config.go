@@ -0,0 +1,155 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Файл настроек, который ищется в текущем каталоге если путь не указан явно
+const DefaultConfigPath = "saktoolbox.json"
+
+// Содержимое файла настроек.
+//
+//	{
+//	  "port": "COM3",
+//	  "serial": {
+//	    "cas":  {"baud": 4800},
+//	    "keli": {"baud": 2400, "parity": "E", "dataBits": 7}
+//	  },
+//	  "modbus": {"slave": 1, "function": 3, "address": 0, "format": "int32", "order": "ABCD", "decimals": 3, "unit": "kg"},
+//	  "protocols": [
+//	    {"name": "Весы ВТ-150", "request": "05", "end": "0D 0A", "regex": "(?P<weight>[-0-9.]+) *(?P<unit>kg|g)"}
+//	  ]
+//	}
+//
+// Для каждого протокола указываются только отличия от значений по умолчанию.
+// Описание протоколов в protocols - см. CustomProtocol.
+type Config struct {
+	Port      string
+	Serial    map[DeviceType]SerialSettings
+	Modbus    *ModbusSettings
+	Protocols []*CustomProtocol
+}
+
+type configJSON struct {
+	Port      string                     `json:"port,omitempty"`
+	Serial    map[string]json.RawMessage `json:"serial,omitempty"`
+	Modbus    json.RawMessage            `json:"modbus,omitempty"`
+	Protocols []json.RawMessage          `json:"protocols,omitempty"`
+}
+
+// Читает файл настроек. Если файла нет - возвращает пустые настройки без ошибки
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{Serial: map[DeviceType]SerialSettings{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw configJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg.Port = raw.Port
+	for code, msg := range raw.Serial {
+		t, ok := ParseDeviceType(code)
+		if !ok {
+			return nil, fmt.Errorf("%s: неизвестный протокол %q", path, code)
+		}
+		// Поверх значений по умолчанию, чтобы в файле можно было указывать только отличия
+		settings := DefaultSerialSettings(t)
+		if err := json.Unmarshal(msg, &settings); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, code, err)
+		}
+		cfg.Serial[t] = settings
+	}
+
+	if raw.Modbus != nil {
+		modbus := DefaultModbusSettings()
+		if err := json.Unmarshal(raw.Modbus, &modbus); err != nil {
+			return nil, fmt.Errorf("%s: modbus: %w", path, err)
+		}
+		cfg.Modbus = &modbus
+	}
+
+	for i, msg := range raw.Protocols {
+		p := &CustomProtocol{}
+		if err := json.Unmarshal(msg, p); err != nil {
+			return nil, fmt.Errorf("%s: protocols[%d]: %w", path, i, err)
+		}
+		for _, other := range cfg.Protocols {
+			if strings.EqualFold(other.Name, p.Name) {
+				return nil, fmt.Errorf("%s: протокол %q описан дважды", path, p.Name)
+			}
+		}
+		cfg.Protocols = append(cfg.Protocols, p)
+	}
+
+	return cfg, nil
+}
+
+// Сохраняет файл настроек
+func (c *Config) Save(path string) error {
+	raw := configJSON{Port: c.Port, Serial: map[string]json.RawMessage{}}
+	for t, settings := range c.Serial {
+		msg, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		raw.Serial[t.Code()] = msg
+	}
+	if c.Modbus != nil {
+		msg, err := json.Marshal(c.Modbus)
+		if err != nil {
+			return err
+		}
+		raw.Modbus = msg
+	}
+	for _, p := range c.Protocols {
+		msg, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		raw.Protocols = append(raw.Protocols, msg)
+	}
+
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Переносит настройки в устройство. Порт - только если он еще не выбран
+func (c *Config) Apply(d *Device) {
+	if d.Port == "" {
+		d.Port = c.Port
+	}
+	for t, settings := range c.Serial {
+		if d.Settings == nil {
+			d.Settings = map[DeviceType]SerialSettings{}
+		}
+		d.Settings[t] = settings
+	}
+	if c.Modbus != nil {
+		d.SetModbusSettings(*c.Modbus)
+	}
+	d.Protocols = c.Protocols
+}
+
+// Собирает настройки из устройства для сохранения
+func ConfigFromDevice(d *Device) *Config {
+	cfg := &Config{Port: d.Port, Serial: map[DeviceType]SerialSettings{}, Modbus: d.Modbus, Protocols: d.Protocols}
+	for t, settings := range d.Settings {
+		cfg.Serial[t] = settings
+	}
+	return cfg
+}
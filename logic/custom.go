@@ -0,0 +1,494 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Протоколы весов, описанные в файле настроек. Позволяют подключить безымянные весы без
+// доработки программы: задается запрос веса, период опроса, границы кадра, контрольная сумма
+// и где в кадре лежат вес, единица измерения и признак стабильности.
+//
+//	{
+//	  "name": "Весы ВТ-150",
+//	  "request": "05",
+//	  "interval": "500ms",
+//	  "start": "02",
+//	  "end": "0D 0A",
+//	  "checksum": "xor",
+//	  "regex": "^(?P<stable>[SU]) *(?P<weight>[-+ 0-9.]+) *(?P<unit>kg|g)$",
+//	  "stable": "S"
+//	}
+//
+// Байты задаются в HEX. Без request весы считаются передающими непрерывно.
+// Кадр - от маркера start до маркера end, или фиксированной длины length вместе с маркерами.
+// Контрольная сумма стоит в конце кадра перед end и считается по байтам между start и ней.
+// Вес, единица и признак стабильности берутся из именованных групп regex (weight, unit, stable)
+// или по смещениям fields в данных кадра - без start, контрольной суммы и end:
+//
+//	"fields": {"weight": {"offset": 1, "length": 7}, "unit": {"offset": 8, "length": 2}}
+//
+// Если stable задан, вес стабилен, когда поле stable равно ему, иначе - когда поле не пустое.
+// Без поля stable вес стабилен, если совпадает с предыдущим.
+
+const (
+	customMaxFrame        = 256                    // кадр без конца длиннее этого выбрасывается
+	customDefaultInterval = 500 * time.Millisecond // период опроса по умолчанию
+)
+
+// Контрольная сумма кадра
+type ChecksumType int
+
+const (
+	ChecksumNone  ChecksumType = iota // нет
+	ChecksumXOR                       // XOR всех байт
+	ChecksumSum                       // сумма байт по модулю 256
+	ChecksumCRC16                     // CRC-16 Modbus, младший байт первым
+)
+
+var checksumNames = []string{"none", "xor", "sum", "crc16"}
+
+func (c ChecksumType) String() string {
+	return checksumNames[c]
+}
+
+// Размер контрольной суммы в байтах
+func (c ChecksumType) Size() int {
+	switch c {
+	case ChecksumXOR, ChecksumSum:
+		return 1
+	case ChecksumCRC16:
+		return 2
+	}
+	return 0
+}
+
+func ParseChecksumType(s string) (ChecksumType, error) {
+	if s == "" {
+		return ChecksumNone, nil
+	}
+	for i, name := range checksumNames {
+		if strings.EqualFold(name, s) {
+			return ChecksumType(i), nil
+		}
+	}
+	return ChecksumNone, fmt.Errorf("неизвестная контрольная сумма %q, доступны: %s", s, strings.Join(checksumNames, ", "))
+}
+
+// Считает контрольную сумму в том виде, в каком она передается
+func (c ChecksumType) compute(data []byte) []byte {
+	switch c {
+	case ChecksumXOR:
+		return []byte{shtrihLRC(data)}
+	case ChecksumSum:
+		var sum byte
+		for _, b := range data {
+			sum += b
+		}
+		return []byte{sum}
+	case ChecksumCRC16:
+		return binary.LittleEndian.AppendUint16(nil, modbusCRC(data))
+	}
+	return nil
+}
+
+// Положение поля в данных кадра
+type CustomField struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// Имена полей кадра: в fields и именованные группы regex
+var customFieldNames = []string{"weight", "unit", "stable"}
+
+// Протокол весов из файла настроек
+type CustomProtocol struct {
+	Name        string
+	Request     []byte        // запрос веса, пусто - непрерывная передача
+	Interval    time.Duration // период опроса
+	Start       []byte        // маркер начала кадра
+	End         []byte        // маркер конца кадра
+	Length      int           // длина кадра с маркерами, 0 - до маркера конца
+	Checksum    ChecksumType
+	ChecksumHex bool           // контрольная сумма передается HEX символами
+	Regex       *regexp.Regexp // разбор данных кадра, как текста
+	Fields      map[string]CustomField
+	Stable      string // значение поля stable у стабильного веса
+	Unit        string // единица измерения, если в кадре ее нет
+	Decimals    int    // знаков после запятой, если вес передается без точки
+}
+
+type customProtocolJSON struct {
+	Name        string                 `json:"name"`
+	Request     string                 `json:"request,omitempty"`
+	Interval    string                 `json:"interval,omitempty"`
+	Start       string                 `json:"start,omitempty"`
+	End         string                 `json:"end,omitempty"`
+	Length      int                    `json:"length,omitempty"`
+	Checksum    string                 `json:"checksum,omitempty"`
+	ChecksumHex bool                   `json:"checksumHex,omitempty"`
+	Regex       string                 `json:"regex,omitempty"`
+	Fields      map[string]CustomField `json:"fields,omitempty"`
+	Stable      string                 `json:"stable,omitempty"`
+	Unit        string                 `json:"unit,omitempty"`
+	Decimals    int                    `json:"decimals,omitempty"`
+}
+
+// Байты в HEX через пробел: "02 41 03"
+func formatHexBytes(data []byte) string {
+	return fmt.Sprintf("% X", data)
+}
+
+// Разбирает HEX байты, пробелы между байтами необязательны
+func parseHexBytes(s string) ([]byte, error) {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, fmt.Errorf("неверные HEX байты %q", s)
+	}
+	return data, nil
+}
+
+func (p *CustomProtocol) MarshalJSON() ([]byte, error) {
+	v := customProtocolJSON{
+		Name:        p.Name,
+		Request:     formatHexBytes(p.Request),
+		Start:       formatHexBytes(p.Start),
+		End:         formatHexBytes(p.End),
+		Length:      p.Length,
+		ChecksumHex: p.ChecksumHex,
+		Fields:      p.Fields,
+		Stable:      p.Stable,
+		Unit:        p.Unit,
+		Decimals:    p.Decimals,
+	}
+	if len(p.Request) > 0 {
+		v.Interval = p.Interval.String()
+	}
+	if p.Checksum != ChecksumNone {
+		v.Checksum = p.Checksum.String()
+	}
+	if p.Regex != nil {
+		v.Regex = p.Regex.String()
+	}
+	return json.Marshal(v)
+}
+
+func (p *CustomProtocol) UnmarshalJSON(data []byte) error {
+	var v customProtocolJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	res := CustomProtocol{
+		Name:        strings.TrimSpace(v.Name),
+		Length:      v.Length,
+		ChecksumHex: v.ChecksumHex,
+		Fields:      v.Fields,
+		Stable:      v.Stable,
+		Unit:        v.Unit,
+		Decimals:    v.Decimals,
+		Interval:    customDefaultInterval,
+	}
+	if res.Name == "" {
+		return fmt.Errorf("не задано имя протокола (name)")
+	}
+
+	var err error
+	for _, b := range []struct {
+		dst  *[]byte
+		text string
+	}{{&res.Request, v.Request}, {&res.Start, v.Start}, {&res.End, v.End}} {
+		if *b.dst, err = parseHexBytes(b.text); err != nil {
+			return err
+		}
+	}
+	if v.Interval != "" {
+		if res.Interval, err = time.ParseDuration(v.Interval); err != nil || res.Interval <= 0 {
+			return fmt.Errorf("неверный период опроса %q", v.Interval)
+		}
+	}
+	if res.Checksum, err = ParseChecksumType(v.Checksum); err != nil {
+		return err
+	}
+	if v.Regex != "" {
+		if res.Regex, err = regexp.Compile(v.Regex); err != nil {
+			return fmt.Errorf("неверное регулярное выражение: %w", err)
+		}
+	}
+
+	if err := res.validate(); err != nil {
+		return err
+	}
+	*p = res
+	return nil
+}
+
+// Проверяет, что по описанию можно найти кадр и вес в нем
+func (p *CustomProtocol) validate() error {
+	if p.Length < 0 || p.Length > customMaxFrame {
+		return fmt.Errorf("длина кадра должна быть от 1 до %d", customMaxFrame)
+	}
+	if p.Length == 0 && len(p.End) == 0 {
+		return fmt.Errorf("не задан конец кадра: end или length")
+	}
+	if p.Length > 0 && p.Length < len(p.Start)+p.checksumLen()+len(p.End)+1 {
+		return fmt.Errorf("длина кадра %d меньше маркеров и контрольной суммы", p.Length)
+	}
+	if p.Decimals < 0 || p.Decimals > 6 {
+		return fmt.Errorf("неверное количество знаков после запятой %d", p.Decimals)
+	}
+
+	if p.Regex != nil && p.Fields != nil {
+		return fmt.Errorf("разбор кадра задается либо regex, либо fields")
+	}
+	if p.Regex != nil {
+		if p.Regex.SubexpIndex("weight") < 0 {
+			return fmt.Errorf("в regex нет группы (?P<weight>...)")
+		}
+		return nil
+	}
+
+	if _, ok := p.Fields["weight"]; !ok {
+		return fmt.Errorf("не задано положение веса: regex с группой weight или fields.weight")
+	}
+	for name, f := range p.Fields {
+		if !slices.Contains(customFieldNames, name) {
+			return fmt.Errorf("неизвестное поле %q, доступны: %s", name, strings.Join(customFieldNames, ", "))
+		}
+		if f.Offset < 0 || f.Length <= 0 {
+			return fmt.Errorf("неверное положение поля %s", name)
+		}
+	}
+	return nil
+}
+
+// Длина контрольной суммы в кадре
+func (p *CustomProtocol) checksumLen() int {
+	if p.ChecksumHex {
+		return p.Checksum.Size() * 2
+	}
+	return p.Checksum.Size()
+}
+
+// Кратко для меню: "запрос 05 каждые 500ms, xor" или "непрерывно"
+func (p *CustomProtocol) String() string {
+	res := "непрерывно"
+	if len(p.Request) > 0 {
+		res = fmt.Sprintf("запрос %s каждые %s", formatHexBytes(p.Request), p.Interval)
+	}
+	if p.Checksum != ChecksumNone {
+		res += ", " + p.Checksum.String()
+	}
+	return res
+}
+
+// Есть ли в кадре признак стабильности
+func (p *CustomProtocol) hasStable() bool {
+	if p.Regex != nil {
+		return p.Regex.SubexpIndex("stable") >= 0
+	}
+	_, ok := p.Fields["stable"]
+	return ok
+}
+
+// Значения полей из данных кадра. Полей, которых нет в описании, нет и в результате
+func (p *CustomProtocol) fieldValues(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	if p.Regex != nil {
+		m := p.Regex.FindSubmatch(data)
+		if m == nil {
+			return nil, fmt.Errorf("данные кадра не подходят под regex")
+		}
+		for _, name := range customFieldNames {
+			if i := p.Regex.SubexpIndex(name); i >= 0 {
+				values[name] = string(m[i])
+			}
+		}
+		return values, nil
+	}
+
+	for name, f := range p.Fields {
+		if f.Offset+f.Length > len(data) {
+			return nil, fmt.Errorf("поле %s за пределами кадра", name)
+		}
+		values[name] = string(data[f.Offset : f.Offset+f.Length])
+	}
+	return values, nil
+}
+
+// Разбирает данные кадра. Стабильность без поля stable определяет вызывающий
+func (p *CustomProtocol) decode(data []byte) (Reading, error) {
+	r := Reading{Unit: p.Unit}
+
+	values, err := p.fieldValues(data)
+	if err != nil {
+		return r, err
+	}
+
+	if r.Weight, err = ParseDecimal(values["weight"]); err != nil {
+		return r, err
+	}
+	if r.Weight.Scale == 0 && p.Decimals > 0 {
+		r.Weight.Scale = p.Decimals
+	}
+	r.Zero = r.Weight.IsZero()
+
+	if unit := strings.TrimSpace(values["unit"]); unit != "" {
+		r.Unit = unit
+	}
+	if stable, ok := values["stable"]; ok {
+		stable = strings.TrimSpace(stable)
+		if p.Stable != "" {
+			r.Stable = stable == p.Stable
+		} else {
+			r.Stable = stable != ""
+		}
+	}
+	return r, nil
+}
+
+// Ищет в буфере следующий кадр и разбирает его. Кадры, которые не удалось разобрать,
+// учитываются в FramingErrors, с неверной контрольной суммой - в ChecksumErrors.
+func (p *CustomProtocol) nextFrame(buf []byte, stats *FrameStats) (Reading, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		if len(p.Start) > 0 {
+			start := bytes.Index(rest, p.Start)
+			if start < 0 {
+				// Конец буфера может оказаться началом маркера
+				keep := min(len(rest), len(p.Start)-1)
+				stats.SkippedBytes += len(rest) - keep
+				return Reading{}, len(buf) - keep, false
+			}
+			stats.SkippedBytes += start
+			used += start
+			rest = buf[used:]
+		}
+
+		var frame []byte
+		if p.Length > 0 {
+			if len(rest) < p.Length {
+				return Reading{}, used, false
+			}
+			frame = rest[:p.Length]
+			if !bytes.HasSuffix(frame, p.End) {
+				stats.FramingErrors++
+				used += p.resync()
+				continue
+			}
+		} else {
+			end := bytes.Index(rest[len(p.Start):], p.End)
+			if end < 0 {
+				if len(rest) > customMaxFrame {
+					// Конца кадра нет слишком долго - выбрасываем
+					stats.FramingErrors++
+					used += p.resync()
+					continue
+				}
+				return Reading{}, used, false
+			}
+			frame = rest[:len(p.Start)+end+len(p.End)]
+		}
+
+		data := frame[len(p.Start) : len(frame)-len(p.End)]
+		if len(data) < p.checksumLen() {
+			stats.FramingErrors++
+			used += len(frame)
+			continue
+		}
+		data, sum := data[:len(data)-p.checksumLen()], data[len(data)-p.checksumLen():]
+		if !p.checkSum(data, sum) {
+			stats.ChecksumErrors++
+			used += len(frame)
+			continue
+		}
+
+		r, err := p.decode(data)
+		if err != nil {
+			stats.FramingErrors++
+			used += len(frame)
+			continue
+		}
+		r.Raw = append([]byte(nil), frame...)
+		stats.Frames++
+		return r, used + len(frame), true
+	}
+}
+
+// На сколько байт сдвинуться после испорченного кадра: за маркер начала или на один байт
+func (p *CustomProtocol) resync() int {
+	return max(1, len(p.Start))
+}
+
+// Проверяет контрольную сумму из кадра
+func (p *CustomProtocol) checkSum(data, sum []byte) bool {
+	want := p.Checksum.compute(data)
+	if p.ChecksumHex {
+		return strings.EqualFold(string(sum), hex.EncodeToString(want))
+	}
+	return bytes.Equal(sum, want)
+}
+
+// Протокол из файла настроек по имени
+func (d *Device) FindProtocol(name string) *CustomProtocol {
+	for _, p := range d.Protocols {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Разбирает накопленные байты по выбранному протоколу
+func (d *Device) takeCustomFrame() (string, bool) {
+	r, used, ok := d.Custom.nextFrame(d.rx, &d.Stats)
+	d.rx = d.rx[used:]
+	if !ok {
+		return "", false
+	}
+	// Признака стабильности в кадре нет: вес стабилен, если совпадает с предыдущим
+	if !d.Custom.hasStable() {
+		r.Stable = d.prevReading != nil && d.prevReading.Weight == r.Weight
+	}
+	str, _ := d.setReading(r)
+	return str, true
+}
+
+// Чтение веса по протоколу из файла настроек: по запросу с заданным периодом или непрерывно
+func startReadWeightCustom(d *Device) (string, error) {
+	if d.Custom == nil {
+		return "", d.fail("Не выбран протокол весов")
+	}
+
+	for {
+		// Сначала то, что уже накопилось
+		if str, ok := d.takeCustomFrame(); ok {
+			return str, nil
+		}
+
+		if len(d.Custom.Request) > 0 && time.Since(d.lastRequest) >= d.Custom.Interval {
+			d.lastRequest = time.Now()
+			if _, err := d.transport.Write(d.Custom.Request); err != nil {
+				d.LastError = err.Error()
+				return "", err
+			}
+		}
+
+		n, err := d.readMore()
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			return "", nil
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package logic
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Протокол из описания в начале custom.go
+const customExample = `{
+  "name": "Весы ВТ-150",
+  "request": "05",
+  "interval": "500ms",
+  "start": "02",
+  "end": "0D 0A",
+  "checksum": "xor",
+  "regex": "^(?P<stable>[SU]) *(?P<weight>[-+ 0-9.]+) *(?P<unit>kg|g)$",
+  "stable": "S"
+}`
+
+func loadCustomProtocol(t *testing.T, text string) *CustomProtocol {
+	t.Helper()
+	p := &CustomProtocol{}
+	if err := json.Unmarshal([]byte(text), p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// Кадр протокола: start, данные, контрольная сумма, end
+func customFrame(p *CustomProtocol, data string) []byte {
+	sum := p.Checksum.compute([]byte(data))
+	if p.ChecksumHex {
+		sum = []byte(strings.ToUpper(hex.EncodeToString(sum)))
+	}
+	frame := append(append([]byte(nil), p.Start...), data...)
+	return append(append(frame, sum...), p.End...)
+}
+
+func TestCustomProtocolJSON(t *testing.T) {
+	p := loadCustomProtocol(t, customExample)
+	if p.Name != "Весы ВТ-150" || string(p.Request) != "\x05" || p.Interval != 500*time.Millisecond ||
+		string(p.Start) != "\x02" || string(p.End) != "\r\n" || p.Checksum != ChecksumXOR || p.Regex == nil {
+		t.Errorf("протокол %+v", p)
+	}
+	if got := p.String(); got != "запрос 05 каждые 500ms, xor" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// Сохраненный протокол загружается обратно таким же
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := loadCustomProtocol(t, string(data))
+	if again.String() != p.String() || string(again.End) != string(p.End) || again.Regex.String() != p.Regex.String() {
+		t.Errorf("после сохранения %s", data)
+	}
+
+	continuous := loadCustomProtocol(t, `{"name": "Н", "end": "0D", "fields": {"weight": {"offset": 0, "length": 6}}}`)
+	if continuous.Interval != customDefaultInterval || continuous.String() != "непрерывно" {
+		t.Errorf("непрерывный протокол %+v", continuous)
+	}
+}
+
+func TestCustomProtocolJSONErrors(t *testing.T) {
+	tests := []struct {
+		json, want string
+	}{
+		{`{"end": "0D"}`, "не задано имя"},
+		{`{"name": "Н", "end": "0X", "regex": "(?P<weight>.*)"}`, "неверные HEX байты"},
+		{`{"name": "Н", "end": "0D", "interval": "быстро", "regex": "(?P<weight>.*)"}`, "неверный период опроса"},
+		{`{"name": "Н", "end": "0D", "checksum": "md5", "regex": "(?P<weight>.*)"}`, "неизвестная контрольная сумма"},
+		{`{"name": "Н", "end": "0D", "regex": "(?P<weight>"}`, "неверное регулярное выражение"},
+		{`{"name": "Н", "regex": "(?P<weight>.*)"}`, "не задан конец кадра"},
+		{`{"name": "Н", "start": "02", "length": 2, "checksum": "sum", "regex": "(?P<weight>.*)"}`, "меньше маркеров"},
+		{`{"name": "Н", "end": "0D", "regex": "(?P<w>.*)"}`, "нет группы"},
+		{`{"name": "Н", "end": "0D"}`, "не задано положение веса"},
+		{`{"name": "Н", "end": "0D", "fields": {"weight": {"offset": 0, "length": 6}, "tare": {"offset": 6, "length": 1}}}`, "неизвестное поле"},
+		{`{"name": "Н", "end": "0D", "fields": {"weight": {"offset": 0, "length": 0}}}`, "неверное положение поля"},
+		{`{"name": "Н", "end": "0D", "decimals": 9, "fields": {"weight": {"offset": 0, "length": 6}}}`, "знаков после запятой"},
+	}
+	for _, tt := range tests {
+		var p CustomProtocol
+		err := json.Unmarshal([]byte(tt.json), &p)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ошибка %v, нужно %q", tt.json, err, tt.want)
+		}
+	}
+}
+
+func TestChecksumCompute(t *testing.T) {
+	data := []byte("+01.250")
+	if got := ChecksumXOR.compute(data); got[0] != shtrihLRC(data) {
+		t.Errorf("xor % X", got)
+	}
+	if got := ChecksumSum.compute([]byte{0xF0, 0x20}); got[0] != 0x10 {
+		t.Errorf("sum % X, нужно 10", got)
+	}
+	// CRC-16 Modbus, младший байт первым
+	if got := ChecksumCRC16.compute([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}); hex.EncodeToString(got) != "840a" {
+		t.Errorf("crc16 % X, нужно 84 0A", got)
+	}
+	if ChecksumNone.compute(data) != nil || ChecksumNone.Size() != 0 || ChecksumCRC16.Size() != 2 {
+		t.Error("размер контрольной суммы")
+	}
+}
+
+func TestCustomProtocolNextFrame(t *testing.T) {
+	p := loadCustomProtocol(t, customExample)
+	good := customFrame(p, "S  1.250kg")
+	bad := customFrame(p, "U  1.300kg")
+	bad[len(bad)-3] ^= 0x01
+	buf := append(append(append(append([]byte("xx"), bad...), customFrame(p, "ABC")...), good...), 0x02, 'U')
+
+	var stats FrameStats
+	readings := []Reading{}
+	for {
+		r, used, ok := p.nextFrame(buf, &stats)
+		buf = buf[used:]
+		if !ok {
+			break
+		}
+		readings = append(readings, r)
+	}
+	if len(readings) != 1 || readings[0].Weight != NewDecimal(1250, 3) || readings[0].Unit != "kg" || !readings[0].Stable {
+		t.Errorf("показания %+v", readings)
+	}
+	// Неполный кадр в конце ждет продолжения
+	if stats.Frames != 1 || stats.ChecksumErrors != 1 || stats.FramingErrors != 1 || stats.SkippedBytes != 2 || string(buf) != "\x02U" {
+		t.Errorf("счетчики %+v, осталось %q", stats, buf)
+	}
+}
+
+// Кадр фиксированной длины, поля по смещениям, CRC-16 HEX символами, вес без точки
+func TestCustomProtocolFields(t *testing.T) {
+	p := loadCustomProtocol(t, `{
+		"name": "Поля", "start": "02", "end": "03", "length": 14,
+		"checksum": "crc16", "checksumHex": true, "decimals": 3, "unit": "kg",
+		"fields": {"weight": {"offset": 1, "length": 6}, "stable": {"offset": 0, "length": 1}}
+	}`)
+	frame := customFrame(p, "S-01250 ")
+	if len(frame) != p.Length {
+		t.Fatalf("длина кадра %d, нужно %d", len(frame), p.Length)
+	}
+	unstable := customFrame(p, " 000000 ")
+
+	var stats FrameStats
+	r, used, ok := p.nextFrame(append(frame, unstable...), &stats)
+	if !ok || used != len(frame) || r.Weight != NewDecimal(-1250, 3) || r.Unit != "kg" || !r.Stable {
+		t.Errorf("%q: разобрано %+v", frame, r)
+	}
+	r, _, ok = p.nextFrame(unstable, &stats)
+	if !ok || r.Stable || !r.Zero {
+		t.Errorf("%q: разобрано %+v", unstable, r)
+	}
+
+	// Кадр без маркера конца на своем месте - ошибка структуры
+	broken := append([]byte(nil), frame...)
+	broken[len(broken)-1] = 'x'
+	stats = FrameStats{}
+	if _, _, ok := p.nextFrame(append(broken, frame...), &stats); !ok || stats.FramingErrors != 1 {
+		t.Errorf("после испорченного кадра: %v, счетчики %+v", ok, stats)
+	}
+}
+
+// Без признака стабильности в кадре вес стабилен, если совпадает с предыдущим
+func TestReadWeightCustomStable(t *testing.T) {
+	p := loadCustomProtocol(t, `{"name": "Н", "end": "0D", "unit": "kg", "fields": {"weight": {"offset": 0, "length": 6}}}`)
+	d := &Device{Type: ScalesCustom, Custom: p}
+	transport := &echoTransport{}
+	if err := d.ConnectTransport(transport); err != nil {
+		t.Fatal(err)
+	}
+	transport.pending = []byte("01.250\r01.250\r01.300\r")
+	for i, want := range []bool{false, true, false} {
+		if _, err := d.Process(); err != nil {
+			t.Fatal(err)
+		}
+		if d.LastReading == nil || d.LastReading.Stable != want {
+			t.Errorf("кадр %d: показание %+v, стабильно нужно %v", i+1, d.LastReading, want)
+		}
+	}
+}
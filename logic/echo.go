@@ -0,0 +1,199 @@
+package logic
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Статистика echo теста: по ней видно, теряет ли кабель или адаптер байты целиком
+// (переполнение буфера, обрыв) или искажает отдельные биты (помехи, неверная скорость).
+
+// Сколько следующих байт должны совпасть, чтобы считать байт потерянным или лишним, а не искаженным
+const echoLookahead = 3
+
+// Статистика echo теста с момента подключения
+type EchoStats struct {
+	Rounds    int
+	Failed    int
+	Sent      int             // байт отправлено
+	Received  int             // байт принято
+	Corrupted int             // байт пришло с искажением
+	BitErrors int             // ошибочных бит в искаженных байтах
+	Lost      int             // байт не пришло
+	Extra     int             // лишних байт пришло
+	RTT       []time.Duration // время раундов, в которых пришли все байты
+	Busy      time.Duration   // общее время раундов
+	Line      string          // параметры COM порта, "" - не COM порт
+	LineRate  float64         // теоретическая скорость COM порта, байт в секунду
+	FirstDiff string          // первое расхождение: смещение и байты блока
+}
+
+// Результат сравнения отправленного и принятого блока
+type echoDiff struct {
+	corrupted, bitErrors, lost, extra int
+	first                             int // смещение первого расхождения, -1 - блоки совпали
+}
+
+// Сравнивает блоки. Потерянный или лишний байт сдвигает все следующие, поэтому при
+// расхождении сначала проверяется, не совпадает ли продолжение со сдвигом на байт
+func compareEcho(sent, received []byte) echoDiff {
+	d := echoDiff{first: -1}
+	i, j := 0, 0
+	for i < len(sent) && j < len(received) {
+		if sent[i] == received[j] {
+			i++
+			j++
+			continue
+		}
+		if d.first < 0 {
+			d.first = i
+		}
+		switch {
+		case echoMatches(sent[i+1:], received[j:]):
+			d.lost++
+			i++
+		case echoMatches(sent[i:], received[j+1:]):
+			d.extra++
+			j++
+		default:
+			d.corrupted++
+			d.bitErrors += bits.OnesCount8(sent[i] ^ received[j])
+			i++
+			j++
+		}
+	}
+	if (i < len(sent) || j < len(received)) && d.first < 0 {
+		d.first = i
+	}
+	d.lost += len(sent) - i
+	d.extra += len(received) - j
+	return d
+}
+
+// Начала блоков совпадают на echoLookahead байт или до конца более короткого
+func echoMatches(a, b []byte) bool {
+	n := min(echoLookahead, len(a), len(b))
+	if n == 0 {
+		return false
+	}
+	for k := 0; k < n; k++ {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Добавляет раунд и возвращает строку для вывода
+func (s *EchoStats) add(sent, received []byte, elapsed time.Duration) string {
+	s.Rounds++
+	s.Sent += len(sent)
+	s.Received += len(received)
+	s.Busy += elapsed
+
+	d := compareEcho(sent, received)
+	if d.first < 0 {
+		s.RTT = append(s.RTT, elapsed)
+		return fmt.Sprintf("PASS %d байт, RTT %s", len(sent), elapsed.Round(time.Millisecond))
+	}
+
+	s.Failed++
+	s.Corrupted += d.corrupted
+	s.BitErrors += d.bitErrors
+	s.Lost += d.lost
+	s.Extra += d.extra
+	if len(received) >= len(sent) {
+		s.RTT = append(s.RTT, elapsed)
+	}
+
+	line := fmt.Sprintf("FAIL принято %d из %d байт: потеряно %d, искажено %d (бит: %d), лишних %d, первое расхождение - байт %d",
+		len(received), len(sent), d.lost, d.corrupted, d.bitErrors, d.extra, d.first)
+	if s.FirstDiff == "" {
+		s.FirstDiff = fmt.Sprintf("раунд %d, байт %d:\n%s", s.Rounds, d.first, hexDiff(sent, received, d.first))
+		line += "\n" + hexDiff(sent, received, d.first)
+	}
+	return line
+}
+
+// Байты блока с расхождением по 16 в строке, две строки начиная с той, где первое расхождение.
+// Расходящиеся байты отмечены ^^, байты, которых нет, - как --
+func hexDiff(sent, received []byte, first int) string {
+	start := first &^ 15
+	end := min(start+32, max(len(sent), len(received)))
+	lines := []string{}
+	for row := start; row < end; row += 16 {
+		var a, b, marks strings.Builder
+		for k := row; k < row+16 && k < end; k++ {
+			a.WriteString(hexAt(sent, k) + " ")
+			b.WriteString(hexAt(received, k) + " ")
+			if k >= len(sent) || k >= len(received) || sent[k] != received[k] {
+				marks.WriteString("^^ ")
+			} else {
+				marks.WriteString("   ")
+			}
+		}
+		lines = append(lines,
+			fmt.Sprintf("  %04X отправлено: %s", row, strings.TrimSpace(a.String())),
+			fmt.Sprintf("       принято:    %s", strings.TrimSpace(b.String())),
+			strings.TrimRight("                   "+marks.String(), " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func hexAt(data []byte, i int) string {
+	if i >= len(data) {
+		return "--"
+	}
+	return fmt.Sprintf("%02X", data[i])
+}
+
+// Коэффициент битовых ошибок среди принятых байт
+func (s EchoStats) BER() float64 {
+	if s.Received == 0 {
+		return 0
+	}
+	return float64(s.BitErrors) / float64(s.Received*8)
+}
+
+// Итог для оператора
+func (s EchoStats) String() string {
+	if s.Rounds == 0 {
+		return "Раундов не было"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Раундов: %d, с ошибками: %d", s.Rounds, s.Failed),
+		fmt.Sprintf("Байт отправлено: %d, принято: %d", s.Sent, s.Received),
+		fmt.Sprintf("Потеряно байт: %d, лишних: %d, искажено: %d", s.Lost, s.Extra, s.Corrupted),
+		fmt.Sprintf("Ошибочных бит: %d из %d принятых, BER %.1e", s.BitErrors, s.Received*8, s.BER()),
+	}
+
+	if len(s.RTT) > 0 {
+		lines = append(lines, "RTT: "+durationStats(s.RTT)+", p99 "+percentile(s.RTT, 99).Round(time.Millisecond).String())
+	}
+
+	if s.Busy > 0 {
+		rate := float64(s.Received) / s.Busy.Seconds()
+		line := fmt.Sprintf("Скорость: %.0f байт/с", rate)
+		if s.LineRate > 0 {
+			line += fmt.Sprintf(", теоретическая при %s: %.0f байт/с (%.0f%%)", s.Line, s.LineRate, rate/s.LineRate*100)
+		}
+		lines = append(lines, line)
+	}
+
+	if s.FirstDiff != "" {
+		lines = append(lines, "Первое расхождение: "+s.FirstDiff)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Значение, которое не превышают p процентов значений
+func percentile(values []time.Duration, p int) time.Duration {
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
@@ -0,0 +1,76 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareEcho(t *testing.T) {
+	sent := []byte{0x10, 0x20, 0x30, 0x40, 0x50, 0x60}
+	tests := []struct {
+		name     string
+		received []byte
+		want     echoDiff
+	}{
+		{"совпали", []byte{0x10, 0x20, 0x30, 0x40, 0x50, 0x60}, echoDiff{first: -1}},
+		{"искажен бит", []byte{0x10, 0x21, 0x30, 0x40, 0x50, 0x60}, echoDiff{corrupted: 1, bitErrors: 1, first: 1}},
+		{"потерян байт", []byte{0x10, 0x20, 0x40, 0x50, 0x60}, echoDiff{lost: 1, first: 2}},
+		{"лишний байт", []byte{0x10, 0x20, 0xFF, 0x30, 0x40, 0x50, 0x60}, echoDiff{extra: 1, first: 2}},
+		{"лишний байт в конце", []byte{0x10, 0x20, 0x30, 0x40, 0x50, 0x60, 0x70}, echoDiff{extra: 1, first: 6}},
+		{"оборван хвост", []byte{0x10, 0x20, 0x30}, echoDiff{lost: 3, first: 3}},
+		{"ничего не пришло", nil, echoDiff{lost: 6, first: 0}},
+	}
+	for _, tt := range tests {
+		if got := compareEcho(sent, tt.received); got != tt.want {
+			t.Errorf("%s: compareEcho = %+v, нужно %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Отвечает на каждую запись тем же блоком и еще несколькими байтами
+type echoTransport struct {
+	extra   []byte
+	pending []byte
+}
+
+func (e *echoTransport) Read(b []byte) (int, error) {
+	n := copy(b, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+func (e *echoTransport) Write(b []byte) (int, error) {
+	e.pending = append(append(e.pending, b...), e.extra...)
+	return len(b), nil
+}
+
+func (e *echoTransport) SetReadTimeout(time.Duration) error    { return nil }
+func (e *echoTransport) SetDTR(bool) error                     { return nil }
+func (e *echoTransport) SetRTS(bool) error                     { return nil }
+func (e *echoTransport) GetModemStatus() (*ModemStatus, error) { return &ModemStatus{}, nil }
+func (e *echoTransport) Close() error                          { return nil }
+func (e *echoTransport) Name() string                          { return "echo" }
+
+func TestEchoTestExtraBytes(t *testing.T) {
+	d := &Device{Type: EchoTest}
+	transport := &echoTransport{extra: []byte{1, 2, 3}}
+	if err := d.ConnectTransport(transport); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		line, err := d.Process()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, "FAIL") {
+			t.Errorf("раунд %d: %s", i+1, line)
+		}
+	}
+	if d.Echo.Extra != 6 || d.Echo.Lost != 0 || d.Echo.Corrupted != 0 {
+		t.Errorf("лишних %d, потеряно %d, искажено %d, нужно 6, 0, 0", d.Echo.Extra, d.Echo.Lost, d.Echo.Corrupted)
+	}
+	if len(transport.pending) != 0 {
+		t.Errorf("в порту осталось %d байт", len(transport.pending))
+	}
+}
@@ -0,0 +1,314 @@
+package logic
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Эмуляторы передают вес в кг с двумя знаками после запятой (цена деления 10 г)
+const emulatorScale = 2
+
+// Вид сценария веса эмулятора
+type ProfileKind int
+
+const (
+	ProfileRandom   ProfileKind = iota // случайный вес, примерно каждое четвертое показание нестабильно
+	ProfileConstant                    // постоянный стабильный вес
+	ProfileRamp                        // груз ставят, вес нарастает и успокаивается, затем груз снимают
+	ProfileNoise                       // шум вокруг заданного веса
+	ProfileNegative                    // отрицательный вес
+	ProfileTare                        // вес с установленной тарой
+	ProfileOverload                    // перегрузка
+	ProfileZero                        // ноль
+	ProfileCSV                         // последовательность показаний из CSV файла
+)
+
+var profileKindNames = []string{"random", "constant", "ramp", "noise", "negative", "tare", "overload", "zero", "csv"}
+
+func (k ProfileKind) String() string {
+	return profileKindNames[k]
+}
+
+// Значения сценария по умолчанию
+const (
+	profileDefaultSteps = 5 // показаний нарастания веса
+)
+
+var (
+	profileDefaultWeight   = NewDecimal(125, emulatorScale)   // 1.25 кг
+	profileDefaultNoise    = NewDecimal(2, emulatorScale)     // 0.02 кг
+	profileDefaultOverload = NewDecimal(15000, emulatorScale) // 150 кг
+)
+
+// Одно показание эмулятора: вес брутто на платформе и его состояние
+type ProfileSample struct {
+	Weight   Decimal
+	Stable   bool
+	Overload bool
+}
+
+// Сценарий веса эмулятора. Нулевое значение - случайный вес
+type WeightProfile struct {
+	Kind    ProfileKind
+	Weight  Decimal         // вес груза
+	Steps   int             // ramp: за сколько показаний вес нарастает
+	Noise   Decimal         // noise: амплитуда шума
+	Tare    Decimal         // tare: масса тары
+	Path    string          // csv: файл
+	Samples []ProfileSample // csv: показания из файла
+}
+
+// Вес с количеством знаков эмулятора, лишние знаки округляются
+func emulatorDecimal(d Decimal) Decimal {
+	for d.Scale < emulatorScale {
+		d = NewDecimal(d.Value*10, d.Scale+1)
+	}
+	for d.Scale > emulatorScale {
+		half := int64(5)
+		if d.Value < 0 {
+			half = -5
+		}
+		d = NewDecimal((d.Value+half)/10, d.Scale-1)
+	}
+	return d
+}
+
+// Разбирает сценарий вида вид[:вес[:параметр]]:
+//
+//	random, constant:1.25, ramp:1.25:5, noise:1.25:0.02, negative:1.25,
+//	tare:1.25:0.3, overload[:150], zero, csv:weights.csv
+//
+// Для ramp параметр - количество показаний нарастания, для noise - амплитуда шума, для tare - тара.
+func ParseWeightProfile(s string) (WeightProfile, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	kind := -1
+	for i, name := range profileKindNames {
+		if strings.EqualFold(name, parts[0]) {
+			kind = i
+		}
+	}
+	if kind < 0 {
+		return WeightProfile{}, fmt.Errorf("неизвестный сценарий %q, доступны: %s", parts[0], strings.Join(profileKindNames, ", "))
+	}
+
+	p := WeightProfile{Kind: ProfileKind(kind), Weight: profileDefaultWeight, Steps: profileDefaultSteps, Noise: profileDefaultNoise}
+	if p.Kind == ProfileOverload {
+		p.Weight = profileDefaultOverload
+	}
+
+	if p.Kind == ProfileCSV {
+		if len(parts) < 2 || parts[1] == "" {
+			return p, fmt.Errorf("не указан CSV файл: csv:файл")
+		}
+		// Путь в Windows сам содержит двоеточие
+		p.Path = strings.Join(parts[1:], ":")
+		var err error
+		if p.Samples, err = loadProfileCSV(p.Path); err != nil {
+			return p, err
+		}
+		return p, nil
+	}
+
+	maxParts := map[ProfileKind]int{ProfileRandom: 1, ProfileZero: 1, ProfileConstant: 2, ProfileNegative: 2, ProfileOverload: 2}[p.Kind]
+	if maxParts == 0 {
+		maxParts = 3
+	}
+	if len(parts) > maxParts {
+		return p, fmt.Errorf("лишние параметры сценария %s: %q", p.Kind, s)
+	}
+
+	if len(parts) > 1 {
+		weight, err := ParseDecimal(parts[1])
+		if err != nil || weight.Value < 0 {
+			return p, fmt.Errorf("неверный вес сценария %q", parts[1])
+		}
+		p.Weight = emulatorDecimal(weight)
+	}
+	if len(parts) > 2 {
+		switch p.Kind {
+		case ProfileRamp:
+			steps, err := strconv.Atoi(parts[2])
+			if err != nil || steps < 1 {
+				return p, fmt.Errorf("неверное количество показаний нарастания %q", parts[2])
+			}
+			p.Steps = steps
+		case ProfileNoise, ProfileTare:
+			value, err := ParseDecimal(parts[2])
+			if err != nil || value.Value < 0 {
+				return p, fmt.Errorf("неверное значение %q", parts[2])
+			}
+			if p.Kind == ProfileNoise {
+				p.Noise = emulatorDecimal(value)
+			} else {
+				p.Tare = emulatorDecimal(value)
+			}
+		}
+	}
+	if p.Kind == ProfileTare && len(parts) < 3 {
+		return p, fmt.Errorf("не указана тара: tare:вес:тара")
+	}
+	return p, nil
+}
+
+// Обратно в строку для ParseWeightProfile
+func (p WeightProfile) String() string {
+	switch p.Kind {
+	case ProfileRandom, ProfileZero:
+		return p.Kind.String()
+	case ProfileRamp:
+		return fmt.Sprintf("%s:%s:%d", p.Kind, p.Weight, p.Steps)
+	case ProfileNoise:
+		return fmt.Sprintf("%s:%s:%s", p.Kind, p.Weight, p.Noise)
+	case ProfileTare:
+		return fmt.Sprintf("%s:%s:%s", p.Kind, p.Weight, p.Tare)
+	case ProfileCSV:
+		return fmt.Sprintf("%s:%s", p.Kind, p.Path)
+	}
+	return fmt.Sprintf("%s:%s", p.Kind, p.Weight)
+}
+
+// Читает показания из CSV: вес и, необязательно, состояние S (стабильно), U (нестабильно) или OL (перегрузка).
+// Разделитель - запятая или точка с запятой, строки с # и строка заголовка пропускаются.
+//
+//	вес;состояние
+//	0;S
+//	0,8;U
+//	1,25;S
+func loadProfileCSV(path string) ([]ProfileSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples := []ProfileSample{}
+	sep := ""
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// Разделитель - по первой строке. С точкой с запятой в весе может быть десятичная запятая
+		if sep == "" {
+			sep = ","
+			if strings.Contains(text, ";") {
+				sep = ";"
+			}
+		}
+		fields := strings.Split(text, sep)
+
+		weight, err := ParseDecimal(fields[0])
+		if err != nil {
+			if len(samples) == 0 {
+				// Заголовок
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: неверный вес %q", path, line, fields[0])
+		}
+
+		s := ProfileSample{Weight: emulatorDecimal(weight), Stable: true}
+		if len(fields) > 1 {
+			switch strings.ToUpper(strings.TrimSpace(fields[1])) {
+			case "", "S":
+			case "U":
+				s.Stable = false
+			case "OL":
+				s.Overload = true
+			default:
+				return nil, fmt.Errorf("%s:%d: неверное состояние %q, нужно S, U или OL", path, line, fields[1])
+			}
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%s: нет показаний", path)
+	}
+	return samples, nil
+}
+
+// Состояние эмулятора весов между вызовами Process: сценарий веса, ноль и тара,
+// установленные командами, и режим непрерывной передачи.
+type emulator struct {
+	rand    *rand.Rand
+	profile WeightProfile
+	step    int           // номер показания в сценарии
+	current ProfileSample // последнее показание, на него ставятся ноль и тара
+	zero    Decimal       // вес, принятый за ноль командой установки нуля
+	tare    Decimal       // масса тары
+	stream  bool          // непрерывная передача включена командой
+}
+
+func newEmulator(profile WeightProfile) *emulator {
+	e := &emulator{rand: rand.New(rand.NewSource(time.Now().UnixNano())), profile: profile}
+	e.reset()
+	return e
+}
+
+// Начальное состояние, как после включения весов
+func (e *emulator) reset() {
+	*e = emulator{rand: e.rand, profile: e.profile}
+	if e.profile.Kind == ProfileTare {
+		e.tare = e.profile.Tare
+	}
+}
+
+// Следующее показание сценария
+func (e *emulator) next() ProfileSample {
+	p := e.profile
+	s := ProfileSample{Weight: p.Weight, Stable: true}
+
+	switch p.Kind {
+	case ProfileRandom:
+		s.Weight = NewDecimal(int64(e.rand.Intn(10000)), emulatorScale)
+		s.Stable = e.rand.Intn(4) != 0
+	case ProfileRamp:
+		// Нарастание за Steps показаний с перелетом в конце, вес держится 2*Steps показаний,
+		// груз снимают и платформа пуста еще 2*Steps показаний
+		i := e.step % (p.Steps * 5)
+		switch {
+		case i < p.Steps-1:
+			s.Weight = NewDecimal(p.Weight.Value*int64(i+1)/int64(p.Steps), emulatorScale)
+			s.Stable = false
+		case i == p.Steps-1:
+			s.Weight = NewDecimal(p.Weight.Value+p.Weight.Value/20, emulatorScale)
+			s.Stable = false
+		case i < p.Steps*3:
+		default:
+			s.Weight = NewDecimal(0, emulatorScale)
+			s.Stable = i != p.Steps*3
+		}
+	case ProfileNoise:
+		// Вес стабилен, пока отклонение не больше трети амплитуды
+		amplitude := p.Noise.Value
+		deviation := e.rand.Int63n(2*amplitude+1) - amplitude
+		s.Weight = NewDecimal(p.Weight.Value+deviation, emulatorScale)
+		s.Stable = abs(deviation)*3 <= amplitude
+	case ProfileNegative:
+		s.Weight = NewDecimal(-p.Weight.Value, emulatorScale)
+	case ProfileOverload:
+		s.Overload = true
+	case ProfileZero:
+		s.Weight = NewDecimal(0, emulatorScale)
+	case ProfileCSV:
+		s = p.Samples[e.step%len(p.Samples)]
+	}
+
+	e.step++
+	e.current = s
+	return s
+}
+
+// Вес нетто с учетом нуля и тары
+func (e *emulator) net(gross Decimal) Decimal {
+	return NewDecimal(gross.Value-e.zero.Value-e.tare.Value, emulatorScale)
+}
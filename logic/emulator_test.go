@@ -0,0 +1,95 @@
+package logic
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Один конец канала между эмулятором и устройством чтения в памяти
+type pipeEnd struct {
+	mu      *sync.Mutex
+	in, out *[]byte
+	timeout time.Duration
+}
+
+func (p *pipeEnd) Read(b []byte) (int, error) {
+	deadline := time.Now().Add(p.timeout)
+	for {
+		p.mu.Lock()
+		n := copy(b, *p.in)
+		*p.in = (*p.in)[n:]
+		p.mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			return n, nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (p *pipeEnd) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	*p.out = append(*p.out, b...)
+	p.mu.Unlock()
+	return len(b), nil
+}
+
+func (p *pipeEnd) SetReadTimeout(t time.Duration) error  { p.timeout = t; return nil }
+func (p *pipeEnd) SetDTR(bool) error                     { return nil }
+func (p *pipeEnd) SetRTS(bool) error                     { return nil }
+func (p *pipeEnd) GetModemStatus() (*ModemStatus, error) { return &ModemStatus{}, nil }
+func (p *pipeEnd) Close() error                          { return nil }
+func (p *pipeEnd) Name() string                          { return "pipe" }
+
+// Подключает устройство чтения к эмулятору с постоянным весом. Эмулятор отвечает
+// в отдельной горутине до конца теста
+func emulatorPair(t *testing.T, emulator, reader DeviceType, weight Decimal) *Device {
+	t.Helper()
+	var mu sync.Mutex
+	var toEmu, toReader []byte
+
+	emu := &Device{Type: emulator, Profile: WeightProfile{Kind: ProfileConstant, Weight: weight}}
+	settings := DefaultSerialSettings(emulator)
+	settings.ReadTimeout = 10 * time.Millisecond
+	emu.SetSerialSettings(settings)
+	if err := emu.ConnectTransport(&pipeEnd{mu: &mu, in: &toEmu, out: &toReader}); err != nil {
+		t.Fatal(err)
+	}
+	rd := &Device{Type: reader}
+	if err := rd.ConnectTransport(&pipeEnd{mu: &mu, in: &toReader, out: &toEmu}); err != nil {
+		t.Fatal(err)
+	}
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			emu.Process()
+		}
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+	return rd
+}
+
+// Читает показания, пока не придет вес
+func readWeight(t *testing.T, d *Device) Reading {
+	t.Helper()
+	for i := 0; i < 5; i++ {
+		if _, err := d.Process(); err != nil {
+			t.Fatal(err)
+		}
+		if d.LastReading != nil {
+			return *d.LastReading
+		}
+	}
+	t.Fatal("нет показания весов")
+	return Reading{}
+}
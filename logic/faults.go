@@ -0,0 +1,248 @@
+package logic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ошибки, которые эмуляторы весов вносят в передаваемые кадры, чтобы проверить,
+// как кассовое ПО справляется с плохой линией. Для каждой ошибки задается вероятность
+// в процентах, ошибки разыгрываются для каждого кадра независимо.
+
+// Задержка ответа по умолчанию: больше таймаута чтения по умолчанию
+const faultDefaultDelay = 2 * time.Second
+
+// Виды ошибок
+type Fault int
+
+const (
+	FaultDrop      Fault = iota // кадр не передается
+	FaultDelay                  // кадр передается с задержкой
+	FaultNoise                  // перед кадром случайные байты
+	FaultTruncate               // передается только начало кадра
+	FaultCorrupt                // в кадре искажен бит
+	FaultChecksum               // неверная контрольная сумма
+	FaultDuplicate              // кадр передается дважды
+	faultCount
+)
+
+var faultNames = [faultCount]string{"drop", "delay", "noise", "truncate", "corrupt", "checksum", "duplicate"}
+
+var faultTitles = [faultCount]string{
+	"пропуск кадра",
+	"задержка ответа",
+	"шум в линии",
+	"обрезанный кадр",
+	"искаженный байт",
+	"неверная КС",
+	"повтор кадра",
+}
+
+// Имя для командной строки: drop, delay, ...
+func (f Fault) String() string {
+	return faultNames[f]
+}
+
+// Название для вывода
+func (f Fault) Title() string {
+	return faultTitles[f]
+}
+
+// Все виды ошибок по порядку
+func Faults() []Fault {
+	res := make([]Fault, faultCount)
+	for i := range res {
+		res[i] = Fault(i)
+	}
+	return res
+}
+
+// Вероятности ошибок эмулятора. Нулевое значение - без ошибок
+type FaultSettings struct {
+	Percent [faultCount]float64 // вероятность каждой ошибки, %
+	Delay   time.Duration       // задержка ответа, 0 - по умолчанию
+}
+
+// Есть ли хоть одна ошибка с ненулевой вероятностью
+func (s FaultSettings) Enabled() bool {
+	for _, p := range s.Percent {
+		if p > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Задержка ответа с учетом значения по умолчанию
+func (s FaultSettings) DelayTime() time.Duration {
+	if s.Delay > 0 {
+		return s.Delay
+	}
+	return faultDefaultDelay
+}
+
+// Кратко: "drop=10%, delay=5% (2s)" или "нет"
+func (s FaultSettings) String() string {
+	parts := []string{}
+	for _, f := range Faults() {
+		if s.Percent[f] > 0 {
+			part := fmt.Sprintf("%s=%s%%", f, strconv.FormatFloat(s.Percent[f], 'f', -1, 64))
+			if f == FaultDelay {
+				part += fmt.Sprintf(" (%s)", s.DelayTime())
+			}
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "нет"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Задает вероятность ошибки по имени в процентах ("10" или "10%"), или время задержки: delaytime=3s
+func (s *FaultSettings) Set(name, value string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	value = strings.TrimSpace(value)
+
+	if name == "delaytime" {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay <= 0 {
+			return fmt.Errorf("неверное время задержки %q", value)
+		}
+		s.Delay = delay
+		return nil
+	}
+
+	for _, f := range Faults() {
+		if f.String() != name {
+			continue
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return fmt.Errorf("неверная вероятность %s %q, нужно от 0 до 100%%", name, value)
+		}
+		s.Percent[f] = percent
+		return nil
+	}
+	return fmt.Errorf("неизвестная ошибка %q, доступны: %s, delaytime", name, strings.Join(faultNames[:], ", "))
+}
+
+// Разбирает список вида "drop=10,corrupt=5%,delay=10,delaytime=3s"
+func ParseFaultSettings(s string) (FaultSettings, error) {
+	res := FaultSettings{}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return res, fmt.Errorf("неверный параметр %q, нужно имя=значение", item)
+		}
+		if err := res.Set(name, value); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Счетчики внесенных эмулятором ошибок
+type FaultStats struct {
+	Frames   int             // кадров, которые эмулятор собирался передать
+	Injected [faultCount]int // внесено ошибок каждого вида
+}
+
+// Всего внесено ошибок
+func (s FaultStats) Total() int {
+	total := 0
+	for _, n := range s.Injected {
+		total += n
+	}
+	return total
+}
+
+// Итог: "кадров: 100, ошибок: 12 (пропуск кадра: 7, повтор кадра: 5)"
+func (s FaultStats) String() string {
+	parts := []string{}
+	for _, f := range Faults() {
+		if s.Injected[f] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", f.Title(), s.Injected[f]))
+		}
+	}
+	res := fmt.Sprintf("кадров: %d, внесено ошибок: %d", s.Frames, s.Total())
+	if len(parts) > 0 {
+		res += " (" + strings.Join(parts, ", ") + ")"
+	}
+	return res
+}
+
+// Разыгрывает ошибку с ее вероятностью
+func (e *emulator) fault(s FaultSettings, f Fault) bool {
+	return s.Percent[f] > 0 && e.rand.Float64()*100 < s.Percent[f]
+}
+
+// Передает кадр эмулятора, внося ошибки по настройкам. checksum - позиция байта контрольной
+// суммы в кадре, -1 если ее нет. Возвращает описание внесенных ошибок для вывода: " [пропуск кадра]"
+func (d *Device) emulatorWrite(frame []byte, checksum int) (string, error) {
+	d.FaultStats.Frames++
+	s := d.Faults
+	if !s.Enabled() {
+		return "", d.emulatorSend(frame)
+	}
+
+	injected := []string{}
+	inject := func(f Fault) bool {
+		if !d.emu.fault(s, f) {
+			return false
+		}
+		d.FaultStats.Injected[f]++
+		injected = append(injected, f.Title())
+		return true
+	}
+	note := func() string {
+		if len(injected) == 0 {
+			return ""
+		}
+		return " [" + strings.Join(injected, ", ") + "]"
+	}
+
+	if inject(FaultDrop) {
+		return note(), nil
+	}
+	if inject(FaultDelay) {
+		time.Sleep(s.DelayTime())
+	}
+
+	out := []byte{}
+	if inject(FaultNoise) {
+		noise := make([]byte, 1+d.emu.rand.Intn(8))
+		d.emu.rand.Read(noise)
+		out = append(out, noise...)
+	}
+
+	frame = append([]byte(nil), frame...)
+	if checksum >= 0 && checksum < len(frame) && inject(FaultChecksum) {
+		frame[checksum] ^= byte(1 + d.emu.rand.Intn(255))
+	}
+	if inject(FaultCorrupt) {
+		frame[d.emu.rand.Intn(len(frame))] ^= 1 << d.emu.rand.Intn(8)
+	}
+	if len(frame) > 1 && inject(FaultTruncate) {
+		frame = frame[:1+d.emu.rand.Intn(len(frame)-1)]
+	}
+	out = append(out, frame...)
+	if inject(FaultDuplicate) {
+		out = append(out, frame...)
+	}
+
+	return note(), d.emulatorSend(out)
+}
+
+func (d *Device) emulatorSend(data []byte) error {
+	if _, err := d.transport.Write(data); err != nil {
+		d.LastError = err.Error()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseFaultSettings(t *testing.T) {
+	s, err := ParseFaultSettings("drop=10, corrupt=2.5%,delay=5,delaytime=3s,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "drop=10%, delay=5% (3s), corrupt=2.5%"; s.String() != want {
+		t.Errorf("String() = %q, нужно %q", s, want)
+	}
+	if !s.Enabled() || (FaultSettings{}).Enabled() || (FaultSettings{}).String() != "нет" {
+		t.Error("Enabled")
+	}
+
+	for _, text := range []string{"drop", "drop=101", "drop=-1", "drop=много", "delaytime=0", "jitter=5"} {
+		if _, err := ParseFaultSettings(text); err == nil {
+			t.Errorf("%q: нет ошибки", text)
+		}
+	}
+}
+
+// Эмулятор, который передает кадры в echoTransport, с ошибками по настройкам
+func faultDevice(t *testing.T, settings string) (*Device, *echoTransport) {
+	t.Helper()
+	s, err := ParseFaultSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Device{Type: EmulatorToledo8142, Faults: s}
+	transport := &echoTransport{}
+	if err := d.ConnectTransport(transport); err != nil {
+		t.Fatal(err)
+	}
+	return d, transport
+}
+
+// Портится только байт контрольной суммы, и разбор кадров считает его ошибкой КС
+func TestEmulatorWriteChecksum(t *testing.T) {
+	d, transport := faultDevice(t, "checksum=100")
+	frame := toledo8142Frame(NewDecimal(125, 2), Decimal{}, true, false)
+	sum := len(frame) - 1
+
+	for i := 0; i < 100; i++ {
+		transport.pending = nil
+		note, err := d.emulatorWrite(frame, sum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := transport.pending
+		if note != " [неверная КС]" || len(got) != len(frame) || !bytes.Equal(got[:sum], frame[:sum]) || got[sum] == frame[sum] {
+			t.Fatalf("передано %q%s, кадр %q", got, note, frame)
+		}
+		if got[sum] == toledoSTX {
+			// Такая КС неотличима от начала следующего кадра
+			continue
+		}
+		var stats FrameStats
+		if _, _, ok := nextToledo8142Frame(got, &stats); ok || stats.ChecksumErrors != 1 {
+			t.Fatalf("%q: кадр принят, счетчики %+v", got, stats)
+		}
+	}
+	if d.FaultStats.Frames != 100 || d.FaultStats.Injected[FaultChecksum] != 100 || d.FaultStats.Total() != 100 {
+		t.Errorf("счетчики %s", d.FaultStats)
+	}
+
+	// Кадр без контрольной суммы передается как есть
+	transport.pending = nil
+	if note, _ := d.emulatorWrite(frame, -1); note != "" || !bytes.Equal(transport.pending, frame) {
+		t.Errorf("без КС передано %q%s", transport.pending, note)
+	}
+}
+
+func TestEmulatorWriteFaults(t *testing.T) {
+	frame := []byte("\x02+0012342" + "1D\x03")
+	tests := []struct {
+		settings string
+		check    func(got []byte) bool
+	}{
+		{"drop=100", func(got []byte) bool { return len(got) == 0 }},
+		{"duplicate=100", func(got []byte) bool { return bytes.Equal(got, append(append([]byte(nil), frame...), frame...)) }},
+		{"truncate=100", func(got []byte) bool { return len(got) < len(frame) && bytes.HasPrefix(frame, got) }},
+		{"noise=100", func(got []byte) bool { return len(got) > len(frame) && bytes.HasSuffix(got, frame) }},
+		{"corrupt=100", func(got []byte) bool { return len(got) == len(frame) && !bytes.Equal(got, frame) }},
+	}
+	for _, tt := range tests {
+		d, transport := faultDevice(t, tt.settings)
+		note, err := d.emulatorWrite(frame, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, _, _ := strings.Cut(tt.settings, "=")
+		if !tt.check(transport.pending) || d.FaultStats.Total() != 1 {
+			t.Errorf("%s: передано %q%s, %s", name, transport.pending, note, d.FaultStats)
+		}
+	}
+	if frame[0] != 0x02 || frame[len(frame)-1] != 0x03 {
+		t.Error("исходный кадр изменен")
+	}
+}
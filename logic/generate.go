@@ -0,0 +1,308 @@
+package logic
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/code39"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+	"github.com/boombuler/barcode/twooffive"
+)
+
+// Генерация штрихкодов для печати: отдельные файлы PNG и SVG или HTML страница
+// с тестовым листом, который затем проверяется в режиме "Проверка по тестовому листу".
+//
+// Разделитель GS в кодах GS1 кодируется как FNC1, сканер передает его как GS (0x1D).
+
+// Типы штрихкодов, которые можно сгенерировать
+var GenerateSymbologies = []string{
+	"EAN-13", "EAN-8", "UPC-A", "ITF-14", "Code 39", "Code 128", "GS1-128", "QR", "DataMatrix", "GS1 DataMatrix",
+}
+
+// Размер модуля при печати SVG и HTML, мм: стандартный для EAN и заметно крупнее для 2D
+const (
+	moduleMM1D = 0.33
+	moduleMM2D = 0.5
+	barHeight  = 60 // высота штрихов линейного кода в модулях, около 20 мм
+)
+
+// Строит штрихкод. data - как его должен передать сканер, с GS между элементами GS1
+func EncodeBarcode(symbology, data string) (barcode.Barcode, error) {
+	switch symbology {
+	case "EAN-13", "EAN-8", "UPC-A", "ITF-14":
+		b := Barcode{Data: data, Symbology: symbology}
+		b.validate()
+		if !b.Passed() {
+			return nil, fmt.Errorf("%s %s: %s", symbology, data, strings.Join(b.Problems, "; "))
+		}
+	}
+
+	gs := string(rune(gs1GS))
+	data = strings.TrimPrefix(data, gs)
+	var code barcode.Barcode
+	var err error
+	switch symbology {
+	case "EAN-13", "EAN-8":
+		code, err = ean.Encode(data)
+	case "UPC-A":
+		// UPC-A - это EAN-13 с нулем в начале
+		code, err = ean.Encode("0" + data)
+	case "ITF-14":
+		code, err = twooffive.Encode(data, true)
+	case "Code 39":
+		code, err = code39.Encode(data, false, false)
+	case "Code 128":
+		code, err = code128.Encode(data)
+	case "GS1-128":
+		fnc1 := string(code128.FNC1)
+		code, err = code128.Encode(fnc1 + strings.ReplaceAll(data, gs, fnc1))
+	case "QR":
+		code, err = qr.Encode(data, qr.M, qr.Auto)
+	case "DataMatrix":
+		code, err = datamatrix.Encode(data)
+	case "GS1 DataMatrix":
+		fnc1 := string([]byte{datamatrix.FNC1})
+		code, err = datamatrix.Encode(fnc1 + strings.ReplaceAll(data, gs, fnc1))
+	default:
+		return nil, fmt.Errorf("генерация %q не поддерживается, доступны: %s", symbology, strings.Join(GenerateSymbologies, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось построить %s %s: %w", symbology, VisibleBytes([]byte(data)), err)
+	}
+	return code, nil
+}
+
+// Тип для генерации штрихкода из листа без указанного типа: по содержимому, иначе Code 128
+func (e SheetEntry) generateSymbology() string {
+	if e.Symbology != "" {
+		return e.Symbology
+	}
+	switch s := guessSymbology(e.Data); s {
+	case "EAN-13", "EAN-8", "UPC-A", "ITF-14", "GS1 DataMatrix":
+		return s
+	}
+	return "Code 128"
+}
+
+// Штрихкод строки тестового листа
+func (e SheetEntry) Encode() (barcode.Barcode, error) {
+	code, err := EncodeBarcode(e.generateSymbology(), e.Data)
+	if err != nil {
+		return nil, fmt.Errorf("строка %d: %w", e.Line, err)
+	}
+	return code, nil
+}
+
+// Модули штрихкода: true - темный. У линейного кода одна строка
+func modules(code barcode.Barcode) [][]bool {
+	bounds := code.Bounds()
+	rows := [][]bool{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := []bool{}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.GrayModel.Convert(code.At(x, y)).(color.Gray)
+			row = append(row, gray.Y < 0x80)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Тихая зона вокруг штрихкода в модулях
+func quietZone(code barcode.Barcode) int {
+	switch code.Metadata().Dimensions {
+	case 1:
+		return 10
+	}
+	if code.Metadata().CodeKind == "QR Code" {
+		return 4
+	}
+	return 2
+}
+
+// Записывает штрихкод в PNG, scale - точек на модуль
+func WriteBarcodePNG(w io.Writer, code barcode.Barcode, scale int) error {
+	rows := modules(code)
+	quiet := quietZone(code)
+	height := len(rows)
+	if code.Metadata().Dimensions == 1 {
+		height = barHeight
+	}
+
+	img := image.NewGray(image.Rect(0, 0, (len(rows[0])+2*quiet)*scale, (height+2*quiet)*scale))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < height; y++ {
+		row := rows[min(y, len(rows)-1)]
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+quiet)*scale+dx, (y+quiet)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// Штрихкод в SVG с размером для печати в миллиметрах
+func barcodeSVG(code barcode.Barcode) string {
+	rows := modules(code)
+	quiet := quietZone(code)
+	height, rowHeight, module := len(rows), 1, moduleMM2D
+	if code.Metadata().Dimensions == 1 {
+		height, rowHeight, module = barHeight, barHeight, moduleMM1D
+	}
+	width := len(rows[0]) + 2*quiet
+	height += 2 * quiet
+
+	var res strings.Builder
+	fmt.Fprintf(&res, `<svg xmlns="http://www.w3.org/2000/svg" width="%.2fmm" height="%.2fmm" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		float64(width)*module, float64(height)*module, width, height)
+	fmt.Fprintf(&res, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, width, height)
+	// Подряд идущие темные модули строки - один прямоугольник
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&res, "M%d %dh%dv%dh-%dz", start+quiet, y+quiet, x-start, rowHeight, x-start)
+		}
+	}
+	res.WriteString(`"/></svg>`)
+	return res.String()
+}
+
+// Записывает штрихкод в SVG
+func WriteBarcodeSVG(w io.Writer, code barcode.Barcode) error {
+	_, err := io.WriteString(w, barcodeSVG(code)+"\n")
+	return err
+}
+
+// Записывает штрихкод в файл, формат - по расширению: .png или .svg
+func WriteBarcodeFile(path string, code barcode.Barcode, scale int) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".png" && ext != ".svg" {
+		return fmt.Errorf("неизвестный формат %q, нужен .png или .svg", path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if ext == ".png" {
+		err = WriteBarcodePNG(f, code, scale)
+	} else {
+		err = WriteBarcodeSVG(f, code)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Записывает тестовый лист HTML страницей для печати: штрихкод и подпись с номером строки файла
+func WriteTestSheetHTML(w io.Writer, sheet *TestSheet) error {
+	var res strings.Builder
+	res.WriteString(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Тестовый лист</title>
+<style>
+body { font-family: sans-serif; margin: 10mm; }
+h1 { font-size: 14pt; }
+.codes { display: flex; flex-wrap: wrap; gap: 8mm; }
+figure { margin: 0; break-inside: avoid; }
+figcaption { font-size: 8pt; max-width: 70mm; word-break: break-all; }
+</style>
+</head>
+<body>
+`)
+	fmt.Fprintf(&res, "<h1>Тестовый лист %s, %s</h1>\n<div class=\"codes\">\n",
+		html.EscapeString(sheet.Path), time.Now().Format("02.01.2006"))
+	for _, e := range sheet.Entries {
+		code, err := e.Encode()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&res, "<figure>%s<figcaption>%d. %s (%s)</figcaption></figure>\n",
+			barcodeSVG(code), e.Line, html.EscapeString(e.Text), e.generateSymbology())
+	}
+	res.WriteString("</div>\n</body>\n</html>\n")
+
+	_, err := io.WriteString(w, res.String())
+	return err
+}
+
+// Записывает список штрихкодов листа в формате файла тестового листа
+func (s *TestSheet) Write(w io.Writer) error {
+	var res strings.Builder
+	res.WriteString("# код;тип\n")
+	for _, e := range s.Entries {
+		res.WriteString(e.Text + ";" + e.generateSymbology() + "\n")
+	}
+	_, err := io.WriteString(w, res.String())
+	return err
+}
+
+// Тестовый лист по умолчанию: по штрихкоду каждого частого типа и код маркировки Честный знак
+func DefaultTestSheet() *TestSheet {
+	codes := []struct{ text, symbology string }{
+		{"4601234567893", "EAN-13"},
+		{"46012340", "EAN-8"},
+		{"2212345012343", "EAN-13"}, // весовой: товар 12345, вес 1.234
+		{"TEST-128 sak", "Code 128"},
+		{"(01)04601234567893(10)ABC123(17)271231", "GS1-128"},
+		{"https://example.com/sak?test=1", "QR"},
+		{MarkingCode(), "GS1 DataMatrix"},
+	}
+
+	sheet := &TestSheet{Path: "по умолчанию"}
+	for i, c := range codes {
+		e, _ := NewSheetEntry(c.text, c.symbology)
+		e.Line = i + 1
+		sheet.Entries = append(sheet.Entries, e)
+	}
+	return sheet
+}
+
+// Синтетический код маркировки Честный знак в читаемом виде: GTIN, серийный номер из 13 символов,
+// ключ проверки (91) и код проверки (92). Криптохвост случайный, касса его не примет,
+// но сканер и разбор кода проверяются как на настоящем
+func MarkingCode() string {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random := func(n int, charset string) string {
+		res := make([]byte, n)
+		for i := range res {
+			res[i] = charset[r.Intn(len(charset))]
+		}
+		return string(res)
+	}
+
+	const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	gtin := "0460" + random(9, "0123456789")
+	gtin += string(gs1CheckDigit(gtin))
+	return "(01)" + gtin + "(21)" + random(13, alphanumeric) +
+		"(91)" + random(4, alphanumeric) + "(92)" + random(43, alphanumeric+"+/") + "="
+}
@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/datamatrix"
+)
+
+func TestEncodeDefaultTestSheet(t *testing.T) {
+	for _, e := range DefaultTestSheet().Entries {
+		if _, err := e.Encode(); err != nil {
+			t.Errorf("%s: %v", e.Text, err)
+		}
+	}
+}
+
+func TestEncodeBarcodeErrors(t *testing.T) {
+	tests := []struct{ symbology, data string }{
+		{"EAN-13", "4601234567890"}, // неверная контрольная цифра
+		{"EAN-8", "4601234"},
+		{"PDF417", "TEST"},
+	}
+	for _, tt := range tests {
+		if _, err := EncodeBarcode(tt.symbology, tt.data); err == nil {
+			t.Errorf("%s %s: нет ошибки", tt.symbology, tt.data)
+		}
+	}
+}
+
+// GS между элементами кодируется как FNC1, и FNC1 стоит в начале
+func TestEncodeBarcodeFNC1(t *testing.T) {
+	const data = "0104601234567893" + "21ABC" + "\x1d" + "17271231"
+	tests := []struct {
+		symbology string
+		fnc1      string
+	}{
+		{"GS1-128", string(code128.FNC1)},
+		{"GS1 DataMatrix", string([]byte{datamatrix.FNC1})},
+	}
+	for _, tt := range tests {
+		for _, in := range []string{data, "\x1d" + data} {
+			code, err := EncodeBarcode(tt.symbology, in)
+			if err != nil {
+				t.Errorf("%s: %v", tt.symbology, err)
+				continue
+			}
+			want := tt.fnc1 + strings.ReplaceAll(data, "\x1d", tt.fnc1)
+			if got := code.Content(); got != want {
+				t.Errorf("%s %q: закодировано %q, нужно %q", tt.symbology, in, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteBarcode(t *testing.T) {
+	for _, tt := range []struct{ symbology, data string }{
+		{"EAN-13", "4601234567893"},
+		{"QR", "https://example.com"},
+		{"DataMatrix", "TEST"},
+	} {
+		code, err := EncodeBarcode(tt.symbology, tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		quiet := quietZone(code)
+		if quiet == 0 {
+			t.Errorf("%s: нет тихой зоны", tt.symbology)
+		}
+
+		var svg bytes.Buffer
+		if err := WriteBarcodeSVG(&svg, code); err != nil {
+			t.Fatal(err)
+		}
+		// Первый темный модуль - после тихой зоны
+		if !strings.HasPrefix(svg.String(), "<svg") || !strings.Contains(svg.String(), fmt.Sprintf(`d="M%d %dh`, quiet, quiet)) {
+			t.Errorf("%s: SVG без тихой зоны %d:\n%s", tt.symbology, quiet, svg.String())
+		}
+
+		var buf bytes.Buffer
+		const scale = 2
+		if err := WriteBarcodePNG(&buf, code, scale); err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bounds := img.Bounds()
+		if bounds.Dx() != (code.Bounds().Dx()+2*quiet)*scale {
+			t.Errorf("%s: ширина PNG %d", tt.symbology, bounds.Dx())
+		}
+		// Рамка шириной в тихую зону белая
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				if x >= quiet*scale && x < bounds.Max.X-quiet*scale && y >= quiet*scale && y < bounds.Max.Y-quiet*scale {
+					continue
+				}
+				if r, _, _, _ := img.At(x, y).RGBA(); r != 0xFFFF {
+					t.Fatalf("%s: темная точка в тихой зоне (%d, %d)", tt.symbology, x, y)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package logic
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Разбор кодов GS1 (GS1 DataMatrix, GS1-128, GS1 QR) и кодов маркировки Честный знак.
+//
+// Код состоит из элементов: идентификатор применения (AI, 2-4 цифры) и значение.
+// После значения переменной длины, если за ним есть еще элементы, идет разделитель
+// GS (0x1D). Код маркировки Честный знак, например:
+//
+//	01 04601234567893 21 ABCDEFGHIJKLM <GS> 91 EE06 <GS> 92 <44 символа>
+//	01 04601234567893 21 ABCDEF <GS> 93 dGVz
+//
+// Сканеры часто теряют GS (в режиме клавиатуры или при неверной настройке), и тогда
+// серийный номер "съедает" криптохвост, а касса не может проверить код.
+
+// Элемент кода GS1
+type GS1Element struct {
+	AI    string
+	Value string
+}
+
+// Описание идентификатора применения
+type gs1AI struct {
+	prefix   string // начало идентификатора
+	length   int    // длина идентификатора
+	min, max int    // длина значения
+	numeric  bool   // только цифры
+	title    string
+}
+
+// Известные идентификаторы. Более длинные префиксы проверяются первыми
+var gs1AIs = []gs1AI{
+	{"00", 2, 18, 18, true, "SSCC"},
+	{"01", 2, 14, 14, true, "GTIN"},
+	{"02", 2, 14, 14, true, "GTIN вложенных товаров"},
+	{"10", 2, 1, 20, false, "партия"},
+	{"11", 2, 6, 6, true, "дата производства"},
+	{"13", 2, 6, 6, true, "дата упаковки"},
+	{"15", 2, 6, 6, true, "лучше употребить до"},
+	{"16", 2, 6, 6, true, "продать до"},
+	{"17", 2, 6, 6, true, "годен до"},
+	{"20", 2, 2, 2, true, "вариант"},
+	{"21", 2, 1, 20, false, "серийный номер"},
+	{"240", 3, 1, 30, false, "доп. идентификатор"},
+	{"30", 2, 1, 8, true, "количество"},
+	{"310", 4, 6, 6, true, "вес нетто, кг"},
+	{"320", 4, 6, 6, true, "вес нетто, фунты"},
+	{"330", 4, 6, 6, true, "вес брутто, кг"},
+	{"31", 4, 6, 6, true, "мера"},
+	{"32", 4, 6, 6, true, "мера"},
+	{"33", 4, 6, 6, true, "мера"},
+	{"34", 4, 6, 6, true, "мера"},
+	{"35", 4, 6, 6, true, "мера"},
+	{"36", 4, 6, 6, true, "мера"},
+	{"37", 2, 1, 8, true, "количество единиц"},
+	{"390", 4, 1, 15, true, "сумма"},
+	{"392", 4, 1, 15, true, "цена"},
+	{"400", 3, 1, 30, false, "номер заказа"},
+	{"410", 3, 13, 13, true, "GLN получателя"},
+	{"414", 3, 13, 13, true, "GLN места"},
+	{"8005", 4, 6, 6, true, "цена за единицу"},
+	{"91", 2, 1, 90, false, "ключ проверки"},
+	{"92", 2, 1, 90, false, "код проверки"},
+	{"93", 2, 1, 90, false, "код проверки"},
+	{"94", 2, 1, 90, false, "внутренний"},
+	{"95", 2, 1, 90, false, "внутренний"},
+	{"96", 2, 1, 90, false, "внутренний"},
+	{"97", 2, 1, 90, false, "внутренний"},
+	{"98", 2, 1, 90, false, "внутренний"},
+	{"99", 2, 1, 90, false, "внутренний"},
+}
+
+// Длины серийного номера в кодах Честного знака: обувь, одежда, лекарства - 13,
+// молочная продукция и вода - 6, табак - 7
+var markingSerialLengths = []int{13, 6, 7}
+
+// Допустимые символы значений GS1 (набор из 82 символов)
+const gs1Charset = "!\"%&'()*+,-./0123456789:;<=>?ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+// Описание идентификатора по началу данных
+func findGS1AI(data string) (gs1AI, bool) {
+	for _, ai := range gs1AIs {
+		if strings.HasPrefix(data, ai.prefix) && len(data) >= ai.length && isDigits(data[:ai.length]) {
+			return ai, true
+		}
+	}
+	return gs1AI{}, false
+}
+
+// Название элемента: "GTIN", "серийный номер"
+func (e GS1Element) Title() string {
+	ai, _ := findGS1AI(e.AI)
+	return ai.title
+}
+
+// Идентификаторы с заранее известной длиной значения, после которых GS не нужен
+func gs1Predefined(ai string) bool {
+	switch ai[:2] {
+	case "00", "01", "02", "03", "04", "11", "12", "13", "14", "15", "16", "17", "18", "19", "20",
+		"31", "32", "33", "34", "35", "36", "41":
+		return true
+	}
+	return false
+}
+
+// Код в читаемом виде: "(01)04601234567893(21)ABCDEFGHIJKLM(91)EE06"
+func GS1String(elements []GS1Element) string {
+	var res strings.Builder
+	for _, e := range elements {
+		res.WriteString("(" + e.AI + ")" + e.Value)
+	}
+	return res.String()
+}
+
+// Код в том виде, как его передает сканер: GS после значений переменной длины, кроме последнего
+func GS1Data(elements []GS1Element) string {
+	var res strings.Builder
+	for i, e := range elements {
+		res.WriteString(e.AI + e.Value)
+		if i < len(elements)-1 && !gs1Predefined(e.AI) {
+			res.WriteByte(gs1GS)
+		}
+	}
+	return res.String()
+}
+
+// Разбирает код в читаемом виде "(01)04601234567893(21)ABC". Скобка внутри значения
+// началом элемента не считается, если за ней не идут 2-4 цифры и закрывающая скобка
+func parseGS1Text(text string) ([]GS1Element, error) {
+	elements := []GS1Element{}
+	for len(text) > 0 {
+		ai, n := gs1TextAI(text)
+		if n == 0 {
+			return nil, fmt.Errorf("ожидался идентификатор применения в скобках: %q", text)
+		}
+		text = text[n:]
+		end := len(text)
+		for i := 0; i < len(text); i++ {
+			if _, n := gs1TextAI(text[i:]); n > 0 {
+				end = i
+				break
+			}
+		}
+		elements = append(elements, GS1Element{AI: ai, Value: text[:end]})
+		text = text[end:]
+	}
+	return elements, nil
+}
+
+// Идентификатор применения в скобках в начале текста и длина вместе со скобками, 0 - его нет
+func gs1TextAI(text string) (string, int) {
+	if len(text) < 4 || text[0] != '(' {
+		return "", 0
+	}
+	end := strings.IndexByte(text, ')')
+	if end < 3 || end > 5 || !isDigits(text[1:end]) {
+		return "", 0
+	}
+	return text[1:end], end + 1
+}
+
+// Разбирает код GS1 на элементы и возвращает найденные ошибки
+func ParseGS1(data string) ([]GS1Element, []string) {
+	elements := []GS1Element{}
+	problems := []string{}
+
+	if fixed, n := fromRussianLayout(data); n > 0 {
+		problems = append(problems, fmt.Sprintf("%d символов в русской раскладке: сканер работает как клавиатура, переключите раскладку на английскую", n))
+		data = fixed
+	}
+	// FNC1 в начале кода некоторые сканеры передают как GS
+	data = strings.TrimPrefix(data, string(rune(gs1GS)))
+
+	for pos := 0; pos < len(data); {
+		if data[pos] == gs1GS {
+			pos++
+			continue
+		}
+		ai, ok := findGS1AI(data[pos:])
+		if !ok {
+			problems = append(problems, fmt.Sprintf("неизвестный идентификатор применения в позиции %d: %q", pos, data[pos:min(pos+4, len(data))]))
+			break
+		}
+		id := data[pos : pos+ai.length]
+		pos += ai.length
+
+		// Значение до GS, а для известной длины - не дальше этой длины
+		end := strings.IndexByte(data[pos:], gs1GS)
+		if end < 0 {
+			end = len(data) - pos
+		}
+		if gs1Predefined(id) {
+			end = min(end, ai.max)
+		}
+		e := GS1Element{AI: id, Value: data[pos : pos+end]}
+		pos += end
+
+		elements = append(elements, e)
+		problems = append(problems, e.check(ai)...)
+	}
+
+	if len(elements) == 0 && len(problems) == 0 {
+		problems = append(problems, "пустой код GS1")
+	}
+	problems = append(problems, markingProblems(elements)...)
+	return elements, problems
+}
+
+// Проверяет длину, символы, контрольную цифру и даты одного элемента
+func (e GS1Element) check(ai gs1AI) []string {
+	problems := []string{}
+
+	// Серийный номер Честного знака, за которым без GS идет криптохвост: (91) и (92)
+	// не помещаются в 20 символов, (91) или (93) без продолжения - ровно 4 символа до конца значения.
+	// Значение допустимой длины серийного номера - сам номер, даже если внутри есть 91 или 93
+	if e.AI == "21" {
+		serial := slices.Contains(markingSerialLengths, len(e.Value))
+		for _, n := range markingSerialLengths {
+			if len(e.Value) <= n+2 {
+				continue
+			}
+			next := e.Value[n : n+2]
+			if (next == "91" || next == "92") && len(e.Value) > ai.max || !serial && (next == "91" || next == "93") && len(e.Value) == n+6 {
+				return append(problems, fmt.Sprintf("нет разделителя GS после (21): похоже, серийный номер %q, затем (%s). Сканер не передает GS (0x1D)", e.Value[:n], next))
+			}
+		}
+	}
+
+	switch {
+	case len(e.Value) < ai.min:
+		problems = append(problems, fmt.Sprintf("(%s) %s: %d символов, нужно не меньше %d", e.AI, ai.title, len(e.Value), ai.min))
+	case len(e.Value) > ai.max:
+		problems = append(problems, fmt.Sprintf("(%s) %s длиннее %d символов: вероятно, пропущен разделитель GS", e.AI, ai.title, ai.max))
+	}
+
+	for _, c := range e.Value {
+		if ai.numeric && (c < '0' || c > '9') {
+			return append(problems, fmt.Sprintf("(%s) %s: должны быть только цифры, есть %q", e.AI, ai.title, c))
+		}
+		if !strings.ContainsRune(gs1Charset, c) {
+			return append(problems, fmt.Sprintf("(%s) %s: недопустимый символ %q", e.AI, ai.title, c))
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	switch e.AI {
+	case "00", "01", "02":
+		want := gs1CheckDigit(e.Value[:len(e.Value)-1])
+		if got := e.Value[len(e.Value)-1]; got != want {
+			problems = append(problems, fmt.Sprintf("(%s) неверная контрольная цифра %s %c, должна быть %c", e.AI, ai.title, got, want))
+		}
+	case "11", "13", "15", "16", "17":
+		// ГГММДД, день 00 - последний день месяца
+		month := (e.Value[2]-'0')*10 + e.Value[3] - '0'
+		day := (e.Value[4]-'0')*10 + e.Value[5] - '0'
+		if month < 1 || month > 12 || day > 31 {
+			problems = append(problems, fmt.Sprintf("(%s) %s: неверная дата %s, нужно ГГММДД", e.AI, ai.title, e.Value))
+		}
+	}
+	return problems
+}
+
+// Проверки кода маркировки Честный знак: есть GTIN и серийный номер, и криптохвост целиком
+func markingProblems(elements []GS1Element) []string {
+	values := map[string]string{}
+	for _, e := range elements {
+		values[e.AI] = e.Value
+	}
+	_, has91 := values["91"]
+	_, has92 := values["92"]
+	_, has93 := values["93"]
+	if !has91 && !has92 && !has93 {
+		return nil
+	}
+
+	problems := []string{}
+	if _, ok := values["01"]; !ok {
+		problems = append(problems, "в коде маркировки нет GTIN (01)")
+	}
+	if _, ok := values["21"]; !ok {
+		problems = append(problems, "в коде маркировки нет серийного номера (21)")
+	}
+	switch {
+	case has91 && !has92:
+		problems = append(problems, "есть ключ проверки (91), но нет кода проверки (92)")
+	case has92 && !has91:
+		problems = append(problems, "есть код проверки (92), но нет ключа проверки (91)")
+	}
+	if has91 && len(values["91"]) != 4 {
+		problems = append(problems, fmt.Sprintf("ключ проверки (91): %d символов, должно быть 4", len(values["91"])))
+	}
+	if has92 && len(values["92"]) != 44 && len(values["92"]) != 88 {
+		problems = append(problems, fmt.Sprintf("код проверки (92): %d символов, должно быть 44", len(values["92"])))
+	}
+	if has93 && len(values["93"]) != 4 {
+		problems = append(problems, fmt.Sprintf("код проверки (93): %d символов, должно быть 4", len(values["93"])))
+	}
+	return problems
+}
@@ -0,0 +1,58 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGS1MissingGS(t *testing.T) {
+	const (
+		gs     = "\x1d"
+		crypto = "dGVzdGRhdGFkR1Z6ZEdSaGRHRmtSMVo2WkVkU2FHUkg="
+	)
+	tests := []struct {
+		name string
+		data string
+		want string // часть текста ошибки, "" - ошибок нет
+	}{
+		{"с разделителями", "0104601234567893" + "21ABCDEFGHIJKLM" + gs + "91EE06" + gs + "92" + crypto, ""},
+		{"FNC1 как GS в начале", gs + "0104601234567893" + "21ABCDEF" + gs + "93dGVz", ""},
+		{"нет GS после (21) перед (91)", "0104601234567893" + "21ABCDEFGHIJKLM" + "91EE06" + gs + "92" + crypto,
+			`нет разделителя GS после (21): похоже, серийный номер "ABCDEFGHIJKLM", затем (91)`},
+		{"нет GS после (21) перед (93)", "0104601234567893" + "21ABCDEF" + "93dGVz",
+			`нет разделителя GS после (21): похоже, серийный номер "ABCDEF", затем (93)`},
+		{"нет GS вообще", "0104601234567893" + "21ABCDEFGHIJKLM" + "91EE06" + "92" + crypto,
+			"нет разделителя GS после (21)"},
+		// 91 и 93 внутри серийного номера из 13 символов - часть номера
+		{"91 внутри номера", "0104601234567893" + "21ABCDEFG91XYZ1" + gs + "91EE06" + gs + "92" + crypto, ""},
+		{"93 внутри номера", "0104601234567893" + "21ABCDEFG93XYZ1" + gs + "93dGVz", ""},
+		{"русская раскладка", "0104601234567893" + "21ФИСВУАПРШОЛЬТ",
+			"символов в русской раскладке"},
+	}
+	for _, tt := range tests {
+		_, problems := ParseGS1(tt.data)
+		text := strings.Join(problems, "\n")
+		switch {
+		case tt.want == "" && len(problems) > 0:
+			t.Errorf("%s: лишние ошибки:\n%s", tt.name, text)
+		case tt.want != "" && !strings.Contains(text, tt.want):
+			t.Errorf("%s: нет ошибки %q, есть:\n%s", tt.name, tt.want, text)
+		}
+	}
+}
+
+func TestParseGS1Elements(t *testing.T) {
+	elements, problems := ParseGS1("0104601234567893" + "17250131" + "10LOT42" + "\x1d" + "21SN1")
+	if len(problems) > 0 {
+		t.Fatalf("ошибки: %v", problems)
+	}
+	want := []GS1Element{{"01", "04601234567893"}, {"17", "250131"}, {"10", "LOT42"}, {"21", "SN1"}}
+	if len(elements) != len(want) {
+		t.Fatalf("элементы %v, нужно %v", elements, want)
+	}
+	for i := range want {
+		if elements[i] != want[i] {
+			t.Errorf("элемент %d: %v, нужно %v", i, elements[i], want[i])
+		}
+	}
+}
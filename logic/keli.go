@@ -0,0 +1,332 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Протоколы индикаторов Keli (XK3190-A9, A12, D2 и совместимые).
+//
+// Непрерывная передача, tF=0, 12 байт:
+//
+//	STX, знак (+/-), 6 цифр веса, позиция запятой (0-4), XOR (2 HEX символа), ETX
+//
+// XOR считается по байтам от знака до позиции запятой и передается старшей и младшей тетрадой.
+//
+// Непрерывная передача, tF=1/2, 8 байт: '=' и 7 символов веса в обратном порядке,
+// например "=05.2100" - это 0012.50.
+//
+// Режим команд: STX <команда> ETX. Ответ на запрос веса - кадр STX ... ETX
+// с эхом команды, весом с точкой, единицей измерения и, возможно, XOR.
+//
+// Протокол не передает признак стабильности, поэтому вес считается стабильным,
+// если он совпадает с предыдущим показанием.
+
+const (
+	keliSTX = 0x02
+	keliETX = 0x03
+	keliACK = 0x06
+
+	keliCmdWeight = 'A' // Запрос веса
+	keliCmdTare   = 'T' // Тара
+	keliCmdZero   = 'Z' // Ноль
+
+	keliMaxFrame = 32
+	keliFrameLen = 12 // кадр tF=0
+)
+
+// Ищет в буфере следующий кадр Keli любого формата
+func nextKeliFrame(buf []byte, stats *FrameStats) (Reading, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		start := bytes.IndexAny(rest, "\x02=")
+		if start < 0 {
+			stats.SkippedBytes += len(rest)
+			return Reading{}, len(buf), false
+		}
+		stats.SkippedBytes += start
+		used += start
+		rest = buf[used:]
+
+		// Формат с обратным порядком цифр: фиксированная длина
+		if rest[0] == '=' {
+			if len(rest) < 8 {
+				return Reading{}, used, false
+			}
+			r, err := decodeKeliReversed(rest[:8])
+			if err != nil {
+				stats.FramingErrors++
+				used++
+				continue
+			}
+			stats.Frames++
+			return r, used + 8, true
+		}
+
+		end := bytes.IndexByte(rest, keliETX)
+		if end < 0 {
+			if len(rest) > keliMaxFrame {
+				stats.FramingErrors++
+				used++
+				continue
+			}
+			return Reading{}, used, false
+		}
+
+		r, err := decodeKeliFrame(rest[:end+1])
+		if err == errKeliChecksum {
+			stats.ChecksumErrors++
+			used++
+			continue
+		}
+		if err != nil {
+			stats.FramingErrors++
+			used++
+			continue
+		}
+		stats.Frames++
+		return r, used + end + 1, true
+	}
+}
+
+var errKeliChecksum = fmt.Errorf("неверная контрольная сумма Keli")
+
+// XOR байт, как его передает Keli: две тетрады в виде HEX символов
+func keliXOR(data []byte) []byte {
+	var x byte
+	for _, b := range data {
+		x ^= b
+	}
+	return []byte(fmt.Sprintf("%02X", x))
+}
+
+// Разбирает кадр STX ... ETX
+func decodeKeliFrame(frame []byte) (Reading, error) {
+	r := Reading{Raw: append([]byte(nil), frame...), Unit: "kg"}
+	body := frame[1 : len(frame)-1]
+
+	// Непрерывный формат tF=0: знак, 6 цифр, позиция запятой, XOR
+	if len(body) == 10 && (body[0] == '+' || body[0] == '-') {
+		if !bytes.Equal(keliXOR(body[:8]), bytes.ToUpper(body[8:10])) {
+			return r, errKeliChecksum
+		}
+		value, err := strconv.ParseInt(string(body[1:7]), 10, 64)
+		if err != nil {
+			return r, fmt.Errorf("неверный вес Keli %q", body[1:7])
+		}
+		point := int(body[7] - '0')
+		if point < 0 || point > 4 {
+			return r, fmt.Errorf("неверная позиция запятой Keli %q", body[7])
+		}
+		if body[0] == '-' {
+			value = -value
+		}
+		r.Weight = NewDecimal(value, point)
+		r.Zero = value == 0
+		return r, nil
+	}
+
+	// Ответ на команду: эхо команды, вес с точкой, единица, возможно XOR в конце
+	text := strings.TrimSpace(strings.TrimRight(string(body), "\r\n"))
+	if len(text) > 0 && text[0] == keliCmdWeight {
+		text = text[1:]
+	}
+	if len(text) > 2 {
+		tail := strings.ToUpper(text[len(text)-2:])
+		if string(keliXOR([]byte(text[:len(text)-2]))) == tail {
+			text = text[:len(text)-2]
+		}
+	}
+
+	// Перегрузка индикатор показывает как OL или ----
+	if strings.Contains(text, "OL") || strings.Contains(text, "----") {
+		r.Overload = true
+		return r, nil
+	}
+
+	weight, unit, ok := parseWeightText(text)
+	if !ok {
+		return r, fmt.Errorf("нет веса в кадре Keli %q", text)
+	}
+	switch unit {
+	case "":
+	case "kg", "g", "lb", "t":
+		r.Unit = unit
+	default:
+		return r, fmt.Errorf("неизвестная единица измерения Keli %q", unit)
+	}
+	r.Weight = weight
+	r.Zero = weight.IsZero()
+	return r, nil
+}
+
+// Разбирает кадр "=" + 7 символов веса в обратном порядке
+func decodeKeliReversed(frame []byte) (Reading, error) {
+	r := Reading{Raw: append([]byte(nil), frame...), Unit: "kg"}
+
+	text := []byte(string(frame[1:]))
+	for i, j := 0, len(text)-1; i < j; i, j = i+1, j-1 {
+		text[i], text[j] = text[j], text[i]
+	}
+
+	weight, err := ParseDecimal(string(text))
+	if err != nil {
+		return r, fmt.Errorf("неверный вес Keli %q", text)
+	}
+	r.Weight = weight
+	r.Zero = weight.IsZero()
+	return r, nil
+}
+
+// Разбирает накопленные байты. Стабильность определяется по совпадению с прошлым показанием
+func (d *Device) takeKeliFrame() (string, bool) {
+	r, used, ok := nextKeliFrame(d.rx, &d.Stats)
+	d.rx = d.rx[used:]
+	if !ok {
+		return "", false
+	}
+	r.Stable = d.prevReading != nil && d.prevReading.Weight == r.Weight
+	str, _ := d.setReading(r)
+	return str, true
+}
+
+// Чтение веса Keli вес по запросу
+func startReadWeightKeliRequest(d *Device) (string, error) {
+	return d.requestFrame([]byte{keliSTX, keliCmdWeight, keliETX}, d.takeKeliFrame)
+}
+
+// Чтение веса Keli непрерывная передача данных
+func startReadWeightKeli(d *Device) (string, error) {
+	return d.readFrames(d.takeKeliFrame)
+}
+
+// Отправляет команду Keli и ждет подтверждения: ACK или любой кадр в ответ
+func (d *Device) keliCommand(cmd byte) error {
+	if d.transport == nil {
+		return d.fail("Весы не подключены")
+	}
+
+	d.rx = nil
+	if _, err := d.transport.Write([]byte{keliSTX, cmd, keliETX}); err != nil {
+		d.LastError = err.Error()
+		return err
+	}
+
+	for {
+		n, err := d.readMore()
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(d.rx, keliACK) >= 0 || bytes.IndexByte(d.rx, keliETX) >= 0 {
+			d.rx = nil
+			return nil
+		}
+		if n == 0 {
+			return d.fail("Нет ответа от весов")
+		}
+	}
+}
+
+// Тара
+func (d *Device) KeliTare() error {
+	return d.keliCommand(keliCmdTare)
+}
+
+// Установка нуля
+func (d *Device) KeliZero() error {
+	return d.keliCommand(keliCmdZero)
+}
+
+// Ответ Keli при перегрузе
+var keliOverload = []byte{keliSTX, 'O', 'L', keliETX}
+
+// Наибольшее значение, которое помещается в 6 цифр кадра
+const keliMaxValue = 999999
+
+// Кадр Keli tF=0 с весом в кг: STX, знак, 6 цифр, позиция запятой, XOR, ETX.
+// Вес, который не помещается в 6 цифр, передается как перегруз
+func keliFrame(weight Decimal) []byte {
+	sign := byte('+')
+	value := weight.Value
+	if value < 0 {
+		sign = '-'
+		value = -value
+	}
+	if value > keliMaxValue {
+		return keliOverload
+	}
+	body := fmt.Appendf([]byte{sign}, "%06d%d", value, weight.Scale)
+	body = append(body, keliXOR(body)...)
+	return append(append([]byte{keliSTX}, body...), keliETX)
+}
+
+// Ответ эмулятора Keli на команду. nil - команда не поддерживается
+func (e *emulator) keliAnswer(cmd byte) []byte {
+	switch cmd {
+	case keliCmdWeight:
+		s := e.next()
+		if s.Overload {
+			return keliOverload
+		}
+		return keliFrame(e.net(s.Weight))
+	case keliCmdTare:
+		// Тара - весь вес на платформе от нуля, прежняя тара не вычитается
+		e.tare = NewDecimal(e.current.Weight.Value-e.zero.Value, emulatorScale)
+		return []byte{keliACK}
+	case keliCmdZero:
+		e.zero = e.current.Weight
+		e.tare = Decimal{}
+		return []byte{keliACK}
+	}
+	return nil
+}
+
+// Эмуляция весов Keli: ответ на запрос веса STX A ETX, тару и ноль
+func startEmulateKeli(d *Device) (string, error) {
+	for {
+		// Команда могла прийти в прошлый раз вместе с предыдущей
+		start := bytes.IndexByte(d.rx, keliSTX)
+		if start < 0 {
+			d.rx = nil
+		} else {
+			d.rx = d.rx[start:]
+		}
+
+		if len(d.rx) >= 3 {
+			cmd := d.rx[1]
+			if d.rx[2] != keliETX {
+				// Не команда, ищем следующий STX
+				d.rx = d.rx[1:]
+				continue
+			}
+			d.rx = d.rx[3:]
+
+			answer := d.emu.keliAnswer(cmd)
+			if answer == nil {
+				return fmt.Sprintf("%c -> неизвестная команда", cmd), nil
+			}
+			// Контрольная сумма есть только в кадре с весом: STX, 8 байт, XOR, ETX
+			checksum := -1
+			if len(answer) == keliFrameLen {
+				checksum = keliFrameLen - 3
+			}
+			faults, err := d.emulatorWrite(answer, checksum)
+			if err != nil {
+				return "", err
+			}
+			if answer[0] == keliACK {
+				return fmt.Sprintf("%c -> ACK", cmd) + faults, nil
+			}
+			return fmt.Sprintf("%c -> %s", cmd, answer[1:len(answer)-1]) + faults, nil
+		}
+
+		n, err := d.readMore()
+		if err != nil || n == 0 {
+			return "", err
+		}
+	}
+}
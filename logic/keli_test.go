@@ -0,0 +1,80 @@
+package logic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeliXOR(t *testing.T) {
+	tests := []struct {
+		data, want string
+	}{
+		{"", "00"},
+		{"A", "41"},
+		{"+0012342", "1D"},
+		{"-0000503", "1B"},
+	}
+	for _, tt := range tests {
+		if got := string(keliXOR([]byte(tt.data))); got != tt.want {
+			t.Errorf("keliXOR(%q) = %s, нужно %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestKeliFrame(t *testing.T) {
+	tests := []struct {
+		weight Decimal
+		want   string
+	}{
+		{NewDecimal(1234, 2), "\x02+0012342" + "1D\x03"},
+		{NewDecimal(-503, 3), "\x02-0005033" + string(keliXOR([]byte("-0005033"))) + "\x03"},
+		{NewDecimal(999999, 2), "\x02+9999992" + string(keliXOR([]byte("+9999992"))) + "\x03"},
+		{NewDecimal(1000000, 2), "\x02OL\x03"},
+		{NewDecimal(-1000000, 2), "\x02OL\x03"},
+	}
+	for _, tt := range tests {
+		if got := keliFrame(tt.weight); !bytes.Equal(got, []byte(tt.want)) {
+			t.Errorf("keliFrame(%s) = %q, нужно %q", tt.weight, got, tt.want)
+		}
+	}
+}
+
+// Кадр эмулятора читается разбором кадров Keli
+func TestKeliFrameDecode(t *testing.T) {
+	for _, weight := range []Decimal{NewDecimal(0, 2), NewDecimal(1234, 2), NewDecimal(-503, 3), NewDecimal(1000000, 2)} {
+		frame := keliFrame(weight)
+		r, err := decodeKeliFrame(frame)
+		if err != nil {
+			t.Errorf("%s: %v", weight, err)
+			continue
+		}
+		if weight.Value > keliMaxValue || -weight.Value > keliMaxValue {
+			if !r.Overload {
+				t.Errorf("%s: нет перегруза", weight)
+			}
+		} else if r.Weight != weight {
+			t.Errorf("%s: разобрано %s", weight, r.Weight)
+		}
+	}
+}
+
+func TestDecodeKeliFrameChecksum(t *testing.T) {
+	if _, err := decodeKeliFrame([]byte("\x02+001234200\x03")); err != errKeliChecksum {
+		t.Errorf("неверный XOR: %v, нужно %v", err, errKeliChecksum)
+	}
+}
+
+// Повторная тара при уже установленной - весь вес на платформе, а не нетто
+func TestKeliTareTwice(t *testing.T) {
+	d := emulatorPair(t, EmulatorKeli, ScalesKeliRequest, NewDecimal(125, emulatorScale))
+	readWeight(t, d)
+
+	for i := 0; i < 2; i++ {
+		if err := d.KeliTare(); err != nil {
+			t.Fatal(err)
+		}
+		if r := readWeight(t, d); !r.Weight.IsZero() {
+			t.Errorf("тара %d: вес %s, нужно 0", i+1, r.Weight)
+		}
+	}
+}
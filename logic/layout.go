@@ -0,0 +1,40 @@
+package logic
+
+import "strings"
+
+// Сканер в режиме эмуляции клавиатуры "нажимает" клавиши латинских букв. Если в системе
+// включена русская раскладка, вместо ABC приходит ФИС. Таблица переводит такие символы обратно.
+
+// Символ русской раскладки ЙЦУКЕН -> символ той же клавиши в латинской раскладке
+var russianLayout = map[rune]rune{
+	'й': 'q', 'ц': 'w', 'у': 'e', 'к': 'r', 'е': 't', 'н': 'y', 'г': 'u', 'ш': 'i', 'щ': 'o', 'з': 'p', 'х': '[', 'ъ': ']',
+	'ф': 'a', 'ы': 's', 'в': 'd', 'а': 'f', 'п': 'g', 'р': 'h', 'о': 'j', 'л': 'k', 'д': 'l', 'ж': ';', 'э': '\'',
+	'я': 'z', 'ч': 'x', 'с': 'c', 'м': 'v', 'и': 'b', 'т': 'n', 'ь': 'm', 'б': ',', 'ю': '.', 'ё': '`',
+	'Й': 'Q', 'Ц': 'W', 'У': 'E', 'К': 'R', 'Е': 'T', 'Н': 'Y', 'Г': 'U', 'Ш': 'I', 'Щ': 'O', 'З': 'P', 'Х': '{', 'Ъ': '}',
+	'Ф': 'A', 'Ы': 'S', 'В': 'D', 'А': 'F', 'П': 'G', 'Р': 'H', 'О': 'J', 'Л': 'K', 'Д': 'L', 'Ж': ':', 'Э': '"',
+	'Я': 'Z', 'Ч': 'X', 'С': 'C', 'М': 'V', 'И': 'B', 'Т': 'N', 'Ь': 'M', 'Б': '<', 'Ю': '>', 'Ё': '~',
+	'№': '#',
+}
+
+// Символ той же клавиши в латинской раскладке для символа русской раскладки,
+// остальные символы не меняются
+func LatinKey(r rune) rune {
+	if latin, ok := russianLayout[r]; ok {
+		return latin
+	}
+	return r
+}
+
+// Переводит символы русской раскладки в символы тех же клавиш латинской.
+// Возвращает исправленную строку и количество замененных символов
+func fromRussianLayout(s string) (string, int) {
+	count := 0
+	res := strings.Map(func(r rune) rune {
+		latin := LatinKey(r)
+		if latin != r {
+			count++
+		}
+		return latin
+	}, s)
+	return res, count
+}
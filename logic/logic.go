@@ -1,14 +1,11 @@
 package logic
 
 import (
-	"encoding/binary"
 	"fmt"
 	"math/rand"
-	"strconv"
 	"strings"
 	"time"
 
-	"go.bug.st/serial"
 	"go.bug.st/serial/enumerator"
 )
 
@@ -16,23 +13,147 @@ import (
 type DeviceType int
 
 const (
-	Scanner             DeviceType = iota // Чтение данных от сканера
-	ScalesCAS                             // Чтение данных от весов CAS с непрерывной передачей данных
-	ScalesCASRequest                      // Чтение данных от весов CAS с запросом веса
-	ScalesKeliRequest                     // Чтение данных от весов Keli с запросом веса
-	ScalesMassaKRequest                   // Чтение данных от весов MassaK с запросом веса
-	EmulatorCAS                           // Эмуляция весов CAS с непрерывной передачей данных
-	EmulatorCASRequest                    // Эмуляция весов CAS с передачей данных по запросу
-	EchoTest                              // ECHO тест. Пишем в com порт и сразу читаем. Если пришло что отправили значит все хорошо
+	Scanner                   DeviceType = iota // Чтение данных от сканера
+	ScalesCAS                                   // Чтение данных от весов CAS с непрерывной передачей данных
+	ScalesCASRequest                            // Чтение данных от весов CAS с запросом веса
+	ScalesKeliRequest                           // Чтение данных от весов Keli с запросом веса
+	ScalesKeli                                  // Чтение данных от весов Keli с непрерывной передачей данных
+	ScalesMassaKRequest                         // Чтение данных от весов MassaK с запросом веса
+	EmulatorCAS                                 // Эмуляция весов CAS с непрерывной передачей данных
+	EmulatorCASRequest                          // Эмуляция весов CAS с передачей данных по запросу
+	EchoTest                                    // ECHO тест. Пишем в com порт и сразу читаем. Если пришло что отправили значит все хорошо
+	ScalesMTSICS                                // Чтение данных от весов Mettler Toledo MT-SICS, запрос SI
+	ScalesMTSICSStable                          // Чтение данных от весов Mettler Toledo MT-SICS, запрос стабильного веса S
+	ScalesMTSICSContinuous                      // Чтение данных от весов Mettler Toledo MT-SICS с непрерывной передачей (SIR)
+	EmulatorMTSICS                              // Эмуляция весов Mettler Toledo MT-SICS
+	ScalesShtrih                                // Чтение данных от весов Штрих-М с запросом состояния весового канала
+	ScalesToledo8142                            // Чтение данных от весов Toledo с непрерывной передачей 8142
+	ScalesToledo8217                            // Чтение данных от весов Toledo с запросом веса 8217
+	EmulatorToledo8142                          // Эмуляция весов Toledo с непрерывной передачей 8142
+	EmulatorToledo8217                          // Эмуляция весов Toledo с передачей по запросу 8217
+	ScannerScale                                // Весы-сканер: штрихкоды и вес по одному порту
+	ScalesAND                                   // Чтение данных от весов A&D с запросом веса
+	ScalesANDContinuous                         // Чтение данных от весов A&D с непрерывной передачей данных
+	ScalesOhaus                                 // Чтение данных от весов Ohaus с запросом веса
+	ScalesOhausContinuous                       // Чтение данных от весов Ohaus с непрерывной передачей данных
+	ScalesSartorius                             // Чтение данных от весов Sartorius SBI с запросом веса
+	ScalesSartoriusContinuous                   // Чтение данных от весов Sartorius SBI с непрерывной передачей данных
+	ScalesModbus                                // Чтение веса из регистров Modbus RTU
+	ScalesCustom                                // Чтение веса по протоколу, описанному в файле настроек
+	EmulatorKeli                                // Эмуляция весов Keli с передачей данных по запросу
+	EmulatorMassaK                              // Эмуляция весов MassaK по протоколу 100
 )
 
+// Короткие имена типов устройств для командной строки и файла настроек
+var deviceTypeCodes = map[DeviceType]string{
+	Scanner:                   "scanner",
+	ScalesCAS:                 "cas",
+	ScalesCASRequest:          "cas-request",
+	ScalesKeliRequest:         "keli",
+	ScalesKeli:                "keli-continuous",
+	ScalesMassaKRequest:       "massak",
+	EmulatorCAS:               "emu-cas",
+	EmulatorCASRequest:        "emu-cas-request",
+	EchoTest:                  "echo",
+	ScalesMTSICS:              "mt-sics",
+	ScalesMTSICSStable:        "mt-sics-stable",
+	ScalesMTSICSContinuous:    "mt-sics-continuous",
+	EmulatorMTSICS:            "emu-mt-sics",
+	ScalesShtrih:              "shtrih",
+	ScalesToledo8142:          "toledo-8142",
+	ScalesToledo8217:          "toledo-8217",
+	EmulatorToledo8142:        "emu-toledo-8142",
+	EmulatorToledo8217:        "emu-toledo-8217",
+	ScannerScale:              "scanner-scale",
+	ScalesAND:                 "and",
+	ScalesANDContinuous:       "and-continuous",
+	ScalesOhaus:               "ohaus",
+	ScalesOhausContinuous:     "ohaus-continuous",
+	ScalesSartorius:           "sartorius",
+	ScalesSartoriusContinuous: "sartorius-continuous",
+	ScalesModbus:              "modbus",
+	ScalesCustom:              "custom",
+	EmulatorKeli:              "emu-keli",
+	EmulatorMassaK:            "emu-massak",
+}
+
+// Короткое имя типа устройства
+func (t DeviceType) Code() string {
+	return deviceTypeCodes[t]
+}
+
+// Эмуляторы не читают вес, а отдают его в порт
+func (t DeviceType) IsEmulator() bool {
+	switch t {
+	case EmulatorCAS, EmulatorCASRequest, EmulatorMTSICS, EmulatorToledo8142, EmulatorToledo8217,
+		EmulatorKeli, EmulatorMassaK:
+		return true
+	}
+	return false
+}
+
+// Тип устройства по короткому имени
+func ParseDeviceType(code string) (DeviceType, bool) {
+	for t, c := range deviceTypeCodes {
+		if strings.EqualFold(c, code) {
+			return t, true
+		}
+	}
+	return Scanner, false
+}
+
 type Device struct {
-	Port         string
-	Type         DeviceType
-	LastError    string
-	serialConfig serial.Mode
-	serialPort   serial.Port
-	processFunc  func(*Device) (string, error) // функция обработки
+	Port        string
+	Type        DeviceType
+	LastError   string
+	LastReading *Reading                      // показание весов после последнего Process, nil если его нет
+	LastBarcode *Barcode                      // штрихкод после последнего Process, nil если его нет
+	prevReading *Reading                      // последнее показание весов, не сбрасывается между Process
+	Settings    map[DeviceType]SerialSettings // параметры порта, измененные пользователем
+	Modbus      *ModbusSettings               // карта регистров Modbus, nil - по умолчанию
+	Protocols   []*CustomProtocol             // протоколы весов из файла настроек
+	Custom      *CustomProtocol               // выбранный протокол для ScalesCustom
+	Profile     WeightProfile                 // сценарий веса для эмуляторов
+	Faults      FaultSettings                 // ошибки, которые вносят эмуляторы
+	ScanDiag    *ScanDiagnostics              // диагностика настроек сканера, nil - обычное чтение
+	ScanBench   *ScanBenchmark                // замер скорости сканирования, nil - без замера
+	TestSheet   *TestSheet                    // проверка по тестовому листу, nil - без проверки
+	FaultStats  FaultStats                    // ошибки, внесенные эмулятором с момента подключения
+	Stats       FrameStats                    // счетчики принятых кадров и ошибок с момента подключения
+	Echo        EchoStats                     // статистика echo теста с момента подключения
+	transport   Transport                     // канал обмена с устройством
+	rx          []byte                        // принятые, но еще не разобранные байты
+	lastRequest time.Time                     // время последнего запроса, для опроса между приходом данных
+	emu         *emulator                     // состояние эмулятора весов
+	processFunc func(*Device) (string, error) // функция обработки
+	connectFunc func(*Device) error           // вызывается после подключения, например чтобы включить передачу
+	stopFunc    func(*Device)                 // вызывается перед отключением
+}
+
+// Параметры порта для текущего типа устройства: заданные пользователем или по умолчанию
+func (d *Device) SerialSettings() SerialSettings {
+	if s, ok := d.Settings[d.Type]; ok {
+		return s
+	}
+	return DefaultSerialSettings(d.Type)
+}
+
+// Параметры порта, с которыми он открывается: параметры типа устройства
+// и параметры из строки порта serial://...?baud=9600 поверх них
+func (d *Device) PortSettings() SerialSettings {
+	settings, err := PortSettings(d.Port, d.SerialSettings())
+	if err != nil {
+		return d.SerialSettings()
+	}
+	return settings
+}
+
+// Задает параметры порта для текущего типа устройства
+func (d *Device) SetSerialSettings(s SerialSettings) {
+	if d.Settings == nil {
+		d.Settings = map[DeviceType]SerialSettings{}
+	}
+	d.Settings[d.Type] = s
 }
 
 func (d *Device) Connect() (err error) {
@@ -44,100 +165,183 @@ func (d *Device) Connect() (err error) {
 		}
 	}()
 
-	// В зависимости от типа устройства выбираем разные параметры подключения
+	d.configure()
+
+	// Открываем порт
+	transport, settings, err := OpenTransport(d.Port, d.SerialSettings())
+
+	// Если были ошибки - пишем в LastError и выходим
+	if err != nil {
+		d.LastError = err.Error()
+		return err
+	}
+
+	return d.attach(transport, settings.ReadTimeout)
+}
+
+// Подключает устройство к уже открытому транспорту, минуя разбор строки порта.
+// Позволяет прогонять обработчики протоколов без оборудования.
+func (d *Device) ConnectTransport(t Transport) error {
+	d.configure()
+	return d.attach(t, d.PortSettings().ReadTimeout)
+}
+
+// Прописывает транспорт в структуру
+func (d *Device) attach(t Transport, readTimeout time.Duration) error {
+	if err := t.SetReadTimeout(readTimeout); err != nil {
+		t.Close()
+		d.LastError = err.Error()
+		return err
+	}
+
+	d.transport = t
+	d.Stats = FrameStats{}
+	d.rx = nil
+	d.prevReading = nil
+	d.lastRequest = time.Time{}
+	d.emu = nil
+	d.FaultStats = FaultStats{}
+	d.Echo = EchoStats{}
+	if d.Type.IsEmulator() {
+		d.emu = newEmulator(d.Profile)
+	}
+
+	if d.connectFunc != nil {
+		if err := d.connectFunc(d); err != nil {
+			d.Disconnect()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Выбирает обработчик по типу устройства
+func (d *Device) configure() {
+	d.connectFunc = nil
+	d.stopFunc = nil
+
+	// В зависимости от типа устройства выбираем разные обработчики
 	switch d.Type {
 	// Сканер
 	case Scanner:
-		d.serialConfig = serial.Mode{
-			BaudRate: 9600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startScanTest
 	// CAS непрерывная передача данных
 	case ScalesCAS:
-		d.serialConfig = serial.Mode{
-			BaudRate: 9600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startReadWeightCAS
 	// CAS по запросу
 	case ScalesCASRequest:
-		d.serialConfig = serial.Mode{
-			BaudRate: 9600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startReadWeightCASRequest
 	// Keli по запросу
 	case ScalesKeliRequest:
-		d.serialConfig = serial.Mode{
-			BaudRate: 9600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startReadWeightKeliRequest
+	// Keli непрерывная передача данных
+	case ScalesKeli:
+		d.processFunc = startReadWeightKeli
 	// MassaK по запросу
 	case ScalesMassaKRequest:
-		d.serialConfig = serial.Mode{
-			BaudRate: 57600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startReadWeightMassaKRequest
 	// Эмуляция весов CAS с непрерывной передачей данных
 	case EmulatorCAS:
-		d.serialConfig = serial.Mode{
-			BaudRate: 9600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startEmulateCAS
 	// Эмуляция весов CAS с передачей данных по запросу
 	case EmulatorCASRequest:
-		d.serialConfig = serial.Mode{
-			BaudRate: 9600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startEmulateCASRequest
 	// ECHO тест
 	case EchoTest:
-		d.serialConfig = serial.Mode{
-			BaudRate: 9600,
-			Parity:   serial.NoParity,
-			StopBits: serial.OneStopBit,
-		}
 		d.processFunc = startEchoTest
+	// MT-SICS вес сразу
+	case ScalesMTSICS:
+		d.processFunc = startReadWeightMTSICS
+	// MT-SICS стабильный вес
+	case ScalesMTSICSStable:
+		d.processFunc = startReadWeightMTSICSStable
+	// MT-SICS непрерывная передача данных
+	case ScalesMTSICSContinuous:
+		d.processFunc = startReadWeightMTSICSContinuous
+		d.connectFunc = startMTSICSContinuous
+		d.stopFunc = stopMTSICSContinuous
+	// Эмуляция весов MT-SICS
+	case EmulatorMTSICS:
+		d.processFunc = startEmulateMTSICS
+	// Штрих-М по запросу
+	case ScalesShtrih:
+		d.processFunc = startReadWeightShtrih
+	// Toledo 8142 непрерывная передача данных
+	case ScalesToledo8142:
+		d.processFunc = startReadWeightToledo8142
+	// Toledo 8217 по запросу
+	case ScalesToledo8217:
+		d.processFunc = startReadWeightToledo8217
+	// Эмуляция весов Toledo 8142
+	case EmulatorToledo8142:
+		d.processFunc = startEmulateToledo8142
+	// Эмуляция весов Toledo 8217
+	case EmulatorToledo8217:
+		d.processFunc = startEmulateToledo8217
+	// Весы-сканер
+	case ScannerScale:
+		d.processFunc = startReadScannerScale
+	// A&D по запросу
+	case ScalesAND:
+		d.processFunc = startReadWeightAND
+	// A&D непрерывная передача данных
+	case ScalesANDContinuous:
+		d.processFunc = startReadWeightANDContinuous
+		d.connectFunc = startANDContinuous
+		d.stopFunc = stopANDContinuous
+	// Ohaus по запросу
+	case ScalesOhaus:
+		d.processFunc = startReadWeightOhaus
+	// Ohaus непрерывная передача данных
+	case ScalesOhausContinuous:
+		d.processFunc = startReadWeightOhausContinuous
+		d.connectFunc = startOhausContinuous
+		d.stopFunc = stopOhausContinuous
+	// Sartorius по запросу
+	case ScalesSartorius:
+		d.processFunc = startReadWeightSartorius
+	// Sartorius непрерывная передача данных
+	case ScalesSartoriusContinuous:
+		d.processFunc = startReadWeightSartoriusContinuous
+	// Modbus RTU
+	case ScalesModbus:
+		d.processFunc = startReadWeightModbus
+	// Протокол из файла настроек
+	case ScalesCustom:
+		d.processFunc = startReadWeightCustom
+	// Эмуляция весов Keli
+	case EmulatorKeli:
+		d.processFunc = startEmulateKeli
+	// Эмуляция весов MassaK
+	case EmulatorMassaK:
+		d.processFunc = startEmulateMassaK
 	}
-
-	// Открываем порт
-	port, err := serial.Open(d.Port, &d.serialConfig)
-	port.SetReadTimeout(500 * time.Millisecond)
-
-	// Если были ошибки - пишем в LastError и выходим
-	if err != nil {
-		d.LastError = err.Error()
-		return err
-	}
-
-	// Если ошибок не было прописываем порт в структуру и выходим без ошибок
-	d.serialPort = port
-
-	return nil
 }
 
 func (d *Device) Disconnect() {
-	if d.serialPort != nil {
-		d.serialPort.Close()
-		d.serialPort = nil
+	if d.transport != nil {
+		if d.stopFunc != nil {
+			d.stopFunc(d)
+		}
+		d.transport.Close()
+		d.transport = nil
 		d.processFunc = nil
 	}
 }
 
+// Описание текущего подключения. Для pty здесь имя slave стороны
+func (d *Device) Endpoint() string {
+	if d.transport != nil {
+		return d.transport.Name()
+	}
+	return d.Port
+}
+
 func (d *Device) Process() (string, error) {
-	if d.serialPort != nil {
+	d.LastReading = nil
+	d.LastBarcode = nil
+	if d.transport != nil {
 		if d.processFunc != nil {
 			return d.processFunc(d)
 		} else {
@@ -148,284 +352,236 @@ func (d *Device) Process() (string, error) {
 	return "", nil
 }
 
-func GetAvailablePortList() []string {
-
-	// Список доступных портов
-	portNames := []string{}
-
-	ports, err := enumerator.GetDetailedPortsList()
-
-	// Если не было ошибок заполняем список портов и возвращаем результат.
-	// В противном случае вернется пустой список
-	if err == nil {
-		for _, p := range ports {
-			portNames = append(portNames, p.Name)
-		}
-	}
-
-	return portNames
+// Запоминает ошибку в LastError и возвращает ее
+func (d *Device) fail(text string) error {
+	d.LastError = text
+	return fmt.Errorf("%s", text)
 }
 
-// Сканирование
-func startScanTest(d *Device) (string, error) {
+// Счетчики разбора кадров. Ошибки не прячутся за частично принятыми данными, а считаются
+type FrameStats struct {
+	Frames         int // Принято корректных кадров
+	FramingErrors  int // Кадры с неверной структурой
+	ChecksumErrors int // Кадры с неверной контрольной суммой
+	SkippedBytes   int // Байты вне кадров, пропущенные при синхронизации
+}
 
-	var res strings.Builder
-	buf := make([]byte, 128)
+// Всего ошибочных кадров
+func (s FrameStats) Errors() int {
+	return s.FramingErrors + s.ChecksumErrors
+}
 
-	for {
-		n, err := d.serialPort.Read(buf) // Прочитали
-		// Если ошибка
-		if err != nil {
-			d.LastError = err.Error()
-			return "", err
-		}
+func (s FrameStats) String() string {
+	return fmt.Sprintf("кадров: %d, ошибок структуры: %d, ошибок КС: %d, пропущено байт: %d",
+		s.Frames, s.FramingErrors, s.ChecksumErrors, s.SkippedBytes)
+}
 
-		if n == 0 {
-			break
-		}
-		res.WriteString(strings.ReplaceAll(string(buf[:n]), "\r", "\n"))
+// Дочитывает из порта все, что пришло, в буфер разбора d.rx.
+// Возвращает 0 если за время таймаута ничего не пришло.
+func (d *Device) readMore() (int, error) {
+	buf := make([]byte, 256)
+	n, err := d.transport.Read(buf)
+	if err != nil {
+		d.LastError = err.Error()
+		return 0, err
 	}
-
-	return strings.TrimSuffix(res.String(), "\n"), nil
+	d.rx = append(d.rx, buf[:n]...)
+	return n, nil
 }
 
-// Чтение веса CAS непрерывная передача данных
-func startReadWeightCAS(d *Device) (string, error) {
-	const (
-		endSeqFirst  = byte(0x0D) // '\r'
-		endSeqSecond = byte(0x0A) // '\n'
-		msgSize      = 21         // читаем 21 байт после конца предыдущего пакета
-	)
-
-	var lastTwo []byte
-	var data []byte
-
-	buf := make([]byte, 1)
-
-	startBlockFound := false
-
+// Чтение при непрерывной передаче. take разбирает накопленные байты d.rx и возвращает
+// строку показания, если нашелся целый кадр. Неполный кадр остается в буфере до следующего чтения
+func (d *Device) readFrames(take func() (string, bool)) (string, error) {
 	for {
-		n, err := d.serialPort.Read(buf) // Прочитали
+		// Сначала то, что уже накопилось
+		if str, ok := take(); ok {
+			return str, nil
+		}
+
+		n, err := d.readMore()
 		if err != nil {
-			d.LastError = err.Error()
 			return "", err
 		}
 		if n == 0 {
-			break
-		}
-
-		if startBlockFound {
-			data = append(data, buf[0])
-		} else {
-			lastTwo = append(lastTwo, buf[0])
-			if len(lastTwo) > 2 {
-				lastTwo = lastTwo[1:]
-			}
-			if lastTwo[0] == endSeqFirst && lastTwo[1] == endSeqSecond {
-				startBlockFound = true
-			}
-		}
-
-		if len(data) > msgSize {
-			break
+			return "", nil
 		}
 	}
-
-	if len(data) > 0 {
-		return strings.ReplaceAll(string(data), "\r\n", ""), nil
-	}
-
-	return "", nil
 }
 
-// Чтение веса CAS вес по запросу
-func startReadWeightCASRequest(d *Device) (string, error) {
-
-	const (
-		msgSize = 22 // читаем 22 байт после конца предыдущего пакета
-	)
-	buf := make([]byte, 1)
-	var data []byte
+// Отправляет запрос и читает ответ, который разбирает take. Ответ, не пришедший
+// целиком за время таймаута, учитывается в FramingErrors и выбрасывается
+func (d *Device) requestFrame(req []byte, take func() (string, bool)) (string, error) {
+	// Опоздавшие ответы на прошлые запросы уже не нужны
+	d.rx = nil
 
-	// Отправляем в порт запрос на получение веса
-	buf[0] = 68 //D
-	_, err := d.serialPort.Write(buf)
-	if err != nil {
+	if _, err := d.transport.Write(req); err != nil {
 		d.LastError = err.Error()
 		return "", err
 	}
 
-	// Читаем из порта
+	// Читаем из порта до целого кадра или таймаута
 	for {
-		n, err := d.serialPort.Read(buf)
+		n, err := d.readMore()
 		if err != nil {
-			d.LastError = err.Error()
 			return "", err
 		}
-		if n == 0 {
-			break
+		if str, ok := take(); ok {
+			return str, nil
 		}
-
-		data = append(data, buf[0])
-
-		if len(data) >= msgSize {
-			break
+		if n == 0 {
+			// Ответ не пришел целиком
+			if len(d.rx) > 0 {
+				d.Stats.FramingErrors++
+				d.rx = nil
+			}
+			return "", nil
 		}
 	}
-
-	if len(data) > 0 {
-		return strings.ReplaceAll(string(data), "\r\n", ""), nil
-	}
-
-	return "", nil
 }
 
-// Чтение веса Keli вес по запросу
-func startReadWeightKeliRequest(d *Device) (string, error) {
+func GetAvailablePortList() []string {
 
-	const (
-		msgSize = 16 // читаем 16 байт после конца предыдущего пакета
-	)
-	sendBuf := make([]byte, 3)
-	buf := make([]byte, 1)
-	var data []byte
+	// Список доступных портов
+	portNames := []string{}
 
-	// Отправляем в порт запрос на получение веса
-	sendBuf[0] = 02
-	sendBuf[1] = 65
-	sendBuf[2] = 03
+	ports, err := enumerator.GetDetailedPortsList()
 
-	_, err := d.serialPort.Write(sendBuf)
-	if err != nil {
-		d.LastError = err.Error()
-		return "", err
+	// Если не было ошибок заполняем список портов и возвращаем результат.
+	// В противном случае вернется пустой список
+	if err == nil {
+		for _, p := range ports {
+			portNames = append(portNames, p.Name)
+		}
 	}
 
-	// Читаем из порта
+	return portNames
+}
+
+// Сканирование. Читаем до паузы, затем каждое сканирование, отделенное CR, LF или TAB,
+// разбираем и проверяем. Для каждого выводится PASS или FAIL
+func startScanTest(d *Device) (string, error) {
+	arrived := false
 	for {
-		n, err := d.serialPort.Read(buf)
+		n, err := d.readMore()
 		if err != nil {
-			d.LastError = err.Error()
 			return "", err
 		}
 		if n == 0 {
 			break
 		}
-
-		data = append(data, buf[0])
-
-		if len(data) >= msgSize {
-			break
+		arrived = true
+		if d.ScanBench != nil {
+			d.ScanBench.received(n, time.Now())
 		}
 	}
 
-	if len(data) > 0 {
-		return strings.ReplaceAll(string(data), "\r\n", ""), nil
-	}
-
-	return "", nil
-}
-
-// Чтение веса Massa-K вес по запросу
-func startReadWeightMassaKRequest(d *Device) (string, error) {
-
-	const (
-		msgSize = 14 // читаем 14 байт после конца предыдущего пакета
-	)
-	sendBuf := make([]byte, 8)
-	buf := make([]byte, 1)
-	var data []byte
-
-	// Отправляем в порт запрос на получение веса
-	sendBuf[0] = 248
-	sendBuf[1] = 85
-	sendBuf[2] = 206
-	sendBuf[3] = 1
-	sendBuf[4] = 0
-	sendBuf[5] = 160
-	sendBuf[6] = 160
-	sendBuf[7] = 0
-
-	_, err := d.serialPort.Write(sendBuf)
-	if err != nil {
-		d.LastError = err.Error()
-		return "", err
+	scans := splitScans(d.rx)
+	var rest []byte
+	if d.ScanBench != nil && d.ScanBench.waitRest(scans, arrived) {
+		rest = scans[len(scans)-1]
+		scans = scans[:len(scans)-1]
 	}
 
-	// Читаем из порта
-	for {
-		n, err := d.serialPort.Read(buf)
-		if err != nil {
-			d.LastError = err.Error()
-			return "", err
-		}
-		if n == 0 {
-			break
+	lines := []string{}
+	offset := 0
+	for _, scan := range scans {
+		payload := scan[:len(scan)-len(scanTerminator(scan))]
+
+		// Одиночный терминатор (например LF после CR, пришедший отдельно) сканированием
+		// не считается, но его байты разобраны
+		var record *ScanRecord
+		if d.ScanBench != nil && len(payload) > 0 {
+			r := d.ScanBench.add(scan, offset)
+			record = &r
+		}
+		offset += len(scan)
+
+		// В режиме диагностики выводятся байты как есть, включая терминатор
+		var line string
+		var b Barcode
+		if d.ScanDiag != nil {
+			line, b = d.ScanDiag.Add(scan)
+		} else {
+			if len(payload) == 0 {
+				continue
+			}
+			b = ParseBarcode(payload)
+			line = b.Report()
 		}
 
-		data = append(data, buf[0])
-
-		if len(data) >= msgSize {
-			break
+		if record != nil {
+			b.Time = record.First
+			line += "  [" + record.String() + "]"
 		}
-	}
-
-	if len(data) > 0 {
-		if (data[0] == 248) && (data[1] == 85) && (data[2] == 206) {
-			if len(data) == 14 {
-				value := binary.LittleEndian.Uint32(data[6:10])
-				return string(strconv.Itoa(int(value))), nil
-			} else {
-				return "Overload", nil
-			}
+		if d.TestSheet != nil {
+			line += "\n  " + d.TestSheet.Check(b)
 		}
+		d.setBarcode(b)
+		lines = append(lines, line)
 	}
 
-	return "", nil
+	if d.ScanBench != nil {
+		d.ScanBench.consumed(offset)
+	}
+	d.rx = append([]byte(nil), rest...)
+	return strings.Join(lines, "\n"), nil
 }
 
 // Эмуляция весов CAS
 func startEmulateCAS(d *Device) (string, error) {
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano())) // Инициализируем генератор случайных чисел
-
-	// Открываем порт
-
 	buf := make([]byte, 22)
 
 	// Генерируем управляющую строку для передачи веса
-	buf[0] = 83                      //S
-	buf[1] = 84                      //T
-	buf[2] = 44                      //,
-	buf[3] = 78                      //N
-	buf[4] = 84                      //T
-	buf[5] = 44                      //,
-	buf[6] = 1                       //
-	buf[7] = 188                     //�
-	buf[8] = 44                      //,
-	buf[9] = 32                      //
-	buf[10] = 32                     //
-	buf[11] = 32                     //
-	buf[12] = 48 + (byte)(r.Intn(9)) // ?
-	buf[13] = 48 + (byte)(r.Intn(9)) // ?
-	buf[14] = 46                     //.
-	buf[15] = 48 + (byte)(r.Intn(9)) // ?
-	buf[16] = 48 + (byte)(r.Intn(9)) // ?
-	buf[17] = 32                     //
-	buf[18] = 107                    //k
-	buf[19] = 103                    //g
-	buf[20] = 13                     // /r
-	buf[21] = 10                     // /n
-
-	_, err := d.serialPort.Write(buf)
+	buf[0] = 83   //S
+	buf[1] = 84   //T
+	buf[2] = 44   //,
+	buf[3] = 78   //N
+	buf[4] = 84   //T
+	buf[5] = 44   //,
+	buf[6] = 1    //
+	buf[7] = 188  //�
+	buf[8] = 44   //,
+	buf[17] = 32  //
+	buf[18] = 107 //k
+	buf[19] = 103 //g
+	buf[20] = 13  // /r
+	buf[21] = 10  // /n
+
+	// Вес 8 символов, выровненный вправо: "   12.34". Вес, который в 8 символов
+	// не помещается, передается как перегрузка
+	s := d.emu.next()
+	weight := fmt.Sprintf("%8s", d.emu.net(s.Weight))
+	if len(weight) > 8 {
+		s.Overload = true
+		weight = strings.Repeat(" ", 8)
+	}
+	copy(buf[9:17], weight)
+
+	// Состояние: перегрузка, нестабильный вес
+	switch {
+	case s.Overload:
+		buf[0] = 79 //O
+		buf[1] = 76 //L
+	case !s.Stable:
+		buf[0] = 85 //U
+		buf[1] = 83 //S
+	}
+
+	// Без тары - брутто
+	if d.emu.tare.IsZero() {
+		buf[3] = 71 //G
+		buf[4] = 83 //S
+	}
+
+	faults, err := d.emulatorWrite(buf, -1)
 	if err != nil {
-		d.LastError = err.Error()
 		return "", err
 	}
 
 	time.Sleep(500 * time.Millisecond)
 
-	return strings.ReplaceAll(string(buf), "\r\n", ""), nil
+	return strings.ReplaceAll(string(buf), "\r\n", "") + faults, nil
 }
 
 // Эмуляция весов CAS
@@ -434,7 +590,7 @@ func startEmulateCASRequest(d *Device) (string, error) {
 	buf := make([]byte, 1)
 
 	for {
-		n, err := d.serialPort.Read(buf) // Прочитали
+		n, err := d.transport.Read(buf) // Прочитали
 		// Если ошибка
 		if err != nil {
 			d.LastError = err.Error()
@@ -452,20 +608,35 @@ func startEmulateCASRequest(d *Device) (string, error) {
 	return "", nil
 }
 
+// Сколько ждать лишних байт после того, как пришел весь echo блок
+const echoExtraTimeout = 50 * time.Millisecond
+
 // Echo тест
 func startEchoTest(d *Device) (string, error) {
 
 	const ArraySize = 128
 	r := rand.New(rand.NewSource(time.Now().UnixNano())) // Инициализируем генератор случайных чисел
 
+	// При 5-7 битах данных старшие биты не передаются
+	mask := byte(0xFF)
+	if IsSerialPort(d.Port) {
+		settings := d.PortSettings()
+		d.Echo.Line = settings.String()
+		d.Echo.LineRate = settings.ByteRate()
+		if settings.DataBits < 8 {
+			mask = byte(1<<settings.DataBits - 1)
+		}
+	}
+
 	// Заполняем тестовую выборку случайными данными
 	testArray := make([]byte, ArraySize)
 	for i := range testArray {
-		testArray[i] = byte(r.Intn(256))
+		testArray[i] = byte(r.Intn(256)) & mask
 	}
 
 	// Пишем в порт весь массив
-	n, err := d.serialPort.Write(testArray)
+	start := time.Now()
+	n, err := d.transport.Write(testArray)
 	if err != nil {
 		d.LastError = err.Error()
 		return "", err
@@ -476,12 +647,14 @@ func startEchoTest(d *Device) (string, error) {
 		return "", fmt.Errorf(d.LastError)
 	}
 
-	buf := make([]byte, ArraySize)
+	// Буфер с запасом: лишние байты тоже читаются, иначе они не попадут в статистику
+	// и останутся в порту до следующего раунда
+	buf := make([]byte, ArraySize*2)
 	totalRead := 0
 
 	// Читаем из порта столько сколько записали
 	for totalRead < ArraySize {
-		n, err := d.serialPort.Read(buf[totalRead:])
+		n, err := d.transport.Read(buf[totalRead:])
 		if err != nil {
 			d.LastError = err.Error()
 			return "", err
@@ -492,19 +665,25 @@ func startEchoTest(d *Device) (string, error) {
 		}
 		totalRead += n
 	}
+	elapsed := time.Since(start)
 
-	// Сравниваем
-	isOk := true
-	for i := 0; i < ArraySize; i++ {
-		if buf[i] != testArray[i] {
-			isOk = false
+	// Дочитываем лишние байты до короткой паузы, полный таймаут чтения тут не нужен
+	if totalRead >= ArraySize {
+		d.transport.SetReadTimeout(echoExtraTimeout)
+		defer d.transport.SetReadTimeout(d.PortSettings().ReadTimeout)
+	}
+	for totalRead >= ArraySize && totalRead < len(buf) {
+		n, err := d.transport.Read(buf[totalRead:])
+		if err != nil {
+			d.LastError = err.Error()
+			return "", err
+		}
+
+		if n == 0 {
 			break
 		}
+		totalRead += n
 	}
 
-	if isOk {
-		return "PASS", nil
-	} else {
-		return "FAIL", nil
-	}
+	return d.Echo.add(testArray, buf[:totalRead], elapsed), nil
 }
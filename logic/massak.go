@@ -0,0 +1,420 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Протокол 100 весов Massa-K.
+//
+// Кадр: F8 55 CE, длина тела (2 байта LE), тело (команда и данные), CRC-16 тела (2 байта LE).
+
+var massaKHeader = []byte{0xF8, 0x55, 0xCE}
+
+// Сколько ждать ответа на служебные команды
+const massaKCommandTimeout = 2 * time.Second
+
+// Команды протокола 100
+const (
+	massaKCmdGetMassa    = 0xA0 // Запрос веса
+	massaKCmdGetMassaOld = 0x23 // Запрос веса в ранних версиях протокола
+	massaKCmdAckMassa    = 0x24 // Вес
+	massaKCmdAckMassaExt = 0x10 // Вес, ответ на 0xA0
+	massaKCmdGetName     = 0x20 // Запрос имени и серийного номера
+	massaKCmdAckName     = 0x21
+	massaKCmdAckSet      = 0x27 // Команда выполнена
+	massaKCmdError       = 0x28 // Ошибка, в данных код ошибки
+	massaKCmdSetZero     = 0x72 // Установка нуля
+	massaKCmdGetScalePar = 0x75 // Запрос параметров весов
+	massaKCmdAckScalePar = 0x76
+	massaKCmdSetTare     = 0xA3 // Установка тары
+	massaKCmdAckSetTare  = 0x12
+	massaKCmdNackTare    = 0x15
+	massaKCmdNack        = 0xF0 // Команда не распознана
+)
+
+// Коды ошибок в ответе 0x28
+var massaKErrors = map[byte]string{
+	0x07: "Команда не поддерживается",
+	0x08: "Превышена нагрузка на весы",
+	0x09: "Весы не в режиме взвешивания",
+	0x0A: "Ошибка входных данных",
+	0x0B: "Ошибка сохранения данных",
+	0x10: "Интерфейс WiFi не поддерживается",
+	0x11: "Интерфейс Ethernet не поддерживается",
+	0x15: "Установка нуля невозможна",
+	0x17: "Нет связи с модулем взвешивания",
+	0x18: "Установлена нагрузка на платформу при включении весов",
+	0x19: "Весы неисправны",
+	0xF0: "Неизвестная ошибка",
+}
+
+// Цена деления в ответе на запрос веса: количество знаков после запятой для веса в кг
+var massaKDivisionScale = map[byte]int{
+	0: 4, // 100 мг
+	1: 3, // 1 г
+	2: 2, // 10 г
+	3: 1, // 100 г
+	4: 0, // 1 кг
+}
+
+// CRC-16 по алгоритму из описания протокола 100 (полином 0x1021, начальное значение 0)
+func massaKCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		var a uint16
+		temp := (crc >> 8) << 8
+		for bit := 0; bit < 8; bit++ {
+			if (temp^a)&0x8000 != 0 {
+				a = (a << 1) ^ 0x1021
+			} else {
+				a <<= 1
+			}
+			temp <<= 1
+		}
+		crc = a ^ (crc << 8) ^ uint16(b)
+	}
+	return crc
+}
+
+// Собирает кадр из команды и данных
+func massaKFrame(cmd byte, data []byte) []byte {
+	body := append([]byte{cmd}, data...)
+	frame := append([]byte(nil), massaKHeader...)
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(len(body)))
+	frame = append(frame, body...)
+	return binary.LittleEndian.AppendUint16(frame, massaKCRC(body))
+}
+
+// Ищет в буфере следующий кадр. Возвращает тело кадра (команда и данные),
+// количество использованных байт и признак того, что кадр найден.
+func nextMassaKFrame(buf []byte, stats *FrameStats) ([]byte, int, bool) {
+	const maxBody = 1024
+
+	used := 0
+	for {
+		rest := buf[used:]
+
+		start := bytes.Index(rest, massaKHeader)
+		if start < 0 {
+			// Заголовок может быть разрезан на границе чтения - оставляем хвост
+			keep := min(len(rest), len(massaKHeader)-1)
+			stats.SkippedBytes += len(rest) - keep
+			return nil, len(buf) - keep, false
+		}
+		stats.SkippedBytes += start
+		used += start
+		rest = buf[used:]
+
+		if len(rest) < 5 {
+			return nil, used, false
+		}
+		size := int(binary.LittleEndian.Uint16(rest[3:5]))
+		if size == 0 || size > maxBody {
+			stats.FramingErrors++
+			used++
+			continue
+		}
+		if len(rest) < 5+size+2 {
+			return nil, used, false
+		}
+
+		body := rest[5 : 5+size]
+		crc := binary.LittleEndian.Uint16(rest[5+size:])
+		if crc != massaKCRC(body) {
+			stats.ChecksumErrors++
+			used++
+			continue
+		}
+
+		stats.Frames++
+		used += 5 + size + 2
+		return append([]byte(nil), body...), used, true
+	}
+}
+
+// Отправляет команду и ждет ответный кадр.
+// Возвращает тело ответа или nil, если ответа не было за время таймаута чтения.
+func (d *Device) massaKExchange(cmd byte, data []byte) ([]byte, error) {
+	var body []byte
+	_, err := d.requestFrame(massaKFrame(cmd, data), func() (string, bool) {
+		var used int
+		var ok bool
+		body, used, ok = nextMassaKFrame(d.rx, &d.Stats)
+		d.rx = d.rx[used:]
+		return "", ok
+	})
+	return body, err
+}
+
+// Команда, на которую весы обязаны ответить. Отсутствие ответа и CMD_ERROR - ошибки
+func (d *Device) massaKCommand(cmd byte, data []byte) ([]byte, error) {
+	if d.transport == nil {
+		return nil, d.fail("Весы не подключены")
+	}
+
+	// Служебные команды весы выполняют дольше, чем отдают вес
+	timeout := d.PortSettings().ReadTimeout
+	d.transport.SetReadTimeout(max(timeout, massaKCommandTimeout))
+	defer d.transport.SetReadTimeout(timeout)
+
+	body, err := d.massaKExchange(cmd, data)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, d.fail("Нет ответа от весов")
+	}
+
+	switch body[0] {
+	case massaKCmdError:
+		return nil, d.fail(massaKErrorText(body))
+	case massaKCmdNack:
+		return nil, d.fail("Весы не распознали команду")
+	}
+	return body, nil
+}
+
+func massaKErrorText(body []byte) string {
+	if len(body) < 2 {
+		return "Ошибка весов"
+	}
+	if text, ok := massaKErrors[body[1]]; ok {
+		return text
+	}
+	return fmt.Sprintf("Ошибка весов, код 0x%02X", body[1])
+}
+
+// Разбирает ответ на запрос веса: вес (int32 LE), цена деления, стабильность, нетто, ноль
+func decodeMassaKWeight(body []byte) (Reading, error) {
+	r := Reading{Raw: massaKFrame(body[0], body[1:])}
+
+	if body[0] == massaKCmdError && len(body) > 1 && body[1] == 0x08 {
+		r.Overload = true
+		return r, nil
+	}
+	if body[0] != massaKCmdAckMassa && body[0] != massaKCmdAckMassaExt {
+		return r, fmt.Errorf("неожиданный ответ Massa-K 0x%02X", body[0])
+	}
+	if len(body) < 9 {
+		return r, fmt.Errorf("короткий ответ Massa-K: %d байт", len(body))
+	}
+
+	value := int32(binary.LittleEndian.Uint32(body[1:5]))
+	scale, ok := massaKDivisionScale[body[5]]
+	if !ok {
+		return r, fmt.Errorf("неизвестная цена деления Massa-K %d", body[5])
+	}
+
+	r.Weight = NewDecimal(int64(value), scale)
+	r.Unit = "kg"
+	r.Stable = body[6] != 0
+	if body[7] != 0 {
+		r.Mode = WeightNet
+	}
+	r.Zero = body[8] != 0
+	return r, nil
+}
+
+// Чтение веса Massa-K вес по запросу
+func startReadWeightMassaKRequest(d *Device) (string, error) {
+	body, err := d.massaKExchange(massaKCmdGetMassa, nil)
+	if err != nil || body == nil {
+		return "", err
+	}
+
+	// Часть весов отвечает на запрос веса только в старом формате
+	if body[0] == massaKCmdNack || (body[0] == massaKCmdError && len(body) > 1 && body[1] == 0x07) {
+		if body, err = d.massaKExchange(massaKCmdGetMassaOld, nil); err != nil || body == nil {
+			return "", err
+		}
+	}
+
+	// Ошибку весов показываем вместо веса, показанием она не считается
+	if body[0] == massaKCmdError && !(len(body) > 1 && body[1] == 0x08) {
+		return massaKErrorText(body), nil
+	}
+
+	r, err := decodeMassaKWeight(body)
+	if err != nil {
+		d.Stats.FramingErrors++
+		d.LastError = err.Error()
+		return "", nil
+	}
+	return d.setReading(r)
+}
+
+// Установка нуля
+func (d *Device) MassaKSetZero() error {
+	body, err := d.massaKCommand(massaKCmdSetZero, nil)
+	if err != nil {
+		return err
+	}
+	if body[0] != massaKCmdAckSet {
+		return d.fail(fmt.Sprintf("Неожиданный ответ 0x%02X на установку нуля", body[0]))
+	}
+	return nil
+}
+
+// Установка тары. value - в единицах цены деления весов, 0 - сброс тары
+func (d *Device) MassaKSetTare(value int32) error {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(value))
+	body, err := d.massaKCommand(massaKCmdSetTare, data)
+	if err != nil {
+		return err
+	}
+	switch body[0] {
+	case massaKCmdAckSetTare:
+		return nil
+	case massaKCmdNackTare:
+		return d.fail("Весы отказались установить тару")
+	}
+	return d.fail(fmt.Sprintf("Неожиданный ответ 0x%02X на установку тары", body[0]))
+}
+
+// Тара по текущему весу на платформе. Весы передают вес нетто, поэтому прежняя тара
+// сначала сбрасывается, иначе новой тарой станет вес без нее
+func (d *Device) MassaKSetTareCurrent() error {
+	if err := d.MassaKSetTare(0); err != nil {
+		return err
+	}
+	body, err := d.massaKCommand(massaKCmdGetMassa, nil)
+	if err != nil {
+		return err
+	}
+	if body[0] != massaKCmdAckMassa && body[0] != massaKCmdAckMassaExt || len(body) < 5 {
+		return d.fail("Не удалось получить текущий вес")
+	}
+	return d.MassaKSetTare(int32(binary.LittleEndian.Uint32(body[1:5])))
+}
+
+// Параметры весов Massa-K
+type MassaKParams struct {
+	Max      string // Максимальная нагрузка
+	Min      string // Минимальная нагрузка
+	E        string // Поверочный интервал
+	Tare     string // Максимальная масса тары
+	Fix      string // Параметр фиксации веса
+	Calcode  string // Код юстировки
+	Firmware string // Версия ПО
+	Checksum string // Контрольная сумма ПО
+}
+
+// Запрос параметров весов. Ответ - строки, разделенные CR LF
+func (d *Device) MassaKScaleParams() (*MassaKParams, error) {
+	body, err := d.massaKCommand(massaKCmdGetScalePar, nil)
+	if err != nil {
+		return nil, err
+	}
+	if body[0] != massaKCmdAckScalePar {
+		return nil, d.fail(fmt.Sprintf("Неожиданный ответ 0x%02X на запрос параметров", body[0]))
+	}
+
+	fields := strings.Split(string(body[1:]), "\r\n")
+	for len(fields) < 8 {
+		fields = append(fields, "")
+	}
+	return &MassaKParams{
+		Max:      strings.TrimSpace(fields[0]),
+		Min:      strings.TrimSpace(fields[1]),
+		E:        strings.TrimSpace(fields[2]),
+		Tare:     strings.TrimSpace(fields[3]),
+		Fix:      strings.TrimSpace(fields[4]),
+		Calcode:  strings.TrimSpace(fields[5]),
+		Firmware: strings.TrimSpace(fields[6]),
+		Checksum: strings.TrimSpace(fields[7]),
+	}, nil
+}
+
+// Имя и серийный номер весов
+type MassaKInfo struct {
+	Serial uint32
+	Name   string
+}
+
+// Запрос имени и серийного номера
+func (d *Device) MassaKInfo() (*MassaKInfo, error) {
+	body, err := d.massaKCommand(massaKCmdGetName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if body[0] != massaKCmdAckName || len(body) < 5 {
+		return nil, d.fail(fmt.Sprintf("Неожиданный ответ 0x%02X на запрос имени", body[0]))
+	}
+	return &MassaKInfo{
+		Serial: binary.LittleEndian.Uint32(body[1:5]),
+		Name:   strings.TrimRight(string(body[5:]), "\x00 \r\n"),
+	}, nil
+}
+
+// Ответ на запрос веса: вес в граммах (int32 LE), цена деления 1 г, стабильность, нетто, ноль.
+// При перегрузке - ошибка 0x08
+func (e *emulator) massaKWeight(cmd byte) []byte {
+	s := e.next()
+	if s.Overload {
+		return massaKFrame(massaKCmdError, []byte{0x08})
+	}
+
+	weight := e.net(s.Weight)
+	data := binary.LittleEndian.AppendUint32(nil, uint32(int32(weight.Value*10)))
+	flag := func(b bool) byte {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	return massaKFrame(cmd, append(data, 1, flag(s.Stable), flag(!e.tare.IsZero()), flag(weight.IsZero())))
+}
+
+// Ответ эмулятора Massa-K на тело запроса: команда и данные
+func (e *emulator) massaKAnswer(body []byte) []byte {
+	switch body[0] {
+	case massaKCmdGetMassa:
+		return e.massaKWeight(massaKCmdAckMassaExt)
+	case massaKCmdGetMassaOld:
+		return e.massaKWeight(massaKCmdAckMassa)
+	case massaKCmdSetZero:
+		e.zero = e.current.Weight
+		e.tare = Decimal{}
+		return massaKFrame(massaKCmdAckSet, nil)
+	case massaKCmdSetTare:
+		if len(body) < 5 {
+			return massaKFrame(massaKCmdError, []byte{0x0A})
+		}
+		// Тара в граммах, эмулятор хранит вес с двумя знаками
+		e.tare = NewDecimal(int64(int32(binary.LittleEndian.Uint32(body[1:5])))/10, 2)
+		return massaKFrame(massaKCmdAckSetTare, nil)
+	case massaKCmdGetName:
+		data := binary.LittleEndian.AppendUint32(nil, 123456)
+		return massaKFrame(massaKCmdAckName, append(data, "SAKDeviceToolbox"...))
+	case massaKCmdGetScalePar:
+		params := "100 kg\r\n0.04 kg\r\n0.001 kg\r\n50 kg\r\n0\r\n0\r\n1.0\r\n0000"
+		return massaKFrame(massaKCmdAckScalePar, []byte(params))
+	}
+	return massaKFrame(massaKCmdError, []byte{0x07})
+}
+
+// Эмуляция весов Massa-K по протоколу 100: вес, ноль, тара, имя и параметры весов
+func startEmulateMassaK(d *Device) (string, error) {
+	for {
+		// Запрос мог прийти в прошлый раз вместе с предыдущим
+		body, used, ok := nextMassaKFrame(d.rx, &d.Stats)
+		d.rx = d.rx[used:]
+		if ok {
+			answer := d.emu.massaKAnswer(body)
+			faults, err := d.emulatorWrite(answer, len(answer)-1)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("% X -> % X", body, answer[5:len(answer)-2]) + faults, nil
+		}
+
+		n, err := d.readMore()
+		if err != nil || n == 0 {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package logic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMassaKCRC(t *testing.T) {
+	tests := []struct {
+		data string
+		want uint16
+	}{
+		{"", 0x0000},
+		{"\x23", 0x0023}, // запрос веса из описания протокола: F8 55 CE 01 00 23 23 00
+		{"\x20", 0x0020}, // запрос имени
+		{"123456789", 0xBEEF},
+		// С двумя нулевыми байтами в конце совпадает с CRC-16/XMODEM
+		{"123456789\x00\x00", 0x31C3},
+	}
+	for _, tt := range tests {
+		if got := massaKCRC([]byte(tt.data)); got != tt.want {
+			t.Errorf("massaKCRC(%q) = %04X, нужно %04X", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestMassaKFrame(t *testing.T) {
+	want := []byte{0xF8, 0x55, 0xCE, 0x01, 0x00, 0x23, 0x23, 0x00}
+	if got := massaKFrame(massaKCmdGetMassaOld, nil); !bytes.Equal(got, want) {
+		t.Errorf("massaKFrame = % X, нужно % X", got, want)
+	}
+}
+
+func TestNextMassaKFrame(t *testing.T) {
+	bad := massaKFrame(massaKCmdGetName, nil)
+	bad[len(bad)-1] ^= 0xFF
+	buf := append(append([]byte{0x00, 0x11}, bad...), massaKFrame(massaKCmdSetTare, []byte{1, 2, 3, 4})...)
+
+	var stats FrameStats
+	body, used, ok := nextMassaKFrame(buf, &stats)
+	if !ok || used != len(buf) {
+		t.Fatalf("кадр не найден: %v, использовано %d из %d", ok, used, len(buf))
+	}
+	if !bytes.Equal(body, []byte{massaKCmdSetTare, 1, 2, 3, 4}) {
+		t.Errorf("тело % X", body)
+	}
+	if stats.Frames != 1 || stats.ChecksumErrors != 1 {
+		t.Errorf("кадров %d, ошибок CRC %d, нужно 1 и 1", stats.Frames, stats.ChecksumErrors)
+	}
+
+	// Кадр, разрезанный на границе чтения, ждет продолжения
+	frame := massaKFrame(massaKCmdGetMassa, nil)
+	if _, used, ok := nextMassaKFrame(frame[:6], &stats); ok || used != 0 {
+		t.Errorf("неполный кадр: найден %v, использовано %d", ok, used)
+	}
+}
+
+// Тара по текущему весу при уже установленной таре - весь вес на платформе
+func TestMassaKSetTareCurrent(t *testing.T) {
+	d := emulatorPair(t, EmulatorMassaK, ScalesMassaKRequest, NewDecimal(125, emulatorScale))
+	readWeight(t, d)
+
+	for i := 0; i < 2; i++ {
+		if err := d.MassaKSetTareCurrent(); err != nil {
+			t.Fatal(err)
+		}
+		if r := readWeight(t, d); !r.Weight.IsZero() || r.Mode != WeightNet {
+			t.Errorf("тара %d: нетто %s, режим %v, нужно 0 нетто", i+1, r.Weight, r.Mode)
+		}
+	}
+}
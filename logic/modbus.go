@@ -0,0 +1,499 @@
+package logic
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Modbus RTU клиент для весовых индикаторов и преобразователей, которые публикуют вес в регистрах.
+//
+// Запрос: адрес устройства, функция (03 - holding, 04 - input), адрес первого регистра,
+// количество регистров, CRC-16. Ответ: адрес, функция, количество байт, данные, CRC-16.
+// Ответ с ошибкой: адрес, функция | 0x80, код ошибки, CRC-16.
+// Регистры передаются старшим байтом вперед, CRC - младшим.
+
+const (
+	modbusFuncHolding = 0x03 // Чтение holding регистров
+	modbusFuncInput   = 0x04 // Чтение input регистров
+	modbusException   = 0x80
+
+	modbusScanBlock = 16 // регистров в одном запросе при сканировании
+)
+
+// Коды ошибок в ответе
+var modbusExceptions = map[byte]string{
+	0x01: "Функция не поддерживается",
+	0x02: "Недопустимый адрес регистра",
+	0x03: "Недопустимое значение",
+	0x04: "Отказ устройства",
+	0x05: "Запрос принят, выполняется долго",
+	0x06: "Устройство занято",
+	0x08: "Ошибка памяти",
+	0x0A: "Шлюз: путь недоступен",
+	0x0B: "Шлюз: устройство не отвечает",
+}
+
+// Ошибка, которую вернуло устройство
+type modbusError byte
+
+func (e modbusError) Error() string {
+	if text, ok := modbusExceptions[byte(e)]; ok {
+		return fmt.Sprintf("%s (код %d)", text, byte(e))
+	}
+	return fmt.Sprintf("Ошибка Modbus, код %d", byte(e))
+}
+
+// Формат значения в регистрах
+type ModbusFormat int
+
+const (
+	ModbusInt16   ModbusFormat = iota // 1 регистр со знаком
+	ModbusUint16                      // 1 регистр без знака
+	ModbusInt32                       // 2 регистра со знаком
+	ModbusUint32                      // 2 регистра без знака
+	ModbusFloat32                     // 2 регистра, IEEE 754
+)
+
+var modbusFormatCodes = map[ModbusFormat]string{
+	ModbusInt16:   "int16",
+	ModbusUint16:  "uint16",
+	ModbusInt32:   "int32",
+	ModbusUint32:  "uint32",
+	ModbusFloat32: "float32",
+}
+
+func (f ModbusFormat) String() string {
+	return modbusFormatCodes[f]
+}
+
+// Количество регистров под значение
+func (f ModbusFormat) Registers() int {
+	if f == ModbusInt16 || f == ModbusUint16 {
+		return 1
+	}
+	return 2
+}
+
+func ParseModbusFormat(s string) (ModbusFormat, error) {
+	for f, code := range modbusFormatCodes {
+		if strings.EqualFold(code, s) {
+			return f, nil
+		}
+	}
+	return ModbusInt16, fmt.Errorf("неизвестный формат регистров %q", s)
+}
+
+// Карта регистров: где и в каком виде устройство публикует вес
+type ModbusSettings struct {
+	Slave    byte         // Адрес устройства, 1-247
+	Function byte         // 3 - holding регистры, 4 - input регистры
+	Address  uint16       // Адрес первого регистра
+	Format   ModbusFormat // Формат значения
+	WordSwap bool         // Младшее слово первым (CDAB) для 32-битных значений
+	Decimals int          // Знаков после запятой
+	Unit     string       // Единица измерения
+}
+
+func DefaultModbusSettings() ModbusSettings {
+	return ModbusSettings{Slave: 1, Function: modbusFuncHolding, Format: ModbusInt32, Unit: "kg"}
+}
+
+// Порядок слов для вывода
+func (s ModbusSettings) WordOrder() string {
+	if s.WordSwap {
+		return "CDAB"
+	}
+	return "ABCD"
+}
+
+// Кратко для заголовков: "устройство 1, 03:0000, int32 ABCD, 3 знака, kg"
+func (s ModbusSettings) String() string {
+	res := fmt.Sprintf("устройство %d, %02d:%04d, %s", s.Slave, s.Function, s.Address, s.Format)
+	if s.Format.Registers() > 1 {
+		res += " " + s.WordOrder()
+	}
+	return fmt.Sprintf("%s, знаков: %d, %s", res, s.Decimals, s.Unit)
+}
+
+// Задает параметр карты регистров по имени: slave, function, address, format, order, decimals, unit.
+// Адрес можно указать в HEX с префиксом 0x.
+func (s *ModbusSettings) Set(name, value string) error {
+	switch strings.ToLower(name) {
+	case "slave":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 247 {
+			return fmt.Errorf("неверный адрес устройства Modbus %q", value)
+		}
+		s.Slave = byte(n)
+	case "function":
+		n, err := strconv.Atoi(value)
+		if err != nil || n != modbusFuncHolding && n != modbusFuncInput {
+			return fmt.Errorf("неверная функция Modbus %q, доступны 3 и 4", value)
+		}
+		s.Function = byte(n)
+	case "address":
+		n, err := strconv.ParseUint(value, 0, 16)
+		if err != nil {
+			return fmt.Errorf("неверный адрес регистра %q", value)
+		}
+		s.Address = uint16(n)
+	case "format":
+		f, err := ParseModbusFormat(value)
+		if err != nil {
+			return err
+		}
+		s.Format = f
+	case "order":
+		switch strings.ToUpper(value) {
+		case "ABCD":
+			s.WordSwap = false
+		case "CDAB":
+			s.WordSwap = true
+		default:
+			return fmt.Errorf("неверный порядок слов %q, доступны ABCD и CDAB", value)
+		}
+	case "decimals":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 6 {
+			return fmt.Errorf("неверное количество знаков после запятой %q", value)
+		}
+		s.Decimals = n
+	case "unit":
+		s.Unit = value
+	default:
+		return fmt.Errorf("неизвестный параметр Modbus %q", name)
+	}
+	return nil
+}
+
+// Представление в файле настроек
+type modbusSettingsJSON struct {
+	Slave    int    `json:"slave"`
+	Function int    `json:"function"`
+	Address  int    `json:"address"`
+	Format   string `json:"format"`
+	Order    string `json:"order"`
+	Decimals int    `json:"decimals"`
+	Unit     string `json:"unit"`
+}
+
+func (s ModbusSettings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(modbusSettingsJSON{
+		Slave:    int(s.Slave),
+		Function: int(s.Function),
+		Address:  int(s.Address),
+		Format:   s.Format.String(),
+		Order:    s.WordOrder(),
+		Decimals: s.Decimals,
+		Unit:     s.Unit,
+	})
+}
+
+func (s *ModbusSettings) UnmarshalJSON(data []byte) error {
+	v := modbusSettingsJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	values := [][2]string{
+		{"format", v.Format},
+		{"order", v.Order},
+		{"unit", v.Unit},
+	}
+	if v.Slave != 0 {
+		values = append(values, [2]string{"slave", strconv.Itoa(v.Slave)})
+	}
+	if v.Function != 0 {
+		values = append(values, [2]string{"function", strconv.Itoa(v.Function)})
+	}
+	values = append(values,
+		[2]string{"address", strconv.Itoa(v.Address)},
+		[2]string{"decimals", strconv.Itoa(v.Decimals)})
+
+	for _, nv := range values {
+		if nv[1] == "" {
+			continue
+		}
+		if err := s.Set(nv[0], nv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Карта регистров устройства: заданная пользователем или по умолчанию
+func (d *Device) ModbusSettings() ModbusSettings {
+	if d.Modbus != nil {
+		return *d.Modbus
+	}
+	return DefaultModbusSettings()
+}
+
+// Задает карту регистров
+func (d *Device) SetModbusSettings(s ModbusSettings) {
+	d.Modbus = &s
+}
+
+// CRC-16 Modbus: полином 0xA001, начальное значение 0xFFFF
+func modbusCRC(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Запрос чтения регистров с CRC
+func modbusReadRequest(slave, function byte, address uint16, count int) []byte {
+	frame := []byte{slave, function}
+	frame = binary.BigEndian.AppendUint16(frame, address)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(count))
+	return binary.LittleEndian.AppendUint16(frame, modbusCRC(frame))
+}
+
+// Ищет в буфере ответ устройства slave на функцию function.
+// Возвращает регистры или код ошибки устройства. Байты, с которых ответ начаться не может, пропускаются.
+func nextModbusResponse(buf []byte, slave, function byte, stats *FrameStats) ([]uint16, byte, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+		if len(rest) < 5 {
+			return nil, 0, used, false
+		}
+		if rest[0] != slave || rest[1]&^modbusException != function {
+			stats.SkippedBytes++
+			used++
+			continue
+		}
+
+		size := 5
+		if rest[1] == function {
+			size = 3 + int(rest[2]) + 2
+			if rest[2]%2 != 0 {
+				stats.FramingErrors++
+				used++
+				continue
+			}
+		}
+		if len(rest) < size {
+			return nil, 0, used, false
+		}
+
+		frame := rest[:size]
+		if binary.LittleEndian.Uint16(frame[size-2:]) != modbusCRC(frame[:size-2]) {
+			stats.ChecksumErrors++
+			used++
+			continue
+		}
+		stats.Frames++
+
+		if frame[1]&modbusException != 0 {
+			return nil, frame[2], used + size, true
+		}
+		regs := make([]uint16, frame[2]/2)
+		for i := range regs {
+			regs[i] = binary.BigEndian.Uint16(frame[3+2*i:])
+		}
+		return regs, 0, used + size, true
+	}
+}
+
+// Читает count регистров начиная с address.
+// Ошибку устройства возвращает как modbusError, при отсутствии ответа - nil, nil.
+func (d *Device) modbusRead(s ModbusSettings, address uint16, count int) ([]uint16, error) {
+	var regs []uint16
+	var exception byte
+	received := false
+	_, err := d.requestFrame(modbusReadRequest(s.Slave, s.Function, address, count), func() (string, bool) {
+		var used int
+		regs, exception, used, received = nextModbusResponse(d.rx, s.Slave, s.Function, &d.Stats)
+		d.rx = d.rx[used:]
+		return "", received
+	})
+	if err != nil || !received {
+		return nil, err
+	}
+	if exception != 0 {
+		return nil, modbusError(exception)
+	}
+	if len(regs) != count {
+		d.Stats.FramingErrors++
+		return nil, nil
+	}
+	return regs, nil
+}
+
+// Значение из регистров по формату карты
+func decodeModbusValue(regs []uint16, s ModbusSettings) (Decimal, error) {
+	var raw uint32
+	if s.Format.Registers() == 1 {
+		raw = uint32(regs[0])
+	} else if s.WordSwap {
+		raw = uint32(regs[1])<<16 | uint32(regs[0])
+	} else {
+		raw = uint32(regs[0])<<16 | uint32(regs[1])
+	}
+
+	var value int64
+	switch s.Format {
+	case ModbusInt16:
+		value = int64(int16(raw))
+	case ModbusUint16, ModbusUint32:
+		value = int64(raw)
+	case ModbusInt32:
+		value = int64(int32(raw))
+	case ModbusFloat32:
+		f := float64(math.Float32frombits(raw))
+		if math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) > 1e12 {
+			return Decimal{}, fmt.Errorf("неверное значение float32 0x%08X", raw)
+		}
+		return NewDecimal(int64(math.Round(f*math.Pow10(s.Decimals))), s.Decimals), nil
+	}
+	return NewDecimal(value, s.Decimals), nil
+}
+
+// Чтение веса Modbus RTU по карте регистров
+func startReadWeightModbus(d *Device) (string, error) {
+	s := d.ModbusSettings()
+	regs, err := d.modbusRead(s, s.Address, s.Format.Registers())
+	if e, ok := err.(modbusError); ok {
+		return e.Error(), nil
+	}
+	if err != nil || regs == nil {
+		return "", err
+	}
+
+	weight, err := decodeModbusValue(regs, s)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	// Признака стабильности в карте нет: вес стабилен, если совпадает с предыдущим
+	r := Reading{Weight: weight, Unit: s.Unit, Zero: weight.IsZero()}
+	r.Stable = d.prevReading != nil && d.prevReading.Weight == r.Weight
+	for _, v := range regs {
+		r.Raw = binary.BigEndian.AppendUint16(r.Raw, v)
+	}
+	return d.setReading(r)
+}
+
+// Прочитанный при сканировании регистр
+type ModbusRegister struct {
+	Address uint16
+	Value   uint16
+}
+
+// Читает регистры с from по to включительно функцией из карты регистров.
+// Блоки, на которые устройство ответило ошибкой, дочитываются по одному регистру,
+// недоступные регистры пропускаются. progress вызывается с адресом очередного запроса.
+func (d *Device) ModbusScan(from, to uint16, progress func(address uint16)) ([]ModbusRegister, error) {
+	if d.transport == nil {
+		return nil, d.fail("Устройство не подключено")
+	}
+	if to < from {
+		return nil, d.fail("Конец диапазона меньше начала")
+	}
+
+	s := d.ModbusSettings()
+	result := []ModbusRegister{}
+	answered := false
+
+	read := func(address uint16, count int) ([]uint16, error) {
+		if progress != nil {
+			progress(address)
+		}
+		regs, err := d.modbusRead(s, address, count)
+		if _, ok := err.(modbusError); ok {
+			answered = true
+			return nil, nil
+		}
+		if regs != nil {
+			answered = true
+		}
+		return regs, err
+	}
+
+	for address := int(from); address <= int(to); address += modbusScanBlock {
+		count := min(modbusScanBlock, int(to)-address+1)
+		regs, err := read(uint16(address), count)
+		if err != nil {
+			return nil, err
+		}
+		if regs != nil {
+			for i, v := range regs {
+				result = append(result, ModbusRegister{uint16(address + i), v})
+			}
+			continue
+		}
+
+		// Первый блок без ответа - устройство не отвечает вовсе
+		if !answered {
+			return nil, d.fail(fmt.Sprintf("Нет ответа от устройства %d", s.Slave))
+		}
+		for i := 0; i < count; i++ {
+			regs, err := read(uint16(address+i), 1)
+			if err != nil {
+				return nil, err
+			}
+			if regs != nil {
+				result = append(result, ModbusRegister{uint16(address + i), regs[0]})
+			}
+		}
+	}
+	return result, nil
+}
+
+// Ищет среди прочитанных регистров известный вес во всех форматах, порядках слов
+// и положениях запятой. Возвращает подходящие карты регистров на основе base.
+func FindModbusWeight(regs []ModbusRegister, weight Decimal, base ModbusSettings) []ModbusSettings {
+	values := map[uint16]uint16{}
+	for _, r := range regs {
+		values[r.Address] = r.Value
+	}
+
+	result := []ModbusSettings{}
+	for _, r := range regs {
+		for format := ModbusInt16; format <= ModbusFloat32; format++ {
+			for _, swap := range []bool{false, true} {
+				if swap && format.Registers() == 1 {
+					continue
+				}
+
+				data := []uint16{r.Value}
+				if format.Registers() == 2 {
+					next, ok := values[r.Address+1]
+					if !ok {
+						continue
+					}
+					data = append(data, next)
+				}
+
+				// У float положение запятой не задается, берем точность искомого веса
+				decimals := []int{0, 1, 2, 3, 4}
+				if format == ModbusFloat32 {
+					decimals = []int{weight.Scale}
+				}
+
+				for _, dec := range decimals {
+					s := base
+					s.Address, s.Format, s.WordSwap, s.Decimals = r.Address, format, swap, dec
+					if v, err := decodeModbusValue(data, s); err == nil && v.Equal(weight) {
+						result = append(result, s)
+					}
+				}
+			}
+		}
+	}
+	return result
+}
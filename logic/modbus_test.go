@@ -0,0 +1,65 @@
+package logic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestModbusCRC(t *testing.T) {
+	tests := []struct {
+		data string
+		want uint16
+	}{
+		{"123456789", 0x4B37},
+		{"\x01\x03\x00\x00\x00\x01", 0x0A84},
+		{"\x01\x03\x00\x00\x00\x0A", 0xCDC5},
+	}
+	for _, tt := range tests {
+		if got := modbusCRC([]byte(tt.data)); got != tt.want {
+			t.Errorf("modbusCRC(% X) = %04X, нужно %04X", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestModbusReadRequest(t *testing.T) {
+	want := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xCD}
+	if got := modbusReadRequest(1, 3, 0, 10); !bytes.Equal(got, want) {
+		t.Errorf("modbusReadRequest = % X, нужно % X", got, want)
+	}
+}
+
+func TestDecodeModbusValue(t *testing.T) {
+	tests := []struct {
+		regs     []uint16
+		format   ModbusFormat
+		wordSwap bool
+		decimals int
+		want     Decimal
+	}{
+		{[]uint16{0x04E2}, ModbusUint16, false, 2, NewDecimal(1250, 2)},
+		{[]uint16{0xFF38}, ModbusInt16, false, 1, NewDecimal(-200, 1)},
+		{[]uint16{0xFF38}, ModbusUint16, false, 0, NewDecimal(65336, 0)},
+		{[]uint16{0x0001, 0x86A0}, ModbusInt32, false, 3, NewDecimal(100000, 3)},
+		{[]uint16{0x86A0, 0x0001}, ModbusInt32, true, 3, NewDecimal(100000, 3)},
+		{[]uint16{0xFFFF, 0xFFFE}, ModbusInt32, false, 0, NewDecimal(-2, 0)},
+		{[]uint16{0xFFFF, 0xFFFE}, ModbusUint32, false, 0, NewDecimal(0xFFFFFFFE, 0)},
+		{[]uint16{0x3FA0, 0x0000}, ModbusFloat32, false, 2, NewDecimal(125, 2)},
+		{[]uint16{0x0000, 0xBFA0}, ModbusFloat32, true, 3, NewDecimal(-1250, 3)},
+	}
+	for _, tt := range tests {
+		s := ModbusSettings{Format: tt.format, WordSwap: tt.wordSwap, Decimals: tt.decimals}
+		got, err := decodeModbusValue(tt.regs, s)
+		if err != nil {
+			t.Errorf("%v %04X: %v", tt.format, tt.regs, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%v %04X: %s, нужно %s", tt.format, tt.regs, got, tt.want)
+		}
+	}
+
+	// NaN весом не считается
+	if _, err := decodeModbusValue([]uint16{0x7FC0, 0x0000}, ModbusSettings{Format: ModbusFloat32}); err == nil {
+		t.Error("NaN: нет ошибки")
+	}
+}
@@ -0,0 +1,465 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Протокол Mettler Toledo MT-SICS, уровни 0 и 1.
+//
+// Команды и ответы - строки ASCII, заканчивающиеся CR LF:
+//
+//	S     ->  S S      12.345 kg    стабильный вес
+//	SI    ->  S D      12.340 kg    вес сразу, D - нестабильный
+//	SIR   ->  непрерывно ответы как на SI, до команды @
+//	Z     ->  Z A                   ноль установлен
+//	T     ->  T S       0.500 kg    тара
+//	TA    ->  TA A      0.500 kg    текущая тара
+//	I2    ->  I2 A "XS205 220.000 g"
+//	I4    ->  I4 A "B021002593"
+//
+// Второе поле - статус: S/D - стабильно/нестабильно, A - выполнено, B - будут еще ответы,
+// I - команда не может быть выполнена (весы заняты), L - неверный параметр,
+// + и - - перегрузка и недогрузка. Ответы ES, ET и EL без статуса - ошибка синтаксиса,
+// ошибка передачи и логическая ошибка.
+
+const (
+	mtsicsMaxLine        = 64              // строки длиннее - мусор
+	mtsicsCommandTimeout = 3 * time.Second // ноль и тара ждут успокоения веса
+)
+
+// Строка ответа MT-SICS, разобранная на поля
+type mtsicsResponse struct {
+	ID     string   // Идентификатор команды: S, Z, T, TA, I2...
+	Status string   // Статус ответа, пусто для ES, ET, EL
+	Values []string // Остальные поля, строки в кавычках без кавычек
+}
+
+// Ответы об ошибке без статуса
+var mtsicsErrors = map[string]string{
+	"ES": "Весы не распознали команду (ES)",
+	"ET": "Ошибка передачи, весы не приняли команду (ET)",
+	"EL": "Логическая ошибка, команда не может быть выполнена (EL)",
+}
+
+// Разбивает строку на поля по пробелам. Строка в кавычках - одно поле
+func splitMTSICS(line string) []string {
+	fields := []string{}
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return fields
+		}
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return append(fields, line[1:])
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			return append(fields, line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+}
+
+// Разбирает строку ответа без CR LF
+func parseMTSICSLine(line string) (mtsicsResponse, error) {
+	var r mtsicsResponse
+
+	fields := splitMTSICS(line)
+	if len(fields) == 0 {
+		return r, fmt.Errorf("пустой ответ MT-SICS")
+	}
+
+	r.ID = fields[0]
+	for _, c := range r.ID {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return r, fmt.Errorf("неверный идентификатор MT-SICS %q", r.ID)
+		}
+	}
+	if _, ok := mtsicsErrors[r.ID]; ok {
+		if len(fields) > 1 {
+			return r, fmt.Errorf("лишние поля в ответе MT-SICS %q", line)
+		}
+		return r, nil
+	}
+
+	if len(fields) < 2 {
+		return r, fmt.Errorf("нет статуса в ответе MT-SICS %q", line)
+	}
+	r.Status = fields[1]
+	switch r.Status {
+	case "S", "D", "A", "B", "I", "L", "+", "-":
+	default:
+		return r, fmt.Errorf("неверный статус MT-SICS %q", r.Status)
+	}
+	r.Values = fields[2:]
+	return r, nil
+}
+
+// Ищет в буфере следующую целую строку ответа
+func nextMTSICSLine(buf []byte, stats *FrameStats) (mtsicsResponse, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			if len(rest) > mtsicsMaxLine {
+				// Конца строки нет слишком долго - выбрасываем
+				stats.FramingErrors++
+				stats.SkippedBytes += len(rest)
+				return mtsicsResponse{}, len(buf), false
+			}
+			return mtsicsResponse{}, used, false
+		}
+		used += end + 1
+
+		line := strings.TrimRight(string(rest[:end]), "\r")
+		if strings.TrimSpace(line) == "" {
+			stats.SkippedBytes += end + 1
+			continue
+		}
+		r, err := parseMTSICSLine(line)
+		if err != nil {
+			stats.FramingErrors++
+			continue
+		}
+		stats.Frames++
+		return r, used, true
+	}
+}
+
+// Текст ошибки, если ответ сообщает об ошибке, иначе пустая строка.
+// Перегрузка и недогрузка в ответах на запрос веса - не ошибка, а показание.
+func mtsicsErrorText(r mtsicsResponse) string {
+	if text, ok := mtsicsErrors[r.ID]; ok {
+		return text
+	}
+	switch r.Status {
+	case "I":
+		return fmt.Sprintf("Команда не может быть выполнена, весы заняты (%s I)", r.ID)
+	case "L":
+		return fmt.Sprintf("Неверный параметр команды (%s L)", r.ID)
+	case "+":
+		return fmt.Sprintf("Превышен верхний предел диапазона (%s +)", r.ID)
+	case "-":
+		return fmt.Sprintf("Превышен нижний предел диапазона (%s -)", r.ID)
+	}
+	return ""
+}
+
+// Вес из ответа на S, SI, SIR, T или TA
+func decodeMTSICSWeight(r mtsicsResponse) (Reading, error) {
+	reading := Reading{}
+	switch r.Status {
+	case "+":
+		reading.Overload = true
+		return reading, nil
+	case "-":
+		reading.Underload = true
+		return reading, nil
+	case "S", "A":
+		reading.Stable = true
+	case "D":
+	default:
+		return reading, fmt.Errorf("%s", mtsicsErrorText(r))
+	}
+
+	if len(r.Values) < 2 {
+		return reading, fmt.Errorf("нет веса в ответе MT-SICS")
+	}
+	weight, err := ParseDecimal(r.Values[0])
+	if err != nil {
+		return reading, fmt.Errorf("неверный вес MT-SICS %q", r.Values[0])
+	}
+	reading.Weight = weight
+	reading.Unit = r.Values[1]
+	reading.Zero = weight.IsZero()
+	return reading, nil
+}
+
+// Разбирает накопленные строки до ответа с весом.
+// Если весы ответили ошибкой, возвращается ее текст без показания.
+func (d *Device) takeMTSICSWeight() (string, bool) {
+	for {
+		r, used, ok := nextMTSICSLine(d.rx, &d.Stats)
+		raw := d.rx[:used]
+		d.rx = d.rx[used:]
+		if !ok {
+			return "", false
+		}
+		if r.ID != "S" && mtsicsErrors[r.ID] == "" {
+			// Ответ на другую команду, например на @ при остановке SIR
+			continue
+		}
+
+		reading, err := decodeMTSICSWeight(r)
+		if err != nil {
+			return err.Error(), true
+		}
+		reading.Raw = append([]byte(nil), bytes.TrimLeft(raw, "\r\n")...)
+		str, _ := d.setReading(reading)
+		return str, true
+	}
+}
+
+// Отправляет строку команды с CR LF
+func (d *Device) mtsicsWrite(cmd string) error {
+	if _, err := d.transport.Write([]byte(cmd + "\r\n")); err != nil {
+		d.LastError = err.Error()
+		return err
+	}
+	return nil
+}
+
+// Запрос веса командой S или SI
+func (d *Device) mtsicsReadWeight(cmd string) (string, error) {
+	return d.requestFrame([]byte(cmd+"\r\n"), d.takeMTSICSWeight)
+}
+
+// Чтение веса MT-SICS: SI, вес сразу, стабильный или нет
+func startReadWeightMTSICS(d *Device) (string, error) {
+	return d.mtsicsReadWeight("SI")
+}
+
+// Чтение веса MT-SICS: S, весы отвечают, когда вес успокоится
+func startReadWeightMTSICSStable(d *Device) (string, error) {
+	return d.mtsicsReadWeight("S")
+}
+
+// Чтение веса MT-SICS: непрерывная передача, включенная командой SIR при подключении
+func startReadWeightMTSICSContinuous(d *Device) (string, error) {
+	return d.readFrames(d.takeMTSICSWeight)
+}
+
+// Включает непрерывную передачу веса
+func startMTSICSContinuous(d *Device) error {
+	return d.mtsicsWrite("SIR")
+}
+
+// Останавливает непрерывную передачу: @ сбрасывает весы в исходное состояние
+func stopMTSICSContinuous(d *Device) {
+	d.mtsicsWrite("@")
+}
+
+// Отправляет команду и ждет ответа на нее. Ответы с ошибкой возвращаются как ошибка
+func (d *Device) mtsicsCommand(cmd string) (mtsicsResponse, error) {
+	if d.transport == nil {
+		return mtsicsResponse{}, d.fail("Весы не подключены")
+	}
+
+	timeout := d.PortSettings().ReadTimeout
+	d.transport.SetReadTimeout(max(timeout, mtsicsCommandTimeout))
+	defer d.transport.SetReadTimeout(timeout)
+
+	d.rx = nil
+	if err := d.mtsicsWrite(cmd); err != nil {
+		return mtsicsResponse{}, err
+	}
+
+	id := strings.Fields(cmd)[0]
+	for {
+		r, used, ok := nextMTSICSLine(d.rx, &d.Stats)
+		d.rx = d.rx[used:]
+		if ok {
+			if text := mtsicsErrorText(r); text != "" && (r.ID == id || r.Status == "") {
+				return r, d.fail(text)
+			}
+			if r.ID == id {
+				return r, nil
+			}
+			continue
+		}
+
+		n, err := d.readMore()
+		if err != nil {
+			return mtsicsResponse{}, err
+		}
+		if n == 0 {
+			return mtsicsResponse{}, d.fail("Нет ответа от весов")
+		}
+	}
+}
+
+// Установка нуля
+func (d *Device) MTSICSZero() error {
+	_, err := d.mtsicsCommand("Z")
+	return err
+}
+
+// Тара: текущий вес становится тарой. Возвращает массу тары
+func (d *Device) MTSICSTare() (Reading, error) {
+	r, err := d.mtsicsCommand("T")
+	if err != nil {
+		return Reading{}, err
+	}
+	return d.mtsicsTareReading(r)
+}
+
+// Запрос текущей тары
+func (d *Device) MTSICSTareValue() (Reading, error) {
+	r, err := d.mtsicsCommand("TA")
+	if err != nil {
+		return Reading{}, err
+	}
+	return d.mtsicsTareReading(r)
+}
+
+// Сброс тары
+func (d *Device) MTSICSClearTare() error {
+	_, err := d.mtsicsCommand("TAC")
+	return err
+}
+
+func (d *Device) mtsicsTareReading(r mtsicsResponse) (Reading, error) {
+	reading, err := decodeMTSICSWeight(r)
+	if err != nil {
+		return Reading{}, d.fail(err.Error())
+	}
+	reading.Mode = WeightTare
+	return reading, nil
+}
+
+// Модель и серийный номер весов MT-SICS
+type MTSICSInfo struct {
+	Model  string // Тип весов и предел взвешивания, ответ на I2
+	Serial string // Серийный номер, ответ на I4
+}
+
+// Запрос модели (I2) и серийного номера (I4)
+func (d *Device) MTSICSInfo() (*MTSICSInfo, error) {
+	info := &MTSICSInfo{}
+	for _, q := range []struct {
+		cmd   string
+		value *string
+	}{{"I2", &info.Model}, {"I4", &info.Serial}} {
+		r, err := d.mtsicsCommand(q.cmd)
+		if err != nil {
+			return nil, err
+		}
+		*q.value = strings.Join(r.Values, " ")
+	}
+	return info, nil
+}
+
+// Строка ответа эмулятора с весом: "S S      12.34 kg"
+func mtsicsWeightLine(id, status string, weight Decimal) string {
+	return fmt.Sprintf("%s %s %10s kg\r\n", id, status, weight)
+}
+
+// Ответ эмулятора MT-SICS на одну команду
+func (e *emulator) mtsicsAnswer(cmd string) string {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return "ES\r\n"
+	}
+
+	switch fields[0] {
+	case "S":
+		s := e.next()
+		if s.Overload {
+			return "S +\r\n"
+		}
+		return mtsicsWeightLine("S", "S", e.net(s.Weight))
+	case "SI", "SIR":
+		e.stream = fields[0] == "SIR"
+		return e.mtsicsImmediate()
+	case "@":
+		e.reset()
+		return "I4 A \"0123456789\"\r\n"
+	case "Z":
+		e.zero = e.current.Weight
+		e.tare = Decimal{}
+		return "Z A\r\n"
+	case "T":
+		// Тара - весь вес на платформе от нуля, прежняя тара не вычитается
+		e.tare = NewDecimal(e.current.Weight.Value-e.zero.Value, emulatorScale)
+		return mtsicsWeightLine("T", "S", e.tare)
+	case "TA":
+		if len(fields) > 1 {
+			// Предустановка тары: TA 1.25 kg
+			tare, err := ParseDecimal(fields[1])
+			if err != nil || tare.Scale > 2 {
+				return "TA L\r\n"
+			}
+			for tare.Scale < 2 {
+				tare = NewDecimal(tare.Value*10, tare.Scale+1)
+			}
+			e.tare = tare
+		}
+		return mtsicsWeightLine("TA", "A", e.tare)
+	case "TAC":
+		e.tare = Decimal{}
+		return "TAC A\r\n"
+	case "I2":
+		return "I2 A \"SAKDeviceToolbox 100.00 kg\"\r\n"
+	case "I4":
+		return "I4 A \"0123456789\"\r\n"
+	}
+	return "ES\r\n"
+}
+
+// Ответ на SI и очередная строка непрерывной передачи
+func (e *emulator) mtsicsImmediate() string {
+	s := e.next()
+	if s.Overload {
+		return "S +\r\n"
+	}
+	status := "D"
+	if s.Stable {
+		status = "S"
+	}
+	return mtsicsWeightLine("S", status, e.net(s.Weight))
+}
+
+// Эмуляция весов MT-SICS: отвечает на команды, в режиме SIR передает вес непрерывно
+func startEmulateMTSICS(d *Device) (string, error) {
+	// Команда целиком могла прийти в прошлый раз вместе с предыдущей
+	end := bytes.IndexByte(d.rx, '\n')
+	if end < 0 {
+		n, err := d.readMore()
+		if err != nil {
+			return "", err
+		}
+		if n > 0 {
+			end = bytes.IndexByte(d.rx, '\n')
+		}
+	}
+
+	answer := ""
+	request := ""
+	switch {
+	case end >= 0:
+		request = strings.TrimSpace(string(d.rx[:end]))
+		d.rx = d.rx[end+1:]
+		answer = d.emu.mtsicsAnswer(request)
+	case len(d.rx) > mtsicsMaxLine:
+		// Мусор без конца строки
+		d.rx = nil
+		answer = "ES\r\n"
+	case d.emu.stream:
+		answer = d.emu.mtsicsImmediate()
+	default:
+		return "", nil
+	}
+
+	faults, err := d.emulatorWrite([]byte(answer), -1)
+	if err != nil {
+		return "", err
+	}
+
+	answer = strings.TrimSpace(answer) + faults
+	if request != "" {
+		return request + " -> " + answer, nil
+	}
+	return answer, nil
+}
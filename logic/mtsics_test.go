@@ -0,0 +1,23 @@
+package logic
+
+import "testing"
+
+// Повторная тара при уже установленной - весь вес на платформе, а не нетто
+func TestMTSICSTareTwice(t *testing.T) {
+	weight := NewDecimal(125, emulatorScale)
+	d := emulatorPair(t, EmulatorMTSICS, ScalesMTSICS, weight)
+	readWeight(t, d)
+
+	for i := 0; i < 2; i++ {
+		tare, err := d.MTSICSTare()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tare.Weight != weight {
+			t.Errorf("тара %d: %s, нужно %s", i+1, tare.Weight, weight)
+		}
+		if r := readWeight(t, d); !r.Weight.IsZero() {
+			t.Errorf("тара %d: вес %s, нужно 0", i+1, r.Weight)
+		}
+	}
+}
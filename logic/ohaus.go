@@ -0,0 +1,80 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Протокол Ohaus (Defender, Ranger, Valor, Scout и совместимые):
+//
+//	"      1.234 kg   \r\n"     стабильно
+//	"      1.234 kg ? N\r\n"    нестабильно, нетто
+//
+// После единицы измерения: ? - вес не успокоился, N/NET - нетто, G - брутто, T - тара.
+//
+// Запрос веса - IP CR LF (сразу, стабильный или нет). Непрерывная передача
+// включается командой CP и выключается 0P.
+
+const ohausMaxFrame = 40
+
+// Разбирает одну строку Ohaus без CR LF
+func decodeOhausFrame(line []byte) (Reading, error) {
+	r := Reading{Stable: true}
+	text := string(line)
+
+	// Перегрузку и ошибки Ohaus выводит текстом вместо веса
+	upper := strings.ToUpper(text)
+	if strings.Contains(upper, "OL") || strings.Contains(upper, "OVER") {
+		r.Overload = true
+		return r, nil
+	}
+	if strings.Contains(upper, "UL") || strings.Contains(upper, "UNDER") {
+		r.Underload = true
+		return r, nil
+	}
+
+	weight, unit, ok := parseWeightText(text)
+	if !ok || unit == "" {
+		return r, fmt.Errorf("нет веса Ohaus в %q", text)
+	}
+	r.Weight = weight
+	r.Unit = unit
+	r.Zero = weight.IsZero()
+
+	// Признаки после единицы измерения
+	fields := strings.Fields(text)
+	for i := len(fields) - 1; i >= 0 && !strings.EqualFold(fields[i], unit); i-- {
+		switch strings.ToUpper(fields[i]) {
+		case "?":
+			r.Stable = false
+		case "N", "NET":
+			r.Mode = WeightNet
+		case "T":
+			r.Mode = WeightTare
+		case "G":
+		default:
+			return r, fmt.Errorf("неизвестный признак Ohaus %q", fields[i])
+		}
+	}
+	return r, nil
+}
+
+// Чтение веса Ohaus по запросу
+func startReadWeightOhaus(d *Device) (string, error) {
+	return d.readTextFrameRequest([]byte("IP\r\n"), ohausMaxFrame, decodeOhausFrame)
+}
+
+// Чтение веса Ohaus непрерывная передача данных
+func startReadWeightOhausContinuous(d *Device) (string, error) {
+	return d.readTextFrameContinuous(ohausMaxFrame, decodeOhausFrame)
+}
+
+// Включает непрерывную передачу Ohaus
+func startOhausContinuous(d *Device) error {
+	return d.writeCommand("CP\r\n")
+}
+
+// Выключает непрерывную передачу Ohaus
+func stopOhausContinuous(d *Device) {
+	d.writeCommand("0P\r\n")
+}
@@ -0,0 +1,205 @@
+package logic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Десятичное число без потерь точности: Value * 10^-Scale.
+// Весы передают вес с фиксированной точкой, float здесь только мешает.
+type Decimal struct {
+	Value int64
+	Scale int // количество знаков после запятой
+}
+
+// Разбирает число вида "-12.340" или "  0012,5". Пробелы по краям игнорируются
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Decimal{}, fmt.Errorf("пустое число")
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = strings.TrimSpace(s[1:])
+	case '+':
+		s = strings.TrimSpace(s[1:])
+	}
+
+	var d Decimal
+	point := false
+	digits := 0
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			d.Value = d.Value*10 + int64(c-'0')
+			digits++
+			if point {
+				d.Scale++
+			}
+		case (c == '.' || c == ',') && !point:
+			point = true
+		default:
+			return Decimal{}, fmt.Errorf("неверное число %q", s)
+		}
+	}
+	if digits == 0 {
+		return Decimal{}, fmt.Errorf("неверное число %q", s)
+	}
+
+	if negative {
+		d.Value = -d.Value
+	}
+	return d, nil
+}
+
+// Число с заданным количеством знаков после запятой: NewDecimal(1234, 2) = 12.34
+func NewDecimal(value int64, scale int) Decimal {
+	return Decimal{Value: value, Scale: scale}
+}
+
+func (d Decimal) String() string {
+	if d.Scale <= 0 {
+		return strconv.FormatInt(d.Value, 10)
+	}
+
+	sign := ""
+	v := d.Value
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	s := strconv.FormatInt(v, 10)
+	for len(s) <= d.Scale {
+		s = "0" + s
+	}
+	return sign + s[:len(s)-d.Scale] + "." + s[len(s)-d.Scale:]
+}
+
+func (d Decimal) Float64() float64 {
+	f := float64(d.Value)
+	for i := 0; i < d.Scale; i++ {
+		f /= 10
+	}
+	return f
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Value == 0
+}
+
+// Равенство значений независимо от количества знаков: 1.50 == 1.5
+func (d Decimal) Equal(o Decimal) bool {
+	a, b := d.Value, o.Value
+	for scale := d.Scale; scale < o.Scale; scale++ {
+		a *= 10
+	}
+	for scale := o.Scale; scale < d.Scale; scale++ {
+		b *= 10
+	}
+	return a == b
+}
+
+// Что показывает вес
+type WeightMode int
+
+const (
+	WeightGross WeightMode = iota // Брутто
+	WeightNet                     // Нетто
+	WeightTare                    // Тара
+)
+
+func (m WeightMode) String() string {
+	switch m {
+	case WeightNet:
+		return "нетто"
+	case WeightTare:
+		return "тара"
+	}
+	return "брутто"
+}
+
+// Показание весов
+type Reading struct {
+	Weight    Decimal
+	Unit      string // kg, g, lb
+	Stable    bool
+	Mode      WeightMode
+	Overload  bool    // Перегрузка
+	Underload bool    // Недогрузка (вес меньше минимального, отрицательный за пределом)
+	Zero      bool    // Весы в нуле
+	Tare      Decimal // Масса тары, если весы ее передают
+	Raw       []byte
+	Time      time.Time
+}
+
+// Строка для вывода оператору: "12.34 kg (стабильно, нетто)"
+func (r Reading) String() string {
+	if r.Overload {
+		return "Перегрузка"
+	}
+	if r.Underload {
+		return "Недогрузка"
+	}
+
+	flags := []string{}
+	if r.Stable {
+		flags = append(flags, "стабильно")
+	} else {
+		flags = append(flags, "нестабильно")
+	}
+	flags = append(flags, r.Mode.String())
+	if r.Zero {
+		flags = append(flags, "ноль")
+	}
+	if !r.Tare.IsZero() {
+		flags = append(flags, strings.TrimSpace("тара "+r.Tare.String()+" "+r.Unit))
+	}
+
+	weight := r.Weight.String()
+	if r.Unit != "" {
+		weight += " " + r.Unit
+	}
+	return fmt.Sprintf("%s (%s)", weight, strings.Join(flags, ", "))
+}
+
+// Запоминает показание весов и возвращает строку для вывода.
+// Используется обработчиками весов как результат Process.
+func (d *Device) setReading(r Reading) (string, error) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	d.LastReading = &r
+	d.prevReading = &r
+	return r.String(), nil
+}
+
+// Ищет в тексте вес с единицей измерения: "ST,GS,   -1.250kg" -> -1.250, "kg".
+// Для протоколов, где вес передается текстом.
+func parseWeightText(s string) (Decimal, string, bool) {
+	start := strings.IndexAny(s, "+-0123456789")
+	if start < 0 {
+		return Decimal{}, "", false
+	}
+
+	end := start + 1
+	for end < len(s) && strings.IndexByte(" .,0123456789", s[end]) >= 0 {
+		end++
+	}
+
+	weight, err := ParseDecimal(strings.ReplaceAll(s[start:end], " ", ""))
+	if err != nil {
+		return Decimal{}, "", false
+	}
+
+	unit := strings.TrimSpace(s[end:])
+	if i := strings.IndexAny(unit, " \r\n,"); i >= 0 {
+		unit = unit[:i]
+	}
+	return weight, strings.ToLower(unit), true
+}
@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Протокол Sartorius SBI.
+//
+// Запрос веса - ESC P. Ответ 16 символов (без идентификатора) или 22 (с идентификатором):
+//
+//	"+   12.345 g  \r\n"
+//	"N     +   12.345 g  \r\n"
+//
+// Знак, пробел, 8 символов веса, пробел, 3 символа единицы измерения. Пока вес не успокоился,
+// единица измерения не выводится. Идентификатор: G - брутто, N - нетто, T - тара.
+// Перегрузка и недогрузка выводятся словами High и Low вместо веса.
+//
+// Непрерывная передача (автоматическая печать) включается в меню весов, команды для нее нет.
+
+const (
+	sartoriusMaxFrame = 24
+	sartoriusDataLen  = 14 // строка без идентификатора и CR LF
+	sartoriusIDLen    = 6  // идентификатор в 22-символьном формате
+)
+
+// Разбирает одну строку Sartorius без CR LF
+func decodeSartoriusFrame(line []byte) (Reading, error) {
+	r := Reading{}
+	text := string(line)
+
+	// Идентификатор в первых 6 символах
+	if len(text) >= sartoriusIDLen+sartoriusDataLen {
+		id := strings.TrimSpace(text[:len(text)-sartoriusDataLen])
+		switch id {
+		case "G", "G#":
+		case "N", "NET":
+			r.Mode = WeightNet
+		case "T", "T1", "T2", "PT":
+			r.Mode = WeightTare
+		default:
+			return r, fmt.Errorf("неизвестный идентификатор Sartorius %q", id)
+		}
+		text = text[len(text)-sartoriusDataLen:]
+	}
+
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "high", "h":
+		r.Overload = true
+		return r, nil
+	case "low", "l":
+		r.Underload = true
+		return r, nil
+	}
+
+	weight, unit, ok := parseWeightText(text)
+	if !ok {
+		return r, fmt.Errorf("нет веса Sartorius в %q", text)
+	}
+	r.Weight = weight
+	r.Unit = unit
+	r.Stable = unit != ""
+	r.Zero = weight.IsZero()
+	return r, nil
+}
+
+// Чтение веса Sartorius по запросу
+func startReadWeightSartorius(d *Device) (string, error) {
+	return d.readTextFrameRequest([]byte{0x1B, 'P'}, sartoriusMaxFrame, decodeSartoriusFrame)
+}
+
+// Чтение веса Sartorius непрерывная передача данных
+func startReadWeightSartoriusContinuous(d *Device) (string, error) {
+	return d.readTextFrameContinuous(sartoriusMaxFrame, decodeSartoriusFrame)
+}
@@ -0,0 +1,186 @@
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Замер скорости сканирования. Время приходит не для каждого байта, а для каждой
+// порции, которую вернул порт, поэтому паузы между байтами - это паузы между порциями.
+// У USB-COM адаптеров порции идут не чаще таймера задержки драйвера (обычно 1-16 мс).
+
+const (
+	scanGapThreshold           = 50 * time.Millisecond // пауза больше - сканирование пришло частями
+	ScanDuplicateWindowDefault = time.Second           // повтор того же штрихкода за это время - дубль
+)
+
+// Одно сканирование в замере
+type ScanRecord struct {
+	Data      string        // штрихкод без терминатора
+	First     time.Time     // пришел первый байт
+	Last      time.Time     // пришел последний байт
+	Bytes     int           // байт с терминатором
+	Chunks    int           // порций, которыми пришло сканирование
+	MaxGap    time.Duration // самая длинная пауза внутри сканирования
+	Duplicate bool          // тот же штрихкод уже был в пределах окна повторов
+}
+
+// Длительность передачи сканирования
+func (r ScanRecord) Duration() time.Duration {
+	return r.Last.Sub(r.First)
+}
+
+// "12:03:04.123, 15 байт за 28ms, частей: 3, макс. пауза 12ms, ПОВТОР"
+func (r ScanRecord) String() string {
+	res := fmt.Sprintf("%s, %d байт за %s", r.First.Format("15:04:05.000"), r.Bytes, r.Duration().Round(time.Millisecond))
+	if r.Chunks > 1 {
+		res += fmt.Sprintf(", частей: %d, макс. пауза %s", r.Chunks, r.MaxGap.Round(time.Millisecond))
+	}
+	if r.MaxGap > scanGapThreshold {
+		res += ", РАЗРЫВ"
+	}
+	if r.Duplicate {
+		res += ", ПОВТОР"
+	}
+	return res
+}
+
+// Замер скорости сканирования за сессию
+type ScanBenchmark struct {
+	DuplicateWindow time.Duration // окно поиска повторов, 0 - по умолчанию
+	Records         []ScanRecord
+	Gaps            []time.Duration // паузы между порциями внутри сканирований
+
+	times      []time.Time // время прихода каждого еще не разобранного байта
+	terminated int         // сканирований с терминатором: по ним видно, что сканер его передает
+	held       bool        // хвост без терминатора ждет продолжения
+}
+
+// Окно повторов с учетом значения по умолчанию
+func (b *ScanBenchmark) window() time.Duration {
+	if b.DuplicateWindow > 0 {
+		return b.DuplicateWindow
+	}
+	return ScanDuplicateWindowDefault
+}
+
+// Запоминает время прихода порции из n байт
+func (b *ScanBenchmark) received(n int, at time.Time) {
+	for i := 0; i < n; i++ {
+		b.times = append(b.times, at)
+	}
+}
+
+// Сканирование без терминатора в конце могло прийти не целиком, если сканер передал его
+// с паузой длиннее таймаута чтения. Если сканер передает терминатор, хвост ждет следующего
+// чтения. Если за это время ничего не пришло - хвост разбирается как есть
+func (b *ScanBenchmark) waitRest(scans [][]byte, arrived bool) bool {
+	if len(scans) == 0 || len(scanTerminator(scans[len(scans)-1])) > 0 || b.terminated == 0 {
+		b.held = false
+		return false
+	}
+	if b.held && !arrived {
+		b.held = false
+		return false
+	}
+	b.held = true
+	return true
+}
+
+// Добавляет сканирование, которое начинается с байта offset среди неразобранных
+func (b *ScanBenchmark) add(scan []byte, offset int) ScanRecord {
+	times := b.times[offset : offset+len(scan)]
+	r := ScanRecord{
+		Data:   string(scan[:len(scan)-len(scanTerminator(scan))]),
+		First:  times[0],
+		Last:   times[len(times)-1],
+		Bytes:  len(scan),
+		Chunks: 1,
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap > 0 {
+			r.Chunks++
+			b.Gaps = append(b.Gaps, gap)
+			r.MaxGap = max(r.MaxGap, gap)
+		}
+	}
+	if len(scanTerminator(scan)) > 0 {
+		b.terminated++
+	}
+
+	for i := len(b.Records) - 1; i >= 0 && r.First.Sub(b.Records[i].First) <= b.window(); i-- {
+		if b.Records[i].Data == r.Data {
+			r.Duplicate = true
+			break
+		}
+	}
+
+	b.Records = append(b.Records, r)
+	return r
+}
+
+// Убирает время разобранных байт
+func (b *ScanBenchmark) consumed(n int) {
+	b.times = b.times[n:]
+}
+
+// Итог сессии
+func (b *ScanBenchmark) String() string {
+	if len(b.Records) == 0 {
+		return "Сканирований не было"
+	}
+
+	first, last := b.Records[0], b.Records[len(b.Records)-1]
+	lines := []string{}
+
+	session := last.Last.Sub(first.First)
+	line := fmt.Sprintf("Сканирований: %d за %s", len(b.Records), session.Round(100*time.Millisecond))
+	if len(b.Records) > 1 && session > 0 {
+		line += fmt.Sprintf(", %.1f в минуту", float64(len(b.Records)-1)/session.Minutes())
+	}
+	lines = append(lines, line)
+
+	durations := []time.Duration{}
+	intervals := []time.Duration{}
+	split, duplicates := 0, 0
+	for i, r := range b.Records {
+		durations = append(durations, r.Duration())
+		if i > 0 {
+			intervals = append(intervals, r.First.Sub(b.Records[i-1].First))
+		}
+		if r.MaxGap > scanGapThreshold {
+			split++
+		}
+		if r.Duplicate {
+			duplicates++
+		}
+	}
+
+	lines = append(lines, "Передача сканирования: "+durationStats(durations))
+	if len(intervals) > 0 {
+		lines = append(lines, "Между сканированиями: "+durationStats(intervals))
+	}
+	if len(b.Gaps) > 0 {
+		lines = append(lines, "Паузы внутри сканирований: "+durationStats(b.Gaps))
+	} else {
+		lines = append(lines, "Паузы внутри сканирований: нет, каждое сканирование пришло одной порцией")
+	}
+	lines = append(lines, fmt.Sprintf("Разорванных сканирований (пауза больше %s): %d", scanGapThreshold, split))
+	lines = append(lines, fmt.Sprintf("Повторов в пределах %s: %d", b.window(), duplicates))
+	return strings.Join(lines, "\n")
+}
+
+// "мин 1ms, сред 3ms, макс 12ms"
+func durationStats(values []time.Duration) string {
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum time.Duration
+	for _, v := range sorted {
+		sum += v
+	}
+	avg := sum / time.Duration(len(sorted))
+	return fmt.Sprintf("мин %s, сред %s, макс %s",
+		sorted[0].Round(time.Millisecond), avg.Round(time.Millisecond), sorted[len(sorted)-1].Round(time.Millisecond))
+}
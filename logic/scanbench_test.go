@@ -0,0 +1,132 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Сканирование, пришедшее порциями chunks в моменты at
+func benchScan(b *ScanBenchmark, scan string, chunks []int, at []time.Time) ScanRecord {
+	for i, n := range chunks {
+		b.received(n, at[i])
+	}
+	r := b.add([]byte(scan), 0)
+	b.consumed(len(scan))
+	return r
+}
+
+func TestScanBenchmarkAdd(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	ms := func(n int) time.Time { return start.Add(time.Duration(n) * time.Millisecond) }
+
+	b := &ScanBenchmark{}
+	// Одной порцией
+	r := benchScan(b, "4601234567893\r", []int{14}, []time.Time{ms(0)})
+	if r.Data != "4601234567893" || r.Bytes != 14 || r.Chunks != 1 || r.MaxGap != 0 || r.Duration() != 0 || r.Duplicate {
+		t.Errorf("одна порция: %+v", r)
+	}
+
+	// Тремя порциями с паузами 5 и 60 мс
+	r = benchScan(b, "TEST-128\r\n", []int{4, 3, 3}, []time.Time{ms(100), ms(105), ms(165)})
+	if r.Chunks != 3 || r.MaxGap != 60*time.Millisecond || r.Duration() != 65*time.Millisecond {
+		t.Errorf("три порции: частей %d, пауза %s, длительность %s", r.Chunks, r.MaxGap, r.Duration())
+	}
+	if len(b.Gaps) != 2 || b.Gaps[0] != 5*time.Millisecond || b.Gaps[1] != 60*time.Millisecond {
+		t.Errorf("паузы %v, нужно [5ms 60ms]", b.Gaps)
+	}
+	if !strings.Contains(r.String(), "частей: 3, макс. пауза 60ms, РАЗРЫВ") {
+		t.Errorf("запись: %s", r)
+	}
+	if len(b.times) != 0 {
+		t.Errorf("осталось времен %d", len(b.times))
+	}
+
+	report := b.String()
+	for _, want := range []string{
+		"Сканирований: 2",
+		"Паузы внутри сканирований: мин 5ms, сред 33ms, макс 60ms",
+		"Разорванных сканирований (пауза больше 50ms): 1",
+		"Повторов в пределах 1s: 0",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("в итоге нет %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestScanBenchmarkDuplicate(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	b := &ScanBenchmark{DuplicateWindow: 500 * time.Millisecond}
+	scans := []struct {
+		data      string
+		at        time.Duration
+		duplicate bool
+	}{
+		{"A\r", 0, false},
+		{"B\r", 100 * time.Millisecond, false},
+		{"A\r", 400 * time.Millisecond, true},   // в окне от первого A
+		{"A\r", 1000 * time.Millisecond, false}, // от предыдущего A прошло 600 мс
+		{"A\r", 1500 * time.Millisecond, true},  // ровно на границе окна
+	}
+	for i, s := range scans {
+		r := benchScan(b, s.data, []int{len(s.data)}, []time.Time{start.Add(s.at)})
+		if r.Duplicate != s.duplicate {
+			t.Errorf("сканирование %d: повтор %v, нужно %v", i+1, r.Duplicate, s.duplicate)
+		}
+	}
+	if report := b.String(); !strings.Contains(report, "Повторов в пределах 500ms: 2") {
+		t.Errorf("итог:\n%s", report)
+	}
+}
+
+func TestScanBenchmarkWaitRest(t *testing.T) {
+	b := &ScanBenchmark{}
+	tail := [][]byte{[]byte("A\r"), []byte("46012")}
+
+	// Пока не видно, что сканер передает терминатор, хвост не ждет
+	if b.waitRest(tail, true) {
+		t.Error("хвост ждет, хотя терминаторов еще не было")
+	}
+
+	b.received(2, time.Now())
+	b.add([]byte("A\r"), 0)
+	b.consumed(2)
+	if b.waitRest([][]byte{[]byte("B\r")}, true) {
+		t.Error("ждет продолжения сканирования с терминатором")
+	}
+	if !b.waitRest(tail, true) {
+		t.Error("хвост без терминатора не ждет продолжения")
+	}
+	// Порт снова что-то принес - ждем дальше, пауза без данных - разбираем как есть
+	if !b.waitRest(tail, true) {
+		t.Error("хвост не ждет, хотя данные пришли")
+	}
+	if b.waitRest(tail, false) {
+		t.Error("хвост ждет, хотя за чтение ничего не пришло")
+	}
+	if b.held {
+		t.Error("хвост остался отложенным")
+	}
+}
+
+// Отдельно пришедший LF после CR сканированием в замере не считается
+func TestScanTestBareTerminator(t *testing.T) {
+	d := &Device{Type: Scanner, ScanBench: &ScanBenchmark{}}
+	transport := &echoTransport{}
+	if err := d.ConnectTransport(transport); err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"4601234567893\r", "\n", "46012340\r\n"} {
+		transport.pending = []byte(data)
+		if _, err := d.Process(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(d.ScanBench.Records) != 2 {
+		t.Errorf("сканирований в замере %d, нужно 2: %+v", len(d.ScanBench.Records), d.ScanBench.Records)
+	}
+	if len(d.ScanBench.times) != 0 || len(d.rx) != 0 {
+		t.Errorf("не разобрано: времен %d, байт %d", len(d.ScanBench.times), len(d.rx))
+	}
+}
@@ -0,0 +1,325 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Диагностика настроек сканера: по серии сканирований определяется терминатор,
+// префикс и суффикс, передача идентификатора AIM и русская раскладка.
+
+// Названия управляющих символов для вывода
+var controlNames = map[byte]string{
+	0x00: "NUL", 0x02: "STX", 0x03: "ETX", 0x04: "EOT", 0x06: "ACK", 0x09: "TAB", 0x0A: "LF",
+	0x0D: "CR", 0x15: "NAK", 0x16: "SYN", 0x1B: "ESC", 0x1C: "FS", 0x1D: "GS", 0x1E: "RS", 0x1F: "US",
+}
+
+// Байты с видимыми управляющими символами: "4601234567893<CR><LF>".
+// Текст не в UTF-8 считается кодировкой Windows-1251
+func VisibleBytes(raw []byte) string {
+	cp1251 := !utf8.Valid(raw)
+	var res strings.Builder
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case controlNames[c] != "":
+			res.WriteString("<" + controlNames[c] + ">")
+		case c < 0x20 || c == 0x7F:
+			fmt.Fprintf(&res, "<0x%02X>", c)
+		case c < 0x80:
+			res.WriteByte(c)
+		case !cp1251:
+			r, n := utf8.DecodeRune(raw[i:])
+			res.WriteRune(r)
+			i += n
+			continue
+		default:
+			if r, ok := cp1251Rune(c); ok {
+				res.WriteRune(r)
+			} else {
+				fmt.Fprintf(&res, "<0x%02X>", c)
+			}
+		}
+		i++
+	}
+	return res.String()
+}
+
+// Кириллица Windows-1251
+func cp1251Rune(c byte) (rune, bool) {
+	switch {
+	case c >= 0xC0:
+		return 'А' + rune(c-0xC0), true
+	case c == 0xA8:
+		return 'Ё', true
+	case c == 0xB8:
+		return 'ё', true
+	case c == 0xB9:
+		return '№', true
+	}
+	return 0, false
+}
+
+// Текст сканирования: UTF-8 как есть, иначе кириллица Windows-1251
+func decodeScan(raw []byte) string {
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	var res []byte
+	for _, c := range raw {
+		if r, ok := cp1251Rune(c); ok {
+			res = utf8.AppendRune(res, r)
+		} else {
+			res = append(res, c)
+		}
+	}
+	return string(res)
+}
+
+// Символ терминатора: сканеры завершают штрихкод CR, LF, CR LF или TAB
+func isTerminator(c byte) bool {
+	return c == '\r' || c == '\n' || c == '\t'
+}
+
+// Делит принятые байты на сканирования по терминаторам, терминатор остается в сканировании
+func splitScans(buf []byte) [][]byte {
+	scans := [][]byte{}
+	start := 0
+	for i := 0; i < len(buf); i++ {
+		if !isTerminator(buf[i]) {
+			continue
+		}
+		// CR LF и другие сочетания подряд - один терминатор
+		for i+1 < len(buf) && isTerminator(buf[i+1]) {
+			i++
+		}
+		scans = append(scans, buf[start:i+1])
+		start = i + 1
+	}
+	if start < len(buf) {
+		scans = append(scans, buf[start:])
+	}
+	return scans
+}
+
+// Терминатор в конце сканирования: CR, LF или TAB в любом сочетании
+func scanTerminator(scan []byte) []byte {
+	i := len(scan)
+	for i > 0 && isTerminator(scan[i-1]) {
+		i--
+	}
+	return scan[i:]
+}
+
+// Сканирования, принятые в режиме диагностики
+type ScanDiagnostics struct {
+	Scans [][]byte // сканирования с терминатором, как их передал сканер
+}
+
+// Итог диагностики: что удалось определить о настройках сканера
+type ScannerConfig struct {
+	Scans       int
+	Terminators map[string]int // терминатор в видимом виде -> сколько раз встретился
+	Prefix      []byte         // одинаковое начало всех сканирований
+	Suffix      []byte         // одинаковый конец всех сканирований перед терминатором
+	Known       bool           // сканирований достаточно, чтобы определить префикс и суффикс
+	AIM         int            // сканирований с идентификатором AIM
+	Russian     int            // сканирований с символами русской раскладки
+	Failed      int            // сканирований, не прошедших проверку
+}
+
+// Добавляет сканирование и возвращает строку для вывода: байты как есть и результат проверки
+func (s *ScanDiagnostics) Add(scan []byte) (string, Barcode) {
+	s.Scans = append(s.Scans, append([]byte(nil), scan...))
+	c := s.Config()
+	b := c.parse(scan)
+
+	line := VisibleBytes(scan)
+	if fixed, n := fromRussianLayout(decodeScan(scan)); n > 0 {
+		line += " (в латинской раскладке: " + VisibleBytes([]byte(fixed)) + ")"
+	}
+	return line + "\n  " + b.Report(), b
+}
+
+// Разбирает сканирование без терминатора, префикса и суффикса
+func (c ScannerConfig) parse(scan []byte) Barcode {
+	payload := scan[:len(scan)-len(scanTerminator(scan))]
+	if bytes.HasPrefix(payload, c.Prefix) && bytes.HasSuffix(payload[len(c.Prefix):], c.Suffix) {
+		payload = payload[len(c.Prefix) : len(payload)-len(c.Suffix)]
+	}
+	return ParseBarcode(payload)
+}
+
+// Определяет настройки сканера по всем сканированиям
+func (s *ScanDiagnostics) Config() ScannerConfig {
+	c := ScannerConfig{Scans: len(s.Scans), Terminators: map[string]int{}}
+
+	payloads := [][]byte{}
+	distinct := map[string]bool{}
+	for _, scan := range s.Scans {
+		term := scanTerminator(scan)
+		c.Terminators[VisibleBytes(term)]++
+		payload := scan[:len(scan)-len(term)]
+		payloads = append(payloads, payload)
+		distinct[string(payload)] = true
+	}
+
+	// Префикс и суффикс видны только на разных штрихкодах
+	if len(distinct) >= 2 {
+		c.Known = true
+		c.Prefix = commonPrefix(payloads)
+		// Идентификатор AIM зависит от типа штрихкода и префиксом не считается
+		if i := bytes.IndexByte(c.Prefix, ']'); i >= 0 {
+			c.Prefix = c.Prefix[:i]
+		}
+		rest := [][]byte{}
+		for _, p := range payloads {
+			rest = append(rest, p[len(c.Prefix):])
+		}
+		c.Suffix = commonSuffix(rest)
+		c.Prefix = c.checkAffix(payloads, c.Prefix, true)
+		c.Suffix = c.checkAffix(payloads, c.Suffix, false)
+	}
+
+	for i, scan := range s.Scans {
+		b := c.parse(scan)
+		if b.AIM != "" {
+			c.AIM++
+		}
+		if !b.Passed() {
+			c.Failed++
+		}
+		if _, n := fromRussianLayout(decodeScan(payloads[i])); n > 0 {
+			c.Russian++
+		}
+	}
+	return c
+}
+
+// Одинаковое начало или конец может быть совпадением: у EAN-13 российских товаров
+// одинаковое начало 46. Настроенным префиксом считается то, в чем есть не буквы и не цифры,
+// или без чего штрихкоды проходят проверку лучше. Цифровой префикс сливается с общим
+// началом штрихкодов (99 и 460 - 99460), поэтому проверяются и более короткие части
+func (c ScannerConfig) checkAffix(payloads [][]byte, affix []byte, prefix bool) []byte {
+	if len(affix) == 0 {
+		return nil
+	}
+	for _, r := range string(affix) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return affix
+		}
+	}
+
+	with := 0
+	for _, p := range payloads {
+		if b := ParseBarcode(p); b.Passed() && b.Symbology != "" {
+			with++
+		}
+	}
+	for n := len(affix); n > 0; n-- {
+		part := affix[:n]
+		if !prefix {
+			part = affix[len(affix)-n:]
+		}
+		without := 0
+		for _, p := range payloads {
+			stripped := p[:len(p)-n]
+			if prefix {
+				stripped = p[n:]
+			}
+			if b := ParseBarcode(stripped); b.Passed() && b.Symbology != "" {
+				without++
+			}
+		}
+		if without > with {
+			return part
+		}
+	}
+	return nil
+}
+
+func commonPrefix(items [][]byte) []byte {
+	prefix := items[0]
+	for _, item := range items[1:] {
+		n := 0
+		for n < len(prefix) && n < len(item) && prefix[n] == item[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+func commonSuffix(items [][]byte) []byte {
+	suffix := items[0]
+	for _, item := range items[1:] {
+		n := 0
+		for n < len(suffix) && n < len(item) && suffix[len(suffix)-1-n] == item[len(item)-1-n] {
+			n++
+		}
+		suffix = suffix[len(suffix)-n:]
+	}
+	return suffix
+}
+
+// Итог для оператора, по строке на каждую настройку
+func (c ScannerConfig) String() string {
+	lines := []string{fmt.Sprintf("Настройки сканера по %d сканированиям:", c.Scans)}
+
+	terms := []string{}
+	for term, n := range c.Terminators {
+		if term == "" {
+			term = "нет"
+		}
+		terms = append(terms, fmt.Sprintf("%s - %d", term, n))
+	}
+	sort.Strings(terms)
+	switch len(c.Terminators) {
+	case 0:
+		lines = append(lines, "  Терминатор: нет данных")
+	case 1:
+		for term := range c.Terminators {
+			if term == "" {
+				term = "нет (сканирования разделяются только паузой)"
+			}
+			lines = append(lines, "  Терминатор: "+term)
+		}
+	default:
+		lines = append(lines, "  Терминатор: разный ("+strings.Join(terms, ", ")+") - проверьте настройку суффикса")
+	}
+
+	if c.Known {
+		lines = append(lines, "  Префикс: "+visibleOrNone(c.Prefix), "  Суффикс: "+visibleOrNone(c.Suffix))
+	} else {
+		lines = append(lines, "  Префикс и суффикс: нужно отсканировать хотя бы два разных штрихкода")
+	}
+
+	switch {
+	case c.AIM == 0:
+		lines = append(lines, "  Идентификатор AIM: не передается")
+	case c.AIM == c.Scans:
+		lines = append(lines, "  Идентификатор AIM: передается")
+	default:
+		lines = append(lines, fmt.Sprintf("  Идентификатор AIM: только в %d из %d сканирований", c.AIM, c.Scans))
+	}
+
+	if c.Russian > 0 {
+		lines = append(lines, fmt.Sprintf("  Раскладка: русская в %d из %d сканирований - сканер работает как клавиатура, переключите раскладку на английскую", c.Russian, c.Scans))
+	} else {
+		lines = append(lines, "  Раскладка: латинская")
+	}
+
+	lines = append(lines, fmt.Sprintf("  Проверка штрихкодов: PASS %d, FAIL %d", c.Scans-c.Failed, c.Failed))
+	return strings.Join(lines, "\n")
+}
+
+func visibleOrNone(b []byte) string {
+	if len(b) == 0 {
+		return "нет"
+	}
+	return VisibleBytes(b)
+}
@@ -0,0 +1,131 @@
+package logic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVisibleBytes(t *testing.T) {
+	tests := []struct {
+		raw, want string
+	}{
+		{"4601234567893\r\n", "4601234567893<CR><LF>"},
+		{"01\x1d21", "01<GS>21"},
+		{"\x01A\x7f", "<0x01>A<0x7F>"},
+		{"Тест", "Тест"},                    // UTF-8
+		{"\xd2\xe5\xf1\xf2 \xb9", "Тест №"}, // Windows-1251
+		{"\x98\xd2", "<0x98>Т"},
+	}
+	for _, tt := range tests {
+		if got := VisibleBytes([]byte(tt.raw)); got != tt.want {
+			t.Errorf("VisibleBytes(%q) = %q, нужно %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSplitScans(t *testing.T) {
+	tests := []struct {
+		buf  string
+		want []string
+	}{
+		{"A\r\nB\rC", []string{"A\r\n", "B\r", "C"}},
+		{"\r\nA\n", []string{"\r\n", "A\n"}},
+		{"A\tB\t", []string{"A\t", "B\t"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		got := splitScans([]byte(tt.buf))
+		if len(got) != len(tt.want) {
+			t.Errorf("splitScans(%q) = %q, нужно %q", tt.buf, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if string(got[i]) != tt.want[i] {
+				t.Errorf("splitScans(%q) = %q, нужно %q", tt.buf, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestScanTerminator(t *testing.T) {
+	for scan, want := range map[string]string{"A\r\n": "\r\n", "A\t": "\t", "A": "", "\r": "\r"} {
+		if got := scanTerminator([]byte(scan)); string(got) != want {
+			t.Errorf("scanTerminator(%q) = %q, нужно %q", scan, got, want)
+		}
+	}
+}
+
+func TestScannerConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		scans          []string
+		terminator     string
+		prefix, suffix string
+		known          bool
+		aim, russian   int
+		failed         int
+	}{
+		{
+			name:       "префикс и суффикс",
+			scans:      []string{"#4601234567893$\r\n", "#46012340$\r\n", "#TEST-128$\r\n"},
+			terminator: "<CR><LF>", prefix: "#", suffix: "$", known: true,
+		},
+		{
+			// Общее начало 460 и конец 3 у EAN-13 - совпадение, а не настройка сканера
+			name:       "общее начало EAN-13",
+			scans:      []string{"4601234567893\r", "4609876543213\r"},
+			terminator: "<CR>", known: true,
+		},
+		{
+			name:       "префикс из цифр, без него штрихкоды проходят проверку",
+			scans:      []string{"994601234567893\r", "994609876543213\r"},
+			terminator: "<CR>", prefix: "99", known: true,
+		},
+		{
+			// Идентификатор AIM отличается у разных типов и префиксом не считается
+			name:       "AIM",
+			scans:      []string{"]E04601234567893\n", "]E02212345012343\n"},
+			terminator: "<LF>", known: true, aim: 2,
+		},
+		{
+			name:       "русская раскладка",
+			scans:      []string{"ЕУЫЕ-128\r", "4601234567893\r"},
+			terminator: "<CR>", known: true, russian: 1, failed: 1,
+		},
+		{
+			name:       "один штрихкод",
+			scans:      []string{"4601234567893\t", "4601234567893\t"},
+			terminator: "<TAB>",
+		},
+	}
+	for _, tt := range tests {
+		s := &ScanDiagnostics{}
+		for _, scan := range tt.scans {
+			s.Add([]byte(scan))
+		}
+		c := s.Config()
+		if len(c.Terminators) != 1 || c.Terminators[tt.terminator] != len(tt.scans) {
+			t.Errorf("%s: терминаторы %v, нужно %s", tt.name, c.Terminators, tt.terminator)
+		}
+		if !bytes.Equal(c.Prefix, []byte(tt.prefix)) || !bytes.Equal(c.Suffix, []byte(tt.suffix)) || c.Known != tt.known {
+			t.Errorf("%s: префикс %q, суффикс %q, определены %v; нужно %q, %q, %v",
+				tt.name, c.Prefix, c.Suffix, c.Known, tt.prefix, tt.suffix, tt.known)
+		}
+		if c.AIM != tt.aim || c.Russian != tt.russian || c.Failed != tt.failed {
+			t.Errorf("%s: AIM %d, русская раскладка %d, FAIL %d; нужно %d, %d, %d",
+				tt.name, c.AIM, c.Russian, c.Failed, tt.aim, tt.russian, tt.failed)
+		}
+	}
+}
+
+func TestScannerConfigMixedTerminators(t *testing.T) {
+	s := &ScanDiagnostics{}
+	for _, scan := range []string{"4601234567893\r\n", "46012340\r"} {
+		s.Add([]byte(scan))
+	}
+	c := s.Config()
+	if c.Terminators["<CR><LF>"] != 1 || c.Terminators["<CR>"] != 1 {
+		t.Errorf("терминаторы %v", c.Terminators)
+	}
+}
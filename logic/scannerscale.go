@@ -0,0 +1,193 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Весы-сканеры с одним кабелем (Datalogic Magellan Single Cable, NCR и совместимые).
+// Штрихкоды и вес идут по одному порту, каждое сообщение - строка ASCII, заканчивающаяся CR:
+//
+//	S11            запрос веса
+//	S11nnnnn       вес: 5 цифр - кг с тремя знаками, 4 цифры - фунты с двумя знаками
+//	S140...S144    вес не передан: не готовы, движение, перегрузка, недогрузка, ноль
+//	S08<тип><ШК>   штрихкод, тип: A - UPC-A, E - UPC-E, F - EAN-13, FF - EAN-8,
+//	               B1 - Code 39, B2 - Interleaved 2 of 5, B3 - Code 128
+//
+// Строки без префикса S считаются штрихкодами без идентификатора типа.
+// Вес запрашивается периодически, штрихкоды приходят в любой момент, в том числе между запросом и ответом.
+
+const (
+	scannerScaleRequest = "S11"
+	scannerScaleBarcode = "S08"
+	scannerScaleStatus  = "S14"
+
+	scannerScalePoll    = 500 * time.Millisecond // период запроса веса
+	scannerScaleMaxLine = 128
+)
+
+// Типы штрихкодов после S08. Длинные идентификаторы проверяются первыми
+var scannerScaleSymbologies = []struct {
+	id, name string
+}{
+	{"FF", "EAN-8"},
+	{"B1", "Code 39"},
+	{"B2", "Interleaved 2 of 5"},
+	{"B3", "Code 128"},
+	{"A", "UPC-A"},
+	{"E", "UPC-E"},
+	{"F", "EAN-13"},
+}
+
+// Сообщение весов-сканера: штрихкод, вес или состояние весов без показания
+type scannerScaleMessage struct {
+	barcode *Barcode
+	reading *Reading
+	text    string
+}
+
+// Разбирает одно сообщение без CR
+func decodeScannerScaleMessage(line []byte) (scannerScaleMessage, error) {
+	var m scannerScaleMessage
+	text := string(line)
+
+	switch {
+	case strings.HasPrefix(text, scannerScaleBarcode):
+		b := &Barcode{Data: text[len(scannerScaleBarcode):], Raw: append([]byte(nil), line...)}
+		for _, s := range scannerScaleSymbologies {
+			if strings.HasPrefix(b.Data, s.id) {
+				b.Data = b.Data[len(s.id):]
+				b.Symbology = s.name
+				break
+			}
+		}
+		if b.Data == "" {
+			return m, fmt.Errorf("пустой штрихкод")
+		}
+		m.barcode = b
+
+	case strings.HasPrefix(text, scannerScaleStatus) && len(text) == 4:
+		switch text[3] {
+		case '0':
+			m.text = "Весы не готовы"
+		case '1':
+			m.text = "Вес не успокоился"
+		case '2':
+			m.reading = &Reading{Overload: true}
+		case '3':
+			m.reading = &Reading{Underload: true}
+		case '4':
+			m.reading = &Reading{Zero: true, Stable: true}
+		default:
+			return m, fmt.Errorf("неизвестное состояние весов %q", text)
+		}
+
+	case strings.HasPrefix(text, scannerScaleRequest):
+		digits := text[len(scannerScaleRequest):]
+		value, err := ParseDecimal(digits)
+		if err != nil || value.Scale != 0 || strings.ContainsAny(digits, "+- ") {
+			return m, fmt.Errorf("неверный вес %q", text)
+		}
+		r := &Reading{Stable: true}
+		switch len(digits) {
+		case 5:
+			r.Weight, r.Unit = NewDecimal(value.Value, 3), "kg"
+		case 4:
+			r.Weight, r.Unit = NewDecimal(value.Value, 2), "lb"
+		default:
+			return m, fmt.Errorf("неверная длина веса %q", text)
+		}
+		r.Zero = r.Weight.IsZero()
+		m.reading = r
+
+	case len(text) > 0 && text[0] == 'S':
+		return m, fmt.Errorf("неизвестное сообщение %q", text)
+
+	default:
+		m.barcode = &Barcode{Data: text, Raw: append([]byte(nil), line...)}
+	}
+
+	if m.reading != nil {
+		m.reading.Raw = append([]byte(nil), line...)
+	}
+	return m, nil
+}
+
+// Ищет в буфере следующее сообщение. Пустые строки (LF после CR) пропускаются
+func nextScannerScaleMessage(buf []byte, stats *FrameStats) (scannerScaleMessage, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		end := bytes.IndexAny(rest, "\r\n")
+		if end < 0 {
+			if len(rest) > scannerScaleMaxLine {
+				stats.FramingErrors++
+				stats.SkippedBytes += len(rest)
+				return scannerScaleMessage{}, len(buf), false
+			}
+			return scannerScaleMessage{}, used, false
+		}
+		used += end + 1
+		if end == 0 {
+			continue
+		}
+
+		m, err := decodeScannerScaleMessage(rest[:end])
+		if err != nil {
+			stats.FramingErrors++
+			continue
+		}
+		stats.Frames++
+		return m, used, true
+	}
+}
+
+// Разбирает накопленные байты: штрихкод идет в LastBarcode, вес - в LastReading
+func (d *Device) takeScannerScaleMessage() (string, bool) {
+	m, used, ok := nextScannerScaleMessage(d.rx, &d.Stats)
+	d.rx = d.rx[used:]
+	if !ok {
+		return "", false
+	}
+
+	var str string
+	switch {
+	case m.barcode != nil:
+		str, _ = d.setBarcode(*m.barcode)
+	case m.reading != nil:
+		str, _ = d.setReading(*m.reading)
+	default:
+		str = m.text
+	}
+	return str, true
+}
+
+// Весы-сканер: штрихкоды по мере сканирования и периодический запрос веса
+func startReadScannerScale(d *Device) (string, error) {
+	for {
+		// Сначала то, что уже накопилось
+		if str, ok := d.takeScannerScaleMessage(); ok {
+			return str, nil
+		}
+
+		if time.Since(d.lastRequest) >= scannerScalePoll {
+			d.lastRequest = time.Now()
+			if _, err := d.transport.Write([]byte(scannerScaleRequest + "\r")); err != nil {
+				d.LastError = err.Error()
+				return "", err
+			}
+		}
+
+		n, err := d.readMore()
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			// Недочитанное сообщение остается в буфере: штрихкод может прийти частями
+			return "", nil
+		}
+	}
+}
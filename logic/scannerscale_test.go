@@ -0,0 +1,120 @@
+package logic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeScannerScaleMessage(t *testing.T) {
+	tests := []struct {
+		line      string
+		data      string // штрихкод
+		symbology string
+		weight    Decimal // вес, если сообщение - показание
+		unit      string
+		text      string
+		bad       bool
+	}{
+		{line: "S08F4601234567893", data: "4601234567893", symbology: "EAN-13"},
+		{line: "S08FF46012340", data: "46012340", symbology: "EAN-8"},
+		{line: "S08B3TEST-128", data: "TEST-128", symbology: "Code 128"},
+		{line: "S08A012345678905", data: "012345678905", symbology: "UPC-A"},
+		{line: "S08X123", data: "X123"},
+		{line: "4601234567893", data: "4601234567893"},
+		{line: "S1101250", weight: NewDecimal(1250, 3), unit: "kg"},
+		{line: "S110125", weight: NewDecimal(125, 2), unit: "lb"},
+		{line: "S140", text: "Весы не готовы"},
+		{line: "S141", text: "Вес не успокоился"},
+		{line: "S08", bad: true},
+		{line: "S11", bad: true},
+		{line: "S11-0125", bad: true},
+		{line: "S111.250", bad: true},
+		{line: "S145", bad: true},
+		{line: "S99", bad: true},
+	}
+	for _, tt := range tests {
+		m, err := decodeScannerScaleMessage([]byte(tt.line))
+		switch {
+		case tt.bad:
+			if err == nil {
+				t.Errorf("%s: разобрано %+v", tt.line, m)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.line, err)
+		case tt.data != "":
+			if m.barcode == nil || m.barcode.Data != tt.data || m.barcode.Symbology != tt.symbology {
+				t.Errorf("%s: штрихкод %+v", tt.line, m.barcode)
+			}
+		case tt.unit != "":
+			if m.reading == nil || m.reading.Weight != tt.weight || m.reading.Unit != tt.unit || !m.reading.Stable {
+				t.Errorf("%s: показание %+v", tt.line, m.reading)
+			}
+		default:
+			if m.text != tt.text || m.barcode != nil || m.reading != nil {
+				t.Errorf("%s: %+v", tt.line, m)
+			}
+		}
+	}
+
+	for line, check := range map[string]func(r *Reading) bool{
+		"S142":     func(r *Reading) bool { return r.Overload },
+		"S143":     func(r *Reading) bool { return r.Underload },
+		"S144":     func(r *Reading) bool { return r.Zero && r.Stable },
+		"S1100000": func(r *Reading) bool { return r.Zero },
+	} {
+		m, err := decodeScannerScaleMessage([]byte(line))
+		if err != nil || m.reading == nil || !check(m.reading) || !bytes.Equal(m.reading.Raw, []byte(line)) {
+			t.Errorf("%s: показание %+v, ошибка %v", line, m.reading, err)
+		}
+	}
+}
+
+func TestNextScannerScaleMessage(t *testing.T) {
+	buf := []byte("S08F4601234567893\r\nS99\rS1101250\rS08B3TE")
+	var stats FrameStats
+	messages := []scannerScaleMessage{}
+	for {
+		m, used, ok := nextScannerScaleMessage(buf, &stats)
+		buf = buf[used:]
+		if !ok {
+			break
+		}
+		messages = append(messages, m)
+	}
+	if len(messages) != 2 || messages[0].barcode == nil || messages[1].reading == nil {
+		t.Errorf("сообщения %+v", messages)
+	}
+	// Неполный штрихкод ждет продолжения
+	if stats.Frames != 2 || stats.FramingErrors != 1 || string(buf) != "S08B3TE" {
+		t.Errorf("счетчики %+v, осталось %q", stats, buf)
+	}
+
+	long := bytes.Repeat([]byte("1"), scannerScaleMaxLine+1)
+	stats = FrameStats{}
+	if _, used, ok := nextScannerScaleMessage(long, &stats); ok || used != len(long) || stats.FramingErrors != 1 {
+		t.Errorf("длинная строка без CR: использовано %d, счетчики %+v", used, stats)
+	}
+}
+
+// Штрихкод между запросом веса и ответом не теряется
+func TestScannerScaleProcess(t *testing.T) {
+	d := &Device{Type: ScannerScale}
+	transport := &echoTransport{}
+	if err := d.ConnectTransport(transport); err != nil {
+		t.Fatal(err)
+	}
+	transport.pending = []byte("S08F4601234567893\rS1101250\r")
+
+	if _, err := d.Process(); err != nil {
+		t.Fatal(err)
+	}
+	if d.LastBarcode == nil || d.LastBarcode.Data != "4601234567893" || d.LastReading != nil {
+		t.Errorf("штрихкод %+v, показание %+v", d.LastBarcode, d.LastReading)
+	}
+	if _, err := d.Process(); err != nil {
+		t.Fatal(err)
+	}
+	if d.LastReading == nil || d.LastReading.Weight != NewDecimal(1250, 3) || d.LastBarcode != nil {
+		t.Errorf("показание %+v, штрихкод %+v", d.LastReading, d.LastBarcode)
+	}
+}
@@ -0,0 +1,309 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Управление потоком
+type FlowControl int
+
+const (
+	FlowNone   FlowControl = iota // Без управления потоком
+	FlowRTSCTS                    // Аппаратное RTS/CTS
+)
+
+// Параметры COM порта
+type SerialSettings struct {
+	BaudRate    int
+	DataBits    int
+	Parity      serial.Parity
+	StopBits    serial.StopBits
+	FlowControl FlowControl
+	DTR         bool          // Начальное состояние DTR
+	RTS         bool          // Начальное состояние RTS
+	ReadTimeout time.Duration // Сколько ждать данных при чтении
+}
+
+// Параметры по умолчанию для типа устройства
+func DefaultSerialSettings(t DeviceType) SerialSettings {
+	s := SerialSettings{
+		BaudRate:    9600,
+		DataBits:    8,
+		Parity:      serial.NoParity,
+		StopBits:    serial.OneStopBit,
+		FlowControl: FlowNone,
+		DTR:         true,
+		RTS:         true,
+		ReadTimeout: 500 * time.Millisecond,
+	}
+
+	switch t {
+	case ScalesMassaKRequest, EmulatorMassaK:
+		s.BaudRate = 57600
+	// Toledo передает 7-битные символы с четностью
+	case ScalesToledo8142, ScalesToledo8217, EmulatorToledo8142, EmulatorToledo8217:
+		s.DataBits = 7
+		s.Parity = serial.EvenParity
+	// A&D по умолчанию 2400 7E1
+	case ScalesAND, ScalesANDContinuous:
+		s.BaudRate = 2400
+		s.DataBits = 7
+		s.Parity = serial.EvenParity
+	// Sartorius SBI по умолчанию 1200 7O1
+	case ScalesSartorius, ScalesSartoriusContinuous:
+		s.BaudRate = 1200
+		s.DataBits = 7
+		s.Parity = serial.OddParity
+	}
+
+	return s
+}
+
+// Кратко, как принято на шильдиках: 9600 8N1
+func (s SerialSettings) String() string {
+	res := fmt.Sprintf("%d %d%s%s", s.BaudRate, s.DataBits, parityCode(s.Parity), stopBitsCode(s.StopBits))
+	if s.FlowControl == FlowRTSCTS {
+		res += " RTS/CTS"
+	}
+	return res
+}
+
+// Четность одной буквой: N, O, E, M, S
+func (s SerialSettings) ParityCode() string {
+	return parityCode(s.Parity)
+}
+
+// Стоп-биты: 1, 1.5, 2
+func (s SerialSettings) StopBitsCode() string {
+	return stopBitsCode(s.StopBits)
+}
+
+// Бит на байт в линии: старт, данные, четность, стоп
+func (s SerialSettings) BitsPerByte() float64 {
+	bits := 1 + float64(s.DataBits)
+	if s.Parity != serial.NoParity {
+		bits++
+	}
+	switch s.StopBits {
+	case serial.OnePointFiveStopBits:
+		bits += 1.5
+	case serial.TwoStopBits:
+		bits += 2
+	default:
+		bits++
+	}
+	return bits
+}
+
+// Теоретическая скорость передачи, байт в секунду
+func (s SerialSettings) ByteRate() float64 {
+	return float64(s.BaudRate) / s.BitsPerByte()
+}
+
+// Параметры для go.bug.st/serial
+func (s SerialSettings) mode() *serial.Mode {
+	return &serial.Mode{
+		BaudRate:          s.BaudRate,
+		DataBits:          s.DataBits,
+		Parity:            s.Parity,
+		StopBits:          s.StopBits,
+		InitialStatusBits: &serial.ModemOutputBits{DTR: s.DTR, RTS: s.RTS || s.FlowControl == FlowRTSCTS},
+	}
+}
+
+// Проверка допустимости значений
+func (s SerialSettings) Validate() error {
+	if s.BaudRate <= 0 {
+		return fmt.Errorf("неверная скорость порта %d", s.BaudRate)
+	}
+	if s.DataBits < 5 || s.DataBits > 8 {
+		return fmt.Errorf("неверное количество бит данных %d", s.DataBits)
+	}
+	if s.ReadTimeout <= 0 {
+		return fmt.Errorf("неверный таймаут чтения %s", s.ReadTimeout)
+	}
+	return nil
+}
+
+func parityCode(p serial.Parity) string {
+	switch p {
+	case serial.OddParity:
+		return "O"
+	case serial.EvenParity:
+		return "E"
+	case serial.MarkParity:
+		return "M"
+	case serial.SpaceParity:
+		return "S"
+	}
+	return "N"
+}
+
+func stopBitsCode(s serial.StopBits) string {
+	switch s {
+	case serial.OnePointFiveStopBits:
+		return "1.5"
+	case serial.TwoStopBits:
+		return "2"
+	}
+	return "1"
+}
+
+func flowControlCode(f FlowControl) string {
+	if f == FlowRTSCTS {
+		return "rtscts"
+	}
+	return "none"
+}
+
+// Четность: N, O, E, M, S или полное название
+func ParseParity(v string) (serial.Parity, error) {
+	switch strings.ToUpper(v) {
+	case "N", "NONE":
+		return serial.NoParity, nil
+	case "O", "ODD":
+		return serial.OddParity, nil
+	case "E", "EVEN":
+		return serial.EvenParity, nil
+	case "M", "MARK":
+		return serial.MarkParity, nil
+	case "S", "SPACE":
+		return serial.SpaceParity, nil
+	}
+	return serial.NoParity, fmt.Errorf("неверная четность %q", v)
+}
+
+// Стоп-биты: 1, 1.5, 2
+func ParseStopBits(v string) (serial.StopBits, error) {
+	switch v {
+	case "1":
+		return serial.OneStopBit, nil
+	case "1.5":
+		return serial.OnePointFiveStopBits, nil
+	case "2":
+		return serial.TwoStopBits, nil
+	}
+	return serial.OneStopBit, fmt.Errorf("неверное количество стоп-бит %q", v)
+}
+
+// Управление потоком: none, rtscts
+func ParseFlowControl(v string) (FlowControl, error) {
+	switch strings.ToLower(v) {
+	case "", "none", "no":
+		return FlowNone, nil
+	case "rtscts", "rts/cts", "hardware":
+		return FlowRTSCTS, nil
+	}
+	return FlowNone, fmt.Errorf("неверное управление потоком %q", v)
+}
+
+// Устанавливает один параметр по имени. Используется строкой порта, командной строкой и меню.
+// Имена: baud, databits, parity, stopbits, flow, dtr, rts, timeout
+func (s *SerialSettings) Set(name, value string) error {
+	var err error
+	switch strings.ToLower(name) {
+	case "baud":
+		var baud int
+		if baud, err = strconv.Atoi(value); err != nil || baud <= 0 {
+			return fmt.Errorf("неверная скорость порта %q", value)
+		}
+		s.BaudRate = baud
+	case "databits":
+		var bits int
+		if bits, err = strconv.Atoi(value); err != nil || bits < 5 || bits > 8 {
+			return fmt.Errorf("неверное количество бит данных %q", value)
+		}
+		s.DataBits = bits
+	case "parity":
+		s.Parity, err = ParseParity(value)
+	case "stopbits":
+		s.StopBits, err = ParseStopBits(value)
+	case "flow":
+		s.FlowControl, err = ParseFlowControl(value)
+	case "dtr":
+		if s.DTR, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("неверное значение DTR %q", value)
+		}
+	case "rts":
+		if s.RTS, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("неверное значение RTS %q", value)
+		}
+	case "timeout":
+		var timeout time.Duration
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			return fmt.Errorf("неверный таймаут чтения %q", value)
+		}
+		s.ReadTimeout = timeout
+	default:
+		return fmt.Errorf("неизвестный параметр порта %q", name)
+	}
+	return err
+}
+
+// Представление в файле настроек. Все поля необязательные:
+// отсутствующие остаются как были (обычно - значения по умолчанию для протокола)
+type serialSettingsJSON struct {
+	Baud        int    `json:"baud,omitempty"`
+	DataBits    int    `json:"dataBits,omitempty"`
+	Parity      string `json:"parity,omitempty"`
+	StopBits    string `json:"stopBits,omitempty"`
+	FlowControl string `json:"flowControl,omitempty"`
+	DTR         *bool  `json:"dtr,omitempty"`
+	RTS         *bool  `json:"rts,omitempty"`
+	ReadTimeout string `json:"readTimeout,omitempty"`
+}
+
+func (s SerialSettings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(serialSettingsJSON{
+		Baud:        s.BaudRate,
+		DataBits:    s.DataBits,
+		Parity:      parityCode(s.Parity),
+		StopBits:    stopBitsCode(s.StopBits),
+		FlowControl: flowControlCode(s.FlowControl),
+		DTR:         &s.DTR,
+		RTS:         &s.RTS,
+		ReadTimeout: s.ReadTimeout.String(),
+	})
+}
+
+func (s *SerialSettings) UnmarshalJSON(data []byte) error {
+	var v serialSettingsJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	values := map[string]string{
+		"parity":   v.Parity,
+		"stopbits": v.StopBits,
+		"flow":     v.FlowControl,
+		"timeout":  v.ReadTimeout,
+	}
+	if v.Baud != 0 {
+		values["baud"] = strconv.Itoa(v.Baud)
+	}
+	if v.DataBits != 0 {
+		values["databits"] = strconv.Itoa(v.DataBits)
+	}
+	if v.DTR != nil {
+		values["dtr"] = strconv.FormatBool(*v.DTR)
+	}
+	if v.RTS != nil {
+		values["rts"] = strconv.FormatBool(*v.RTS)
+	}
+
+	for name, value := range values {
+		if value == "" {
+			continue
+		}
+		if err := s.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package logic
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Протокол обмена весов Штрих-М (Штрих-Принт, Штрих-Слим, весовые модули Штрих).
+//
+// Кадр: STX, длина, команда, данные, LRC. Длина - количество байт команды и данных,
+// LRC - XOR байта длины, команды и данных.
+//
+// Обмен начинается с ENQ. Весы отвечают NAK, если готовы принять команду,
+// или ACK, если у них есть неотданный ответ - его нужно принять и начать заново.
+// На принятую команду весы отвечают ACK, затем кадром ответа: команда, код ошибки, данные.
+// Принятый ответ подтверждается ACK, ответ с неверной LRC - NAK, и весы повторяют его.
+//
+// Команды защищены паролем: 4 байта LE сразу после кода команды.
+
+const (
+	shtrihSTX = 0x02
+	shtrihENQ = 0x05
+	shtrihACK = 0x06
+	shtrihNAK = 0x15
+
+	shtrihPassword = 30 // пароль по умолчанию
+
+	shtrihRetries = 3 // попыток на одну команду
+
+	shtrihCmdChannelStatus = 0x3A // Запрос состояния весового канала
+)
+
+// Флаги состояния весового канала в ответе на 0x3A
+const (
+	shtrihFlagFixed     = 1 << 0 // Вес зафиксирован
+	shtrihFlagAutoZero  = 1 << 1 // Работает автонуль
+	shtrihFlagEnabled   = 1 << 2 // Канал включен
+	shtrihFlagTare      = 1 << 3 // Установлена тара
+	shtrihFlagStable    = 1 << 4 // Вес успокоился
+	shtrihFlagZeroError = 1 << 5 // Ошибка автонуля при включении
+	shtrihFlagOverload  = 1 << 6 // Перегрузка
+	shtrihFlagMeasError = 1 << 7 // Ошибка при получении измерения
+	shtrihFlagUnderload = 1 << 8 // Весы недогружены
+	shtrihFlagNoADC     = 1 << 9 // Нет ответа от АЦП
+)
+
+// Коды ошибок в ответе
+var shtrihErrors = map[byte]string{
+	0x11: "Ошибка в значении тары",
+	0x12: "Неизвестная команда",
+	0x13: "Неверная длина данных команды",
+	0x14: "Неверный пароль",
+	0x15: "Команда не реализуется в данном режиме",
+	0x16: "Неверное значение параметра",
+	0x96: "Ошибка при попытке установки нуля",
+	0x97: "Ошибка при установке тары",
+	0x98: "Вес не фиксирован",
+	0xA6: "Сбой энергонезависимой памяти",
+	0xA7: "Команда не реализуется интерфейсом",
+	0xAA: "Исчерпан лимит попыток обращения с неверным паролем",
+	0xB4: "Режим градуировки заблокирован переключателем",
+	0xB5: "Клавиатура заблокирована",
+	0xB6: "Нельзя поменять тип текущего канала",
+	0xB7: "Нельзя выключить текущий канал",
+	0xB8: "С данным каналом ничего нельзя делать",
+	0xB9: "Неверный номер канала",
+	0xBA: "Нет ответа от АЦП",
+}
+
+// Текст ошибки по коду из ответа
+func shtrihErrorText(code byte) string {
+	if text, ok := shtrihErrors[code]; ok {
+		return fmt.Sprintf("%s (код 0x%02X)", text, code)
+	}
+	return fmt.Sprintf("Ошибка весов, код 0x%02X", code)
+}
+
+func shtrihLRC(data []byte) byte {
+	var lrc byte
+	for _, b := range data {
+		lrc ^= b
+	}
+	return lrc
+}
+
+// Собирает кадр команды с паролем
+func shtrihFrame(cmd byte, data []byte) []byte {
+	body := []byte{cmd}
+	body = binary.LittleEndian.AppendUint32(body, shtrihPassword)
+	body = append(body, data...)
+
+	frame := []byte{shtrihSTX, byte(len(body))}
+	frame = append(frame, body...)
+	return append(frame, shtrihLRC(frame[1:]))
+}
+
+// Ищет в буфере следующий кадр. Возвращает команду и данные без длины и LRC.
+// Кадр с неверной LRC пропускается целиком и учитывается в ChecksumErrors.
+func nextShtrihFrame(buf []byte, stats *FrameStats) ([]byte, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		start := -1
+		for i, b := range rest {
+			if b == shtrihSTX {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			stats.SkippedBytes += len(rest)
+			return nil, len(buf), false
+		}
+		stats.SkippedBytes += start
+		used += start
+		rest = buf[used:]
+
+		if len(rest) < 2 {
+			return nil, used, false
+		}
+		length := int(rest[1])
+		if length == 0 {
+			stats.FramingErrors++
+			used++
+			continue
+		}
+		if len(rest) < length+3 {
+			return nil, used, false
+		}
+
+		frame := rest[:length+3]
+		if shtrihLRC(frame[1:length+2]) != frame[length+2] {
+			stats.ChecksumErrors++
+			return nil, used + len(frame), false
+		}
+		stats.Frames++
+		return append([]byte(nil), frame[2:length+2]...), used + len(frame), true
+	}
+}
+
+// Берет один байт из буфера, при необходимости дочитывая порт
+func (d *Device) shtrihReadByte() (byte, bool, error) {
+	if len(d.rx) == 0 {
+		n, err := d.readMore()
+		if err != nil || n == 0 {
+			return 0, false, err
+		}
+	}
+	b := d.rx[0]
+	d.rx = d.rx[1:]
+	return b, true, nil
+}
+
+func (d *Device) shtrihWrite(data []byte) error {
+	if _, err := d.transport.Write(data); err != nil {
+		d.LastError = err.Error()
+		return err
+	}
+	return nil
+}
+
+// Принимает кадр ответа и подтверждает его. nil если ответа нет
+func (d *Device) shtrihReceive() ([]byte, error) {
+	for {
+		checksumErrors := d.Stats.ChecksumErrors
+		body, used, ok := nextShtrihFrame(d.rx, &d.Stats)
+		d.rx = d.rx[used:]
+		if ok {
+			return body, d.shtrihWrite([]byte{shtrihACK})
+		}
+		if d.Stats.ChecksumErrors > checksumErrors {
+			// Просим повторить ответ
+			if err := d.shtrihWrite([]byte{shtrihNAK}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		n, err := d.readMore()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			if len(d.rx) > 0 {
+				d.Stats.FramingErrors++
+				d.rx = nil
+			}
+			return nil, nil
+		}
+	}
+}
+
+// Выполняет команду с подтверждениями ENQ/ACK/NAK.
+// Возвращает тело ответа: команда, код ошибки, данные. nil если весы не ответили.
+func (d *Device) shtrihExchange(cmd byte, data []byte) ([]byte, error) {
+	// Опоздавшие ответы на прошлые запросы уже не нужны
+	d.rx = nil
+
+	for attempt := 0; attempt < shtrihRetries; attempt++ {
+		if err := d.shtrihWrite([]byte{shtrihENQ}); err != nil {
+			return nil, err
+		}
+		b, ok, err := d.shtrihReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		switch b {
+		case shtrihNAK:
+			// Весы готовы принять команду
+		case shtrihACK:
+			// У весов остался ответ на прошлую команду - забираем и начинаем заново
+			if _, err := d.shtrihReceive(); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			d.Stats.SkippedBytes++
+			continue
+		}
+
+		if err := d.shtrihWrite(shtrihFrame(cmd, data)); err != nil {
+			return nil, err
+		}
+		b, ok, err = d.shtrihReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || b != shtrihACK {
+			// Команда не принята, повторяем с ENQ
+			continue
+		}
+
+		body, err := d.shtrihReceive()
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			continue
+		}
+		if body[0] != cmd || len(body) < 2 {
+			d.Stats.FramingErrors++
+			continue
+		}
+		return body, nil
+	}
+	return nil, nil
+}
+
+// Разбирает ответ на 0x3A: команда, ошибка, флаги (2 байта), вес в граммах (4 байта со знаком),
+// тара в граммах (2 байта)
+func decodeShtrihWeight(body []byte) (Reading, error) {
+	r := Reading{Raw: append([]byte(nil), body...), Unit: "kg"}
+	if len(body) < 10 {
+		return r, fmt.Errorf("короткий ответ на запрос веса: %d байт", len(body))
+	}
+
+	flags := binary.LittleEndian.Uint16(body[2:4])
+	switch {
+	case flags&shtrihFlagEnabled == 0:
+		return r, fmt.Errorf("Весовой канал выключен")
+	case flags&shtrihFlagNoADC != 0:
+		return r, fmt.Errorf("Нет ответа от АЦП")
+	case flags&shtrihFlagMeasError != 0:
+		return r, fmt.Errorf("Ошибка при получении измерения")
+	case flags&shtrihFlagZeroError != 0:
+		return r, fmt.Errorf("Ошибка автонуля при включении")
+	}
+
+	weight := int32(binary.LittleEndian.Uint32(body[4:8]))
+	r.Weight = NewDecimal(int64(weight), 3)
+	r.Stable = flags&shtrihFlagStable != 0
+	r.Overload = flags&shtrihFlagOverload != 0
+	r.Underload = flags&shtrihFlagUnderload != 0
+	r.Zero = weight == 0
+	if flags&shtrihFlagTare != 0 {
+		r.Mode = WeightNet
+		r.Tare = NewDecimal(int64(binary.LittleEndian.Uint16(body[8:10])), 3)
+	}
+	return r, nil
+}
+
+// Чтение веса Штрих-М по запросу
+func startReadWeightShtrih(d *Device) (string, error) {
+	body, err := d.shtrihExchange(shtrihCmdChannelStatus, nil)
+	if err != nil || body == nil {
+		return "", err
+	}
+	if body[1] != 0 {
+		return shtrihErrorText(body[1]), nil
+	}
+
+	r, err := decodeShtrihWeight(body)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	return d.setReading(r)
+}
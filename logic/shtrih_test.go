@@ -0,0 +1,191 @@
+package logic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShtrihFrame(t *testing.T) {
+	// STX, длина 5, команда 0x3A, пароль 30, LRC
+	want := []byte{0x02, 0x05, 0x3A, 0x1E, 0x00, 0x00, 0x00, 0x05 ^ 0x3A ^ 0x1E}
+	if got := shtrihFrame(shtrihCmdChannelStatus, nil); !bytes.Equal(got, want) {
+		t.Errorf("shtrihFrame = % X, нужно % X", got, want)
+	}
+}
+
+// Кадр ответа на 0x3A: команда, код ошибки, флаги, вес и тара в граммах
+func shtrihAnswer(code byte, flags uint16, grams int32, tare uint16) []byte {
+	body := []byte{shtrihCmdChannelStatus, code}
+	body = binary.LittleEndian.AppendUint16(body, flags)
+	body = binary.LittleEndian.AppendUint32(body, uint32(grams))
+	body = binary.LittleEndian.AppendUint16(body, tare)
+	frame := append([]byte{shtrihSTX, byte(len(body))}, body...)
+	return append(frame, shtrihLRC(frame[1:]))
+}
+
+func TestNextShtrihFrame(t *testing.T) {
+	good := shtrihAnswer(0, shtrihFlagEnabled, 1250, 0)
+	bad := append([]byte(nil), good...)
+	bad[len(bad)-1] ^= 0xFF
+	buf := append(append(append([]byte("xy\x02\x00"), bad...), good...), 0x02)
+
+	var stats FrameStats
+	bodies := [][]byte{}
+	for {
+		body, used, ok := nextShtrihFrame(buf, &stats)
+		buf = buf[used:]
+		if ok {
+			bodies = append(bodies, body)
+		} else if used == 0 {
+			break
+		}
+	}
+	if len(bodies) != 1 || !bytes.Equal(bodies[0], good[2:len(good)-1]) {
+		t.Errorf("кадры % X", bodies)
+	}
+	// Пропущены x, y и нулевая длина после STX; неполный кадр в конце ждет продолжения
+	if stats.Frames != 1 || stats.ChecksumErrors != 1 || stats.FramingErrors != 1 || stats.SkippedBytes != 3 || len(buf) != 1 {
+		t.Errorf("счетчики %+v, осталось %d байт", stats, len(buf))
+	}
+}
+
+func TestDecodeShtrihWeight(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   uint16
+		grams   int32
+		tare    uint16
+		weight  Decimal
+		mode    WeightMode
+		tareW   Decimal
+		stable  bool
+		over    bool
+		problem string
+	}{
+		{"стабильный", shtrihFlagEnabled | shtrihFlagStable | shtrihFlagFixed, 1250, 0, NewDecimal(1250, 3), WeightGross, Decimal{}, true, false, ""},
+		{"отрицательный", shtrihFlagEnabled, -310, 0, NewDecimal(-310, 3), WeightGross, Decimal{}, false, false, ""},
+		{"нетто", shtrihFlagEnabled | shtrihFlagTare | shtrihFlagStable, 900, 350, NewDecimal(900, 3), WeightNet, NewDecimal(350, 3), true, false, ""},
+		{"перегруз", shtrihFlagEnabled | shtrihFlagOverload, 0, 0, NewDecimal(0, 3), WeightGross, Decimal{}, false, true, ""},
+		{"канал выключен", 0, 1250, 0, Decimal{}, WeightGross, Decimal{}, false, false, "Весовой канал выключен"},
+		{"нет АЦП", shtrihFlagEnabled | shtrihFlagNoADC, 0, 0, Decimal{}, WeightGross, Decimal{}, false, false, "Нет ответа от АЦП"},
+		{"ошибка измерения", shtrihFlagEnabled | shtrihFlagMeasError, 0, 0, Decimal{}, WeightGross, Decimal{}, false, false, "Ошибка при получении измерения"},
+	}
+	for _, tt := range tests {
+		frame := shtrihAnswer(0, tt.flags, tt.grams, tt.tare)
+		r, err := decodeShtrihWeight(frame[2 : len(frame)-1])
+		if tt.problem != "" {
+			if err == nil || err.Error() != tt.problem {
+				t.Errorf("%s: ошибка %v, нужно %q", tt.name, err, tt.problem)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if r.Weight != tt.weight || r.Mode != tt.mode || r.Tare != tt.tareW || r.Stable != tt.stable || r.Overload != tt.over || r.Unit != "kg" {
+			t.Errorf("%s: разобрано %+v", tt.name, r)
+		}
+	}
+	if _, err := decodeShtrihWeight([]byte{shtrihCmdChannelStatus, 0, 0x04}); err == nil {
+		t.Error("короткий ответ разобран")
+	}
+}
+
+// Весы Штрих-М: на ENQ отвечают NAK, на команду - ACK и ответом, на NAK повторяют ответ
+type shtrihScales struct {
+	answer  []byte
+	corrupt int // сколько первых ответов отправить с неверной LRC
+	naks    int // принято NAK от кассы
+	pending []byte
+}
+
+func (s *shtrihScales) send() {
+	frame := append([]byte(nil), s.answer...)
+	if s.corrupt > 0 {
+		s.corrupt--
+		frame[len(frame)-1] ^= 0xFF
+	}
+	s.pending = append(s.pending, frame...)
+}
+
+func (s *shtrihScales) Write(b []byte) (int, error) {
+	switch b[0] {
+	case shtrihENQ:
+		s.pending = append(s.pending, shtrihNAK)
+	case shtrihSTX:
+		s.pending = append(s.pending, shtrihACK)
+		s.send()
+	case shtrihNAK:
+		s.naks++
+		s.send()
+	}
+	return len(b), nil
+}
+
+func (s *shtrihScales) Read(b []byte) (int, error) {
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *shtrihScales) SetReadTimeout(time.Duration) error    { return nil }
+func (s *shtrihScales) SetDTR(bool) error                     { return nil }
+func (s *shtrihScales) SetRTS(bool) error                     { return nil }
+func (s *shtrihScales) GetModemStatus() (*ModemStatus, error) { return &ModemStatus{}, nil }
+func (s *shtrihScales) Close() error                          { return nil }
+func (s *shtrihScales) Name() string                          { return "shtrih" }
+
+func shtrihDevice(t *testing.T, scales *shtrihScales) *Device {
+	t.Helper()
+	d := &Device{Type: ScalesShtrih}
+	if err := d.ConnectTransport(scales); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestShtrihReadWeight(t *testing.T) {
+	scales := &shtrihScales{answer: shtrihAnswer(0, shtrihFlagEnabled|shtrihFlagStable, 1250, 0)}
+	d := shtrihDevice(t, scales)
+	if _, err := d.Process(); err != nil {
+		t.Fatal(err)
+	}
+	if d.LastReading == nil || d.LastReading.Weight != NewDecimal(1250, 3) || !d.LastReading.Stable {
+		t.Errorf("показание %+v", d.LastReading)
+	}
+}
+
+// Ответ с неверной LRC весы повторяют после NAK
+func TestShtrihReadWeightLRC(t *testing.T) {
+	scales := &shtrihScales{answer: shtrihAnswer(0, shtrihFlagEnabled, 500, 0), corrupt: 1}
+	d := shtrihDevice(t, scales)
+	if _, err := d.Process(); err != nil {
+		t.Fatal(err)
+	}
+	if d.LastReading == nil || d.LastReading.Weight != NewDecimal(500, 3) {
+		t.Errorf("показание %+v", d.LastReading)
+	}
+	if scales.naks != 1 || d.Stats.ChecksumErrors != 1 || d.Stats.Frames != 1 {
+		t.Errorf("NAK %d, счетчики %+v", scales.naks, d.Stats)
+	}
+}
+
+func TestShtrihErrorCode(t *testing.T) {
+	for code, want := range map[byte]string{
+		0x14: "Неверный пароль (код 0x14)",
+		0x42: "Ошибка весов, код 0x42",
+	} {
+		d := shtrihDevice(t, &shtrihScales{answer: shtrihAnswer(code, 0, 0, 0)})
+		line, err := d.Process()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(line, want) || d.LastReading != nil {
+			t.Errorf("код %02X: %q, показание %+v", code, line, d.LastReading)
+		}
+	}
+}
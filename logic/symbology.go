@@ -0,0 +1,220 @@
+package logic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Определение типа штрихкода и проверка контрольных цифр.
+//
+// Если в сканере включена передача идентификатора символики AIM, каждый штрихкод
+// начинается с "]", буквы символики и модификатора: ]E0 - EAN-13, ]d2 - GS1 DataMatrix,
+// ]Q1 - QR. Без идентификатора тип угадывается по содержимому: 8, 12, 13 и 14 цифр -
+// EAN-8, UPC-A, EAN-13 и ITF-14, код маркировки с GS или с "01" и "21" - GS1 DataMatrix.
+
+// Разделитель полей GS1 (FNC1 внутри штрихкода), который сканер передает как GS
+const gs1GS = 0x1D
+
+// Идентификаторы AIM. Более длинные проверяются первыми
+var aimSymbologies = []struct {
+	id, name string
+}{
+	{"]E4", "EAN-8"},
+	{"]E", "EAN-13"}, // ]E0 передается и для UPC-A и UPC-E, уточняется по длине
+	{"]C1", "GS1-128"},
+	{"]C", "Code 128"},
+	{"]A", "Code 39"},
+	{"]I", "Interleaved 2 of 5"},
+	{"]d2", "GS1 DataMatrix"},
+	{"]d", "DataMatrix"},
+	{"]Q3", "GS1 QR"},
+	{"]Q", "QR"},
+	{"]e", "GS1 DataBar"},
+	{"]F", "Codabar"},
+	{"]G", "Code 93"},
+	{"]L", "PDF417"},
+	{"]z", "Aztec"},
+}
+
+// Разбирает одно сканирование без терминатора: отделяет идентификатор AIM,
+// определяет тип штрихкода и проверяет его
+func ParseBarcode(raw []byte) Barcode {
+	b := Barcode{Data: decodeScan(raw), Raw: append([]byte(nil), raw...)}
+
+	if len(b.Data) >= 3 && b.Data[0] == ']' {
+		b.AIM = b.Data[:3]
+		b.Data = b.Data[3:]
+		for _, s := range aimSymbologies {
+			if strings.HasPrefix(b.AIM, s.id) {
+				b.Symbology = s.name
+				break
+			}
+		}
+		switch {
+		case b.Symbology == "EAN-13" && len(b.Data) == 12:
+			b.Symbology = "UPC-A"
+		case b.Symbology == "EAN-13" && len(b.Data) == 8:
+			b.Symbology = "UPC-E"
+		case b.Symbology == "Interleaved 2 of 5" && len(b.Data) == 14:
+			b.Symbology = "ITF-14"
+		}
+	} else {
+		b.Symbology = guessSymbology(b.Data)
+	}
+
+	b.validate()
+	return b
+}
+
+// Тип штрихкода по содержимому, "" если угадать нельзя
+func guessSymbology(data string) string {
+	if strings.IndexByte(data, gs1GS) >= 0 {
+		return "GS1 DataMatrix"
+	}
+	// Код маркировки без GS: 01 + GTIN, затем 21 + серийный номер
+	if len(data) > 18 && strings.HasPrefix(data, "01") && isDigits(data[2:16]) && data[16:18] == "21" {
+		return "GS1 DataMatrix"
+	}
+	if !isDigits(data) {
+		return ""
+	}
+	switch len(data) {
+	case 8:
+		// UPC-E тоже из 8 цифр: если как EAN-8 контрольная цифра не сходится, а как UPC-E сходится
+		if gs1CheckDigit(data[:7]) != data[7] && (data[0] == '0' || data[0] == '1') &&
+			upcEToUPCA(data)[11] == data[7] {
+			return "UPC-E"
+		}
+		return "EAN-8"
+	case 12:
+		return "UPC-A"
+	case 13:
+		return "EAN-13"
+	case 14:
+		return "ITF-14"
+	}
+	return ""
+}
+
+// Проверяет штрихкод известного типа, заполняет Problems и Weighted
+func (b *Barcode) validate() {
+	b.Problems = nil
+	b.Weighted = nil
+	b.GS1 = nil
+
+	if b.Data == "" {
+		b.Problems = append(b.Problems, "пустой штрихкод")
+		return
+	}
+
+	// В линейных штрихкодах кириллицы не бывает, это сканер в режиме клавиатуры с русской раскладкой
+	if _, n := fromRussianLayout(b.Data); n > 0 && !strings.HasPrefix(b.Symbology, "GS1") && !is2D(b.Symbology) {
+		b.Problems = append(b.Problems, "символы русской раскладки: сканер работает как клавиатура, переключите раскладку на английскую")
+	}
+
+	switch b.Symbology {
+	case "EAN-13":
+		if b.checkGTIN(13) && b.Data[0] == '2' {
+			// Весовой штрихкод магазина: 2X, код товара, вес в граммах, контрольная цифра
+			weight, _ := strconv.ParseInt(b.Data[7:12], 10, 64)
+			b.Weighted = &WeightedBarcode{Prefix: b.Data[:2], Item: b.Data[2:7], Weight: NewDecimal(weight, 3)}
+		}
+	case "EAN-8":
+		b.checkGTIN(8)
+	case "UPC-A":
+		b.checkGTIN(12)
+	case "ITF-14":
+		b.checkGTIN(14)
+	case "UPC-E":
+		if len(b.Data) != 8 || !isDigits(b.Data) {
+			b.Problems = append(b.Problems, "UPC-E должен состоять из 8 цифр")
+			return
+		}
+		if b.Data[0] != '0' && b.Data[0] != '1' {
+			b.Problems = append(b.Problems, fmt.Sprintf("неверная система нумерации UPC-E %c, должна быть 0 или 1", b.Data[0]))
+			return
+		}
+		if want := upcEToUPCA(b.Data)[11]; want != b.Data[7] {
+			b.Problems = append(b.Problems, fmt.Sprintf("неверная контрольная цифра %c, должна быть %c", b.Data[7], want))
+		}
+	case "GS1 DataMatrix", "GS1-128", "GS1 QR", "GS1 DataBar":
+		b.GS1, b.Problems = ParseGS1(b.Data)
+	case "QR", "DataMatrix", "PDF417", "Aztec":
+		// В 2D кодах кириллица может быть в самом тексте, проверяется только код маркировки
+		if b.Symbology != "DataMatrix" {
+			break
+		}
+		// Код маркировки без признака GS1 касса не примет
+		if elements, problems := ParseGS1(b.Data); len(problems) == 0 && len(elements) > 1 && elements[0].AI == "01" {
+			b.GS1 = elements
+			b.Problems = append(b.Problems, "DataMatrix без FNC1: это не GS1 DataMatrix, код маркировки напечатан неверно")
+		}
+	}
+}
+
+// Проверяет длину и контрольную цифру EAN/UPC/ITF-14. false - есть ошибки
+func (b *Barcode) checkGTIN(length int) bool {
+	if len(b.Data) != length || !isDigits(b.Data) {
+		b.Problems = append(b.Problems, fmt.Sprintf("%s должен состоять из %d цифр, получено %d символов", b.Symbology, length, len(b.Data)))
+		return false
+	}
+	want := gs1CheckDigit(b.Data[:length-1])
+	if got := b.Data[length-1]; got != want {
+		b.Problems = append(b.Problems, fmt.Sprintf("неверная контрольная цифра %c, должна быть %c", got, want))
+		return false
+	}
+	return true
+}
+
+// Контрольная цифра GS1 (EAN, UPC, ITF-14, GTIN) для цифр без нее: веса 3 и 1 справа налево
+func gs1CheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Разворачивает UPC-E (8 цифр) в UPC-A (12 цифр) с пересчитанной контрольной цифрой
+func upcEToUPCA(upce string) string {
+	ns, d := upce[:1], upce[1:7]
+	var body string
+	switch d[5] {
+	case '0', '1', '2':
+		body = ns + d[0:2] + d[5:6] + "0000" + d[2:5]
+	case '3':
+		body = ns + d[0:3] + "00000" + d[3:5]
+	case '4':
+		body = ns + d[0:4] + "00000" + d[4:5]
+	default:
+		body = ns + d[0:5] + "0000" + d[5:6]
+	}
+	return body + string(gs1CheckDigit(body))
+}
+
+// Строка только из цифр
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Двумерный штрихкод, в котором может быть произвольный текст
+func is2D(symbology string) bool {
+	switch symbology {
+	case "QR", "DataMatrix", "PDF417", "Aztec":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package logic
+
+import "testing"
+
+func TestGS1CheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"400638133393", '1'},      // EAN-13
+		{"03600029145", '2'},       // UPC-A
+		{"4601234567", '8'},        // без GTIN
+		{"00614141123456789", '0'}, // SSCC
+		{"7", '9'},
+	}
+	for _, tt := range tests {
+		if got := gs1CheckDigit(tt.digits); got != tt.want {
+			t.Errorf("gs1CheckDigit(%s) = %c, нужно %c", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestUPCEToUPCA(t *testing.T) {
+	tests := []struct {
+		upce, want string
+	}{
+		{"01234505", "012000003455"}, // последняя цифра 0-2: производитель X X 0-2
+		{"04252614", "042100005264"},
+		{"01234531", "012300000451"}, // 3: производитель из трех цифр
+		{"01234543", "012340000053"}, // 4: из четырех
+		{"01234558", "012345000058"}, // 5-9: из пяти, товар - последняя цифра
+	}
+	for _, tt := range tests {
+		if got := upcEToUPCA(tt.upce); got != tt.want {
+			t.Errorf("upcEToUPCA(%s) = %s, нужно %s", tt.upce, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package logic
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Проверка сканера по тестовому листу: из файла загружается список штрихкодов,
+// напечатанных на листе, техник сканирует лист, и каждый штрихкод отмечается как
+// прочитанный, прочитанный с ошибкой или не прочитанный.
+
+// Штрихкод тестового листа
+type SheetEntry struct {
+	Line      int      // строка файла
+	Text      string   // код как он записан в файле
+	Data      string   // код как его должен передать сканер
+	Symbology string   // ожидаемый тип, "" - любой
+	Read      bool     // прочитан верно
+	Misreads  []string // что было прочитано вместо него
+}
+
+// Тестовый лист и результаты сканирования
+type TestSheet struct {
+	Path       string
+	Entries    []SheetEntry
+	Unexpected []string // сканирования, которых нет в листе
+}
+
+// Читает тестовый лист: по строке на штрихкод, код и, необязательно, тип через точку с запятой
+// или табуляцию. Если после разделителя не тип штрихкода, вся строка - код. Строки с #
+// пропускаются. Разделитель GS записывается как <GS>, код GS1 можно записать в читаемом
+// виде со скобками.
+//
+//	# код;тип
+//	4601234567893;EAN-13
+//	(01)04601234567893(21)ABCDEFGHIJKLM(91)EE06(92)...;GS1 DataMatrix
+//	TEST-128;Code 128
+func LoadTestSheet(path string) (*TestSheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheet := &TestSheet{Path: path}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// В самом коде тоже бывает точка с запятой, поэтому хвост считается типом,
+		// только если это известный тип штрихкода
+		symbology := ""
+		if i := strings.LastIndexAny(text, ";\t"); i >= 0 {
+			if _, ok := FindSymbology(strings.TrimSpace(text[i+1:])); ok {
+				text, symbology = text[:i], text[i+1:]
+			}
+		}
+		e, err := NewSheetEntry(text, symbology)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		e.Line = line
+		sheet.Entries = append(sheet.Entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(sheet.Entries) == 0 {
+		return nil, fmt.Errorf("%s: нет штрихкодов", path)
+	}
+	return sheet, nil
+}
+
+// Штрихкод листа из кода в записи файла и типа, "" - любой
+func NewSheetEntry(text, symbology string) (SheetEntry, error) {
+	e := SheetEntry{Text: strings.TrimSpace(text), Symbology: strings.TrimSpace(symbology)}
+	if e.Symbology != "" {
+		name, ok := FindSymbology(e.Symbology)
+		if !ok {
+			return e, fmt.Errorf("неизвестный тип штрихкода %q", e.Symbology)
+		}
+		e.Symbology = name
+	}
+
+	e.Data = strings.ReplaceAll(e.Text, "<GS>", string(rune(gs1GS)))
+	if strings.HasPrefix(e.Text, "(") {
+		elements, err := parseGS1Text(e.Text)
+		if err != nil {
+			return e, err
+		}
+		e.Data = GS1Data(elements)
+	}
+	if e.Data == "" {
+		return e, fmt.Errorf("пустой штрихкод")
+	}
+	return e, nil
+}
+
+// Название типа штрихкода без учета регистра, пробелов и дефисов: "ean13" - "EAN-13"
+func FindSymbology(name string) (string, bool) {
+	names := []string{"UPC-A", "UPC-E", "ITF-14"}
+	for _, s := range aimSymbologies {
+		names = append(names, s.name)
+	}
+	for _, n := range names {
+		if symbologyKey(n) == symbologyKey(name) {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+func symbologyKey(name string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// Штрихкод для вывода: "4601234567893 (EAN-13)"
+func (e SheetEntry) String() string {
+	if e.Symbology == "" {
+		return e.Text
+	}
+	return e.Text + " (" + e.Symbology + ")"
+}
+
+// Результат по штрихкоду
+func (e SheetEntry) Status() string {
+	switch {
+	case len(e.Misreads) > 0:
+		return "ОШИБКА ЧТЕНИЯ"
+	case e.Read:
+		return "ПРОЧИТАН"
+	}
+	return "НЕ ПРОЧИТАН"
+}
+
+// Отмечает сканирование в листе и возвращает строку для вывода
+func (s *TestSheet) Check(b Barcode) string {
+	// FNC1 в начале кода некоторые сканеры передают как GS
+	data := strings.TrimPrefix(b.Data, string(rune(gs1GS)))
+	scanned := VisibleBytes([]byte(b.Data))
+	if b.Symbology != "" {
+		scanned += " (" + b.Symbology + ")"
+	}
+
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		if e.Data != data {
+			continue
+		}
+		// Тип проверяется, только если его передал сканер: без AIM он угадан по содержимому
+		if b.AIM != "" && e.Symbology != "" && e.Symbology != b.Symbology {
+			e.Misreads = append(e.Misreads, scanned)
+			return fmt.Sprintf("Лист, строка %d: ОШИБКА ЧТЕНИЯ - тип %s вместо %s", e.Line, b.Symbology, e.Symbology)
+		}
+		if e.Read {
+			return fmt.Sprintf("Лист, строка %d: ПОВТОР", e.Line)
+		}
+		e.Read = true
+		return fmt.Sprintf("Лист, строка %d: ПРОЧИТАН (%d из %d)", e.Line, s.readCount(), len(s.Entries))
+	}
+
+	// Чужой код похож на штрихкод листа - скорее всего, это он, прочитанный с ошибкой
+	if e := s.closest(data); e != nil {
+		e.Misreads = append(e.Misreads, scanned)
+		return fmt.Sprintf("Лист, строка %d: ОШИБКА ЧТЕНИЯ - ожидался %s", e.Line, e)
+	}
+	s.Unexpected = append(s.Unexpected, scanned)
+	return "Лист: ПОСТОРОННИЙ штрихкод, его нет в листе"
+}
+
+// Самый похожий штрихкод листа, совпадающий хотя бы наполовину. Не прочитанные - в первую очередь
+func (s *TestSheet) closest(data string) *SheetEntry {
+	var best *SheetEntry
+	bestScore := 0
+	for _, read := range []bool{false, true} {
+		for i := range s.Entries {
+			e := &s.Entries[i]
+			if e.Read != read {
+				continue
+			}
+			if score := similarity(e.Data, data); score*2 >= len(e.Data) && score > bestScore {
+				best, bestScore = e, score
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+// Сколько символов совпадает: по позициям или по одинаковому началу и концу,
+// если при чтении символ потерялся или добавился
+func similarity(a, b string) int {
+	same := 0
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return max(same, prefix+suffix)
+}
+
+func (s *TestSheet) readCount() int {
+	n := 0
+	for _, e := range s.Entries {
+		if e.Read {
+			n++
+		}
+	}
+	return n
+}
+
+// Все штрихкоды листа прочитаны
+func (s *TestSheet) Done() bool {
+	return s.readCount() == len(s.Entries)
+}
+
+// Лист пройден: все штрихкоды прочитаны, ошибок чтения и посторонних штрихкодов нет
+func (s *TestSheet) Passed() bool {
+	if !s.Done() || len(s.Unexpected) > 0 {
+		return false
+	}
+	for _, e := range s.Entries {
+		if len(e.Misreads) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Итоговый отчет: результат по каждому штрихкоду и PASS/FAIL
+func (s *TestSheet) String() string {
+	lines := []string{"Тестовый лист " + s.Path + ":"}
+	misread, missing := 0, 0
+	for _, e := range s.Entries {
+		line := fmt.Sprintf("  строка %d: %s %s", e.Line, e.Status(), e)
+		if len(e.Misreads) > 0 {
+			misread++
+			line += "; прочитано как " + strings.Join(e.Misreads, ", ")
+			if e.Read {
+				line += "; верно тоже прочитан"
+			}
+		} else if !e.Read {
+			missing++
+		}
+		lines = append(lines, line)
+	}
+	for _, u := range s.Unexpected {
+		lines = append(lines, "  ПОСТОРОННИЙ "+u)
+	}
+
+	result := "PASS"
+	if !s.Passed() {
+		result = "FAIL"
+	}
+	lines = append(lines, fmt.Sprintf("%s: прочитано %d из %d, с ошибкой %d, не прочитано %d, посторонних %d",
+		result, s.readCount(), len(s.Entries), misread, missing, len(s.Unexpected)))
+	return strings.Join(lines, "\n")
+}
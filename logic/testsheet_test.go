@@ -0,0 +1,149 @@
+package logic
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTestSheet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sheet.txt")
+	text := "# код;тип\n" +
+		"4601234567893;EAN-13\n" +
+		"\n" +
+		"key=1;value=2\n" +
+		"WIFI:S:sak;P:123;;qr\n" +
+		"TEST-128\tCode 128\n" +
+		"(01)04601234567893(21)ABC;GS1 DataMatrix\n"
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sheet, err := LoadTestSheet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		line            int
+		text, symbology string
+	}{
+		{2, "4601234567893", "EAN-13"},
+		{4, "key=1;value=2", ""},
+		{5, "WIFI:S:sak;P:123;", "QR"},
+		{6, "TEST-128", "Code 128"},
+		{7, "(01)04601234567893(21)ABC", "GS1 DataMatrix"},
+	}
+	if len(sheet.Entries) != len(want) {
+		t.Fatalf("штрихкодов %d, нужно %d", len(sheet.Entries), len(want))
+	}
+	for i, w := range want {
+		e := sheet.Entries[i]
+		if e.Line != w.line || e.Text != w.text || e.Symbology != w.symbology {
+			t.Errorf("строка %d: %d %q %q, нужно %d %q %q", i, e.Line, e.Text, e.Symbology, w.line, w.text, w.symbology)
+		}
+	}
+	if data := sheet.Entries[4].Data; data != "0104601234567893"+"21ABC" {
+		t.Errorf("код GS1 %q", data)
+	}
+}
+
+func newTestSheet(t *testing.T, codes ...[2]string) *TestSheet {
+	t.Helper()
+	sheet := &TestSheet{Path: "лист"}
+	for i, c := range codes {
+		e, err := NewSheetEntry(c[0], c[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Line = i + 1
+		sheet.Entries = append(sheet.Entries, e)
+	}
+	return sheet
+}
+
+func TestTestSheetCheck(t *testing.T) {
+	sheet := newTestSheet(t,
+		[2]string{"4601234567893", "EAN-13"},
+		[2]string{"TEST-128", "Code 128"},
+		[2]string{"46012340", "EAN-8"})
+
+	scans := []struct {
+		raw, want string
+	}{
+		{"]E04601234567893", "Лист, строка 1: ПРОЧИТАН (1 из 3)"},
+		{"]E04601234567893", "Лист, строка 1: ПОВТОР"},
+		{"]A0TEST-128", "Лист, строка 2: ОШИБКА ЧТЕНИЯ - тип Code 39 вместо Code 128"},
+		{"TEST-I28", "Лист, строка 2: ОШИБКА ЧТЕНИЯ - ожидался TEST-128 (Code 128)"},
+		{"HELLO", "Лист: ПОСТОРОННИЙ штрихкод, его нет в листе"},
+	}
+	for _, s := range scans {
+		if got := sheet.Check(ParseBarcode([]byte(s.raw))); got != s.want {
+			t.Errorf("%q: %q, нужно %q", s.raw, got, s.want)
+		}
+	}
+
+	if sheet.Done() || sheet.Passed() {
+		t.Error("лист пройден, а не все штрихкоды прочитаны")
+	}
+	statuses := []string{"ПРОЧИТАН", "ОШИБКА ЧТЕНИЯ", "НЕ ПРОЧИТАН"}
+	for i, want := range statuses {
+		if got := sheet.Entries[i].Status(); got != want {
+			t.Errorf("строка %d: %s, нужно %s", i+1, got, want)
+		}
+	}
+	report := sheet.String()
+	for _, want := range []string{
+		"строка 2: ОШИБКА ЧТЕНИЯ TEST-128 (Code 128); прочитано как TEST-128 (Code 39), TEST-I28",
+		"ПОСТОРОННИЙ HELLO",
+		"FAIL: прочитано 1 из 3, с ошибкой 1, не прочитано 1, посторонних 1",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("в отчете нет %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestTestSheetPassed(t *testing.T) {
+	sheet := newTestSheet(t, [2]string{"4601234567893", "EAN-13"}, [2]string{"TEST-128", ""})
+	// Без AIM тип не проверяется
+	for _, raw := range []string{"4601234567893", "TEST-128"} {
+		sheet.Check(ParseBarcode([]byte(raw)))
+	}
+	if !sheet.Passed() {
+		t.Errorf("лист не пройден:\n%s", sheet)
+	}
+	if report := sheet.String(); !strings.Contains(report, "PASS: прочитано 2 из 2") {
+		t.Errorf("отчет:\n%s", report)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"ABCDEF", "ABCDEF", 6},
+		{"ABCDEF", "ABXDEF", 5},  // искажен символ
+		{"ABCDEF", "ABDEF", 5},   // потерян символ
+		{"ABCDEF", "ABCCDEF", 6}, // лишний символ
+		{"ABC", "XYZ", 0},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarity(%s, %s) = %d, нужно %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// Похожий код относится к еще не прочитанному штрихкоду, а не к уже прочитанному
+func TestTestSheetClosest(t *testing.T) {
+	sheet := newTestSheet(t, [2]string{"ABCDEF", ""}, [2]string{"ABCDEX", ""})
+	sheet.Entries[0].Read = true
+	if e := sheet.closest("ABCDEZ"); e == nil || e.Line != 2 {
+		t.Errorf("closest = %v, нужна строка 2", e)
+	}
+	if e := sheet.closest("XYZXYZ"); e != nil {
+		t.Errorf("closest = строка %d, нужно nil", e.Line)
+	}
+}
@@ -0,0 +1,81 @@
+package logic
+
+import (
+	"bytes"
+)
+
+// Общий разбор текстовых протоколов весов, где каждое показание - строка, заканчивающаяся CR LF
+// (A&D, Ohaus, Sartorius SBI). Протокол задает только разбор одной строки.
+
+// Разбирает одну строку без CR LF
+type textFrameDecoder func(line []byte) (Reading, error)
+
+// Ищет в буфере следующую строку с показанием. Пустые строки пропускаются,
+// строки, которые не удалось разобрать, учитываются в FramingErrors.
+func nextTextFrame(buf []byte, stats *FrameStats, maxLen int, decode textFrameDecoder) (Reading, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			if len(rest) > maxLen {
+				// Конца строки нет слишком долго - выбрасываем
+				stats.FramingErrors++
+				stats.SkippedBytes += len(rest)
+				return Reading{}, len(buf), false
+			}
+			return Reading{}, used, false
+		}
+		used += end + 1
+
+		line := bytes.TrimRight(rest[:end], "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			stats.SkippedBytes += end + 1
+			continue
+		}
+		if len(line) > maxLen {
+			stats.FramingErrors++
+			continue
+		}
+
+		r, err := decode(line)
+		if err != nil {
+			stats.FramingErrors++
+			continue
+		}
+		r.Raw = append([]byte(nil), rest[:end+1]...)
+		stats.Frames++
+		return r, used, true
+	}
+}
+
+// Разбирает накопленные байты. Возвращает строку показания, если оно найдено
+func (d *Device) takeTextFrame(maxLen int, decode textFrameDecoder) (string, bool) {
+	r, used, ok := nextTextFrame(d.rx, &d.Stats, maxLen, decode)
+	d.rx = d.rx[used:]
+	if !ok {
+		return "", false
+	}
+	str, _ := d.setReading(r)
+	return str, true
+}
+
+// Чтение веса по запросу: отправляет запрос и ждет строку ответа
+func (d *Device) readTextFrameRequest(request []byte, maxLen int, decode textFrameDecoder) (string, error) {
+	return d.requestFrame(request, func() (string, bool) { return d.takeTextFrame(maxLen, decode) })
+}
+
+// Чтение веса при непрерывной передаче
+func (d *Device) readTextFrameContinuous(maxLen int, decode textFrameDecoder) (string, error) {
+	return d.readFrames(func() (string, bool) { return d.takeTextFrame(maxLen, decode) })
+}
+
+// Отправляет команду весам, ошибка записи попадает в LastError
+func (d *Device) writeCommand(cmd string) error {
+	if _, err := d.transport.Write([]byte(cmd)); err != nil {
+		d.LastError = err.Error()
+		return err
+	}
+	return nil
+}
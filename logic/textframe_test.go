@@ -0,0 +1,116 @@
+package logic
+
+import (
+	"testing"
+)
+
+func TestDecodeTextFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode textFrameDecoder
+		line   string
+		want   Reading // Raw не сравнивается
+		bad    bool
+	}{
+		{"A&D", decodeANDFrame, "ST,+00123.45  g", Reading{Weight: NewDecimal(12345, 2), Unit: "g", Stable: true}, false},
+		{"A&D", decodeANDFrame, "US,-00001.20 kg", Reading{Weight: NewDecimal(-120, 2), Unit: "kg"}, false},
+		{"A&D", decodeANDFrame, "ST,NT,+0012.34kg", Reading{Weight: NewDecimal(1234, 2), Unit: "kg", Stable: true, Mode: WeightNet}, false},
+		{"A&D", decodeANDFrame, "QT,+0000123 pc", Reading{Weight: NewDecimal(123, 0), Unit: "PC", Stable: true}, false},
+		{"A&D", decodeANDFrame, "ST,+00000.00  g", Reading{Weight: NewDecimal(0, 2), Unit: "g", Stable: true, Zero: true}, false},
+		{"A&D", decodeANDFrame, "OL,+9999999 E", Reading{Overload: true}, false},
+		{"A&D", decodeANDFrame, "XX,+00123.45  g", Reading{}, true},
+		{"A&D", decodeANDFrame, "ST,XX,+0012.34kg", Reading{}, true},
+		{"A&D", decodeANDFrame, "ST,+00123.45", Reading{}, true},
+
+		{"Ohaus", decodeOhausFrame, "      1.234 kg   ", Reading{Weight: NewDecimal(1234, 3), Unit: "kg", Stable: true}, false},
+		{"Ohaus", decodeOhausFrame, "      1.234 kg ? N", Reading{Weight: NewDecimal(1234, 3), Unit: "kg", Mode: WeightNet}, false},
+		{"Ohaus", decodeOhausFrame, "     -0.500 lb T", Reading{Weight: NewDecimal(-500, 3), Unit: "lb", Stable: true, Mode: WeightTare}, false},
+		{"Ohaus", decodeOhausFrame, "   OL", Reading{Stable: true, Overload: true}, false},
+		{"Ohaus", decodeOhausFrame, "  Under", Reading{Stable: true, Underload: true}, false},
+		{"Ohaus", decodeOhausFrame, "      1.234 kg X", Reading{}, true},
+		{"Ohaus", decodeOhausFrame, "      1.234", Reading{}, true},
+
+		{"SBI", decodeSartoriusFrame, "+   12.345 g  ", Reading{Weight: NewDecimal(12345, 3), Unit: "g", Stable: true}, false},
+		{"SBI", decodeSartoriusFrame, "-    0.500    ", Reading{Weight: NewDecimal(-500, 3)}, false},
+		{"SBI", decodeSartoriusFrame, "N     +   12.345 g  ", Reading{Weight: NewDecimal(12345, 3), Unit: "g", Stable: true, Mode: WeightNet}, false},
+		{"SBI", decodeSartoriusFrame, "T     +    0.100 kg ", Reading{Weight: NewDecimal(100, 3), Unit: "kg", Stable: true, Mode: WeightTare}, false},
+		{"SBI", decodeSartoriusFrame, "         High ", Reading{Overload: true}, false},
+		{"SBI", decodeSartoriusFrame, "         Low  ", Reading{Underload: true}, false},
+		{"SBI", decodeSartoriusFrame, "X     +   12.345 g  ", Reading{}, true},
+	}
+	for _, tt := range tests {
+		r, err := tt.decode([]byte(tt.line))
+		if tt.bad {
+			if err == nil {
+				t.Errorf("%s %q: разобрано %+v", tt.name, tt.line, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.name, tt.line, err)
+			continue
+		}
+		r.Raw = nil
+		if r.Weight != tt.want.Weight || r.Unit != tt.want.Unit || r.Stable != tt.want.Stable || r.Mode != tt.want.Mode ||
+			r.Overload != tt.want.Overload || r.Underload != tt.want.Underload || r.Zero != tt.want.Zero {
+			t.Errorf("%s %q: разобрано %+v, нужно %+v", tt.name, tt.line, r, tt.want)
+		}
+	}
+}
+
+func TestNextTextFrame(t *testing.T) {
+	buf := []byte("\r\nST,+00001.00 kg\r\nXX,1\r\nUS,+00002.00 kg\r\nST,+000")
+	var stats FrameStats
+	weights := []Decimal{}
+	for {
+		r, used, ok := nextTextFrame(buf, &stats, andMaxFrame, decodeANDFrame)
+		buf = buf[used:]
+		if !ok {
+			break
+		}
+		if string(r.Raw[len(r.Raw)-2:]) != "\r\n" {
+			t.Errorf("Raw без CR LF: %q", r.Raw)
+		}
+		weights = append(weights, r.Weight)
+	}
+	if len(weights) != 2 || weights[0] != NewDecimal(100, 2) || weights[1] != NewDecimal(200, 2) {
+		t.Errorf("веса %v", weights)
+	}
+	// Пустая строка пропущена, неразобранная - ошибка структуры, неполная ждет продолжения
+	if stats.Frames != 2 || stats.FramingErrors != 1 || stats.SkippedBytes != 2 || string(buf) != "ST,+000" {
+		t.Errorf("счетчики %+v, осталось %q", stats, buf)
+	}
+
+	stats = FrameStats{}
+	long := []byte("ST,+00000000000000000000000000000001.00 kg\r\n")
+	if _, used, ok := nextTextFrame(long, &stats, andMaxFrame, decodeANDFrame); ok || used != len(long) || stats.FramingErrors != 1 {
+		t.Errorf("длинная строка: использовано %d, счетчики %+v", used, stats)
+	}
+}
+
+// Неполный ответ на запрос - ошибка структуры, а не показание
+func TestReadTextFrameRequest(t *testing.T) {
+	d := &Device{Type: ScalesAND}
+	transport := &echoTransport{}
+	if err := d.ConnectTransport(transport); err != nil {
+		t.Fatal(err)
+	}
+
+	// Эхо запроса Q разбирается как строка без заголовка A&D
+	transport.extra = []byte("ST,+00001.25 kg\r\n")
+	if _, err := d.Process(); err != nil {
+		t.Fatal(err)
+	}
+	if d.LastReading == nil || d.LastReading.Weight != NewDecimal(125, 2) {
+		t.Errorf("показание %+v", d.LastReading)
+	}
+
+	transport.extra = []byte("ST,+0000")
+	d.Stats = FrameStats{}
+	if _, err := d.Process(); err != nil {
+		t.Fatal(err)
+	}
+	if d.LastReading != nil || d.Stats.FramingErrors != 2 || len(d.rx) != 0 {
+		t.Errorf("показание %+v, счетчики %+v, в буфере %d байт", d.LastReading, d.Stats, len(d.rx))
+	}
+}
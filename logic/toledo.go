@@ -0,0 +1,446 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Протоколы Toledo.
+//
+// 8142 - непрерывная передача, 17 байт и необязательная контрольная сумма:
+//
+//	STX, слова состояния A, B, C, 6 цифр веса, 6 цифр тары, CR, [КС]
+//
+// КС - дополнение до двух суммы всех байт от STX до CR, младшие 7 бит.
+//
+// Слово A: биты 0-2 - положение запятой (0: X00, 1: X0, 2: X, 3: 0.X ... 7: 0.00000X),
+// биты 3-4 - дискретность (1, 2, 5), бит 5 всегда 1.
+// Слово B: бит 0 - нетто, бит 1 - минус, бит 2 - вне диапазона, бит 3 - движение,
+// бит 4 - кг (иначе фунты), бит 5 всегда 1.
+// Слово C: биты 0-2 - другая единица измерения (0 - по слову B), бит 3 - запрос печати,
+// бит 4 - расширенный режим (x10), бит 5 всегда 1.
+//
+// 8217 - вес по запросу "W", используется весами-сканерами POS:
+//
+//	STX, вес с точкой, CR        вес стабилен
+//	STX, '?', байт статуса, CR   вес передать нельзя
+//
+// Статус 8217: бит 0 - движение, бит 1 - центр нуля, бит 2 - ошибка ОЗУ, бит 3 - ошибка EEPROM,
+// бит 4 - недогрузка, бит 5 - перегрузка, бит 6 - ошибка ПЗУ, бит 7 - ошибка калибровки.
+// Единица измерения в 8217 не передается.
+
+const (
+	toledoSTX = 0x02
+	toledoCR  = 0x0D
+
+	toledo8142FrameLen = 17 // без контрольной суммы
+	toledo8217MaxLen   = 16
+	toledoMaxValue     = 999999 // наибольшее число из 6 цифр 8142
+	toledoRequest      = 'W'
+
+	toledoContinuousInterval = 200 * time.Millisecond // период передачи эмулятора 8142
+)
+
+// Биты слов состояния 8142
+const (
+	toledoAlwaysOne = 1 << 5
+
+	toledoBNet        = 1 << 0
+	toledoBNegative   = 1 << 1
+	toledoBOutOfRange = 1 << 2
+	toledoBMotion     = 1 << 3
+	toledoBKg         = 1 << 4
+
+	toledoCPrint    = 1 << 3
+	toledoCExpanded = 1 << 4
+)
+
+// Биты статуса 8217
+const (
+	toledo8217Motion      = 1 << 0
+	toledo8217Zero        = 1 << 1
+	toledo8217RAMError    = 1 << 2
+	toledo8217EEPROMError = 1 << 3
+	toledo8217Under       = 1 << 4
+	toledo8217Over        = 1 << 5
+	toledo8217ROMError    = 1 << 6
+	toledo8217CalError    = 1 << 7
+)
+
+// Единицы измерения по битам 0-2 слова C
+var toledoUnits = map[byte]string{
+	1: "g",
+	2: "t",
+	3: "oz",
+	4: "ozt",
+	5: "dwt",
+	6: "ton",
+	7: "",
+}
+
+// Контрольная сумма 8142
+func toledoChecksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum & 0x7F
+}
+
+// Ищет в буфере следующий кадр 8142
+func nextToledo8142Frame(buf []byte, stats *FrameStats) (Reading, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		start := bytes.IndexByte(rest, toledoSTX)
+		if start < 0 {
+			stats.SkippedBytes += len(rest)
+			return Reading{}, len(buf), false
+		}
+		stats.SkippedBytes += start
+		used += start
+		rest = buf[used:]
+
+		// Кадр и байт после него: контрольная сумма или начало следующего кадра
+		if len(rest) < toledo8142FrameLen+1 {
+			return Reading{}, used, false
+		}
+		frame := rest[:toledo8142FrameLen]
+		if frame[toledo8142FrameLen-1] != toledoCR {
+			stats.FramingErrors++
+			used++
+			continue
+		}
+
+		r, err := decodeToledo8142Frame(frame)
+		if err != nil {
+			stats.FramingErrors++
+			used++
+			continue
+		}
+
+		size := toledo8142FrameLen
+		next := rest[toledo8142FrameLen]
+		switch {
+		case next == toledoSTX && next == toledoChecksum(frame):
+			// Контрольная сумма 0x02 совпадает с STX: если за кадром сразу начинается
+			// следующий кадр, это вариант без контрольной суммы
+			if len(rest) < 2*toledo8142FrameLen {
+				return Reading{}, used, false
+			}
+			if !isToledo8142Frame(rest[toledo8142FrameLen:]) {
+				size++
+			}
+		case next == toledoChecksum(frame):
+			size++
+		case next != toledoSTX:
+			stats.ChecksumErrors++
+			used += size + 1
+			continue
+		}
+
+		r.Raw = append([]byte(nil), rest[:size]...)
+		stats.Frames++
+		return r, used + size, true
+	}
+}
+
+// Начинается ли буфер с целого кадра 8142
+func isToledo8142Frame(buf []byte) bool {
+	if len(buf) < toledo8142FrameLen || buf[0] != toledoSTX || buf[toledo8142FrameLen-1] != toledoCR {
+		return false
+	}
+	_, err := decodeToledo8142Frame(buf[:toledo8142FrameLen])
+	return err == nil
+}
+
+// Число из 6 цифр 8142 с положением запятой из слова A
+func toledoDigits(digits []byte, point byte) (Decimal, error) {
+	text := strings.ReplaceAll(string(digits), " ", "0")
+	value, err := ParseDecimal(text)
+	if err != nil || value.Scale != 0 || strings.ContainsAny(text, "+-") {
+		return Decimal{}, fmt.Errorf("неверное число Toledo %q", digits)
+	}
+	switch point {
+	case 0:
+		return NewDecimal(value.Value*100, 0), nil
+	case 1:
+		return NewDecimal(value.Value*10, 0), nil
+	}
+	return NewDecimal(value.Value, int(point)-2), nil
+}
+
+// Разбирает кадр 8142 без контрольной суммы
+func decodeToledo8142Frame(frame []byte) (Reading, error) {
+	r := Reading{}
+	a, b, c := frame[1]&0x7F, frame[2]&0x7F, frame[3]&0x7F
+	if a&b&c&toledoAlwaysOne == 0 {
+		return r, fmt.Errorf("неверные слова состояния Toledo")
+	}
+
+	point := a & 0x07
+	weight, err := toledoDigits(frame[4:10], point)
+	if err != nil {
+		return r, err
+	}
+	tare, err := toledoDigits(frame[10:16], point)
+	if err != nil {
+		return r, err
+	}
+
+	if b&toledoBNegative != 0 {
+		weight.Value = -weight.Value
+	}
+	r.Weight = weight
+	r.Stable = b&toledoBMotion == 0
+	r.Zero = weight.IsZero()
+	if b&toledoBNet != 0 {
+		r.Mode = WeightNet
+		r.Tare = tare
+	}
+	if b&toledoBOutOfRange != 0 {
+		if b&toledoBNegative != 0 {
+			r.Underload = true
+		} else {
+			r.Overload = true
+		}
+	}
+
+	r.Unit = "lb"
+	if b&toledoBKg != 0 {
+		r.Unit = "kg"
+	}
+	if unit, ok := toledoUnits[c&0x07]; ok {
+		r.Unit = unit
+	}
+	return r, nil
+}
+
+// Собирает кадр 8142 с контрольной суммой: вес в кг с двумя знаками после запятой
+func toledo8142Frame(weight, tare Decimal, stable, overload bool) []byte {
+	a := byte(toledoAlwaysOne | 1<<3 | 4) // дискретность 1, 0.0X
+	b := byte(toledoAlwaysOne | toledoBKg)
+	c := byte(toledoAlwaysOne)
+	if weight.Value < 0 {
+		b |= toledoBNegative
+	}
+	if !stable {
+		b |= toledoBMotion
+	}
+	if !tare.IsZero() {
+		b |= toledoBNet
+	}
+	// Вес или тара, которые не помещаются в 6 цифр, передаются как выход за диапазон с нулями
+	w, t := abs(weight.Value), abs(tare.Value)
+	if w > toledoMaxValue || t > toledoMaxValue {
+		overload = true
+		w, t = 0, 0
+	}
+	if overload {
+		b |= toledoBOutOfRange
+	}
+
+	frame := []byte{toledoSTX, a, b, c}
+	frame = fmt.Appendf(frame, "%06d%06d\r", w, t)
+	return append(frame, toledoChecksum(frame))
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Разбирает накопленные байты 8142
+func (d *Device) takeToledo8142Frame() (string, bool) {
+	r, used, ok := nextToledo8142Frame(d.rx, &d.Stats)
+	d.rx = d.rx[used:]
+	if !ok {
+		return "", false
+	}
+	str, _ := d.setReading(r)
+	return str, true
+}
+
+// Чтение веса Toledo 8142 непрерывная передача данных
+func startReadWeightToledo8142(d *Device) (string, error) {
+	return d.readFrames(d.takeToledo8142Frame)
+}
+
+// Ищет в буфере следующий ответ 8217: STX ... CR.
+// Возвращает показание или, если показания нет, текст состояния весов.
+func nextToledo8217Frame(buf []byte, stats *FrameStats) (*Reading, string, int, bool) {
+	used := 0
+	for {
+		rest := buf[used:]
+
+		start := bytes.IndexByte(rest, toledoSTX)
+		if start < 0 {
+			stats.SkippedBytes += len(rest)
+			return nil, "", len(buf), false
+		}
+		stats.SkippedBytes += start
+		used += start
+		rest = buf[used:]
+
+		end := bytes.IndexByte(rest, toledoCR)
+		if end < 0 {
+			if len(rest) > toledo8217MaxLen {
+				stats.FramingErrors++
+				used++
+				continue
+			}
+			return nil, "", used, false
+		}
+
+		r, text, err := decodeToledo8217(rest[1:end])
+		if err != nil {
+			stats.FramingErrors++
+			used++
+			continue
+		}
+		if r != nil {
+			r.Raw = append([]byte(nil), rest[:end+1]...)
+		}
+		stats.Frames++
+		return r, text, used + end + 1, true
+	}
+}
+
+// Текст ошибок из статуса 8217, пусто если ошибок нет
+func toledo8217StatusErrors(status byte) string {
+	errors := []string{}
+	for _, e := range []struct {
+		bit  byte
+		text string
+	}{
+		{toledo8217RAMError, "ошибка ОЗУ"},
+		{toledo8217EEPROMError, "ошибка EEPROM"},
+		{toledo8217ROMError, "ошибка ПЗУ"},
+		{toledo8217CalError, "ошибка калибровки"},
+	} {
+		if status&e.bit != 0 {
+			errors = append(errors, e.text)
+		}
+	}
+	if len(errors) == 0 {
+		return ""
+	}
+	return "Весы сообщают: " + strings.Join(errors, ", ")
+}
+
+// Разбирает ответ 8217 без STX и CR. Если показания нет, возвращает текст состояния
+func decodeToledo8217(body []byte) (*Reading, string, error) {
+	if len(body) == 0 || len(body) > toledo8217MaxLen {
+		return nil, "", fmt.Errorf("неверная длина ответа Toledo: %d", len(body))
+	}
+	if body[0] != '?' {
+		weight, err := ParseDecimal(string(body))
+		if err != nil {
+			return nil, "", fmt.Errorf("неверный вес Toledo %q", body)
+		}
+		return &Reading{Weight: weight, Stable: true, Zero: weight.IsZero()}, "", nil
+	}
+
+	if len(body) != 2 {
+		return nil, "", fmt.Errorf("неверный статус Toledo %q", body)
+	}
+	status := body[1]
+	if text := toledo8217StatusErrors(status); text != "" {
+		return nil, text, nil
+	}
+	switch {
+	case status&toledo8217Over != 0:
+		return &Reading{Overload: true}, "", nil
+	case status&toledo8217Under != 0:
+		return &Reading{Underload: true}, "", nil
+	case status&toledo8217Zero != 0:
+		return &Reading{Zero: true, Stable: status&toledo8217Motion == 0}, "", nil
+	case status&toledo8217Motion != 0:
+		return nil, "Вес не успокоился", nil
+	}
+	return nil, fmt.Sprintf("Вес не передан, статус 0x%02X", status), nil
+}
+
+// Чтение веса Toledo 8217 по запросу W
+func startReadWeightToledo8217(d *Device) (string, error) {
+	return d.requestFrame([]byte{toledoRequest}, func() (string, bool) {
+		r, text, used, ok := nextToledo8217Frame(d.rx, &d.Stats)
+		d.rx = d.rx[used:]
+		if ok && r != nil {
+			text, _ = d.setReading(*r)
+		}
+		return text, ok
+	})
+}
+
+// Эмуляция весов Toledo 8142: непрерывная передача кадров с контрольной суммой
+func startEmulateToledo8142(d *Device) (string, error) {
+	s := d.emu.next()
+	frame := toledo8142Frame(d.emu.net(s.Weight), d.emu.tare, s.Stable, s.Overload)
+
+	faults, err := d.emulatorWrite(frame, len(frame)-1)
+	if err != nil {
+		return "", err
+	}
+
+	time.Sleep(toledoContinuousInterval)
+
+	return fmt.Sprintf("% X", frame) + faults, nil
+}
+
+// Ответ эмулятора 8217 на запрос W
+func (e *emulator) toledo8217Answer() []byte {
+	s := e.next()
+	weight := e.net(s.Weight)
+	switch {
+	case s.Overload:
+		return []byte{toledoSTX, '?', toledo8217Over, toledoCR}
+	case !s.Stable:
+		return []byte{toledoSTX, '?', toledo8217Motion, toledoCR}
+	case weight.Value < 0:
+		return []byte{toledoSTX, '?', toledo8217Under, toledoCR}
+	case weight.IsZero():
+		return []byte{toledoSTX, '?', toledo8217Zero, toledoCR}
+	}
+
+	// Вес в кг с тремя знаками: "01.250"
+	text := NewDecimal(weight.Value*10, 3).String()
+	for len(text) < 6 {
+		text = "0" + text
+	}
+	return append(append([]byte{toledoSTX}, text...), toledoCR)
+}
+
+// Эмуляция весов Toledo 8217: ответ на каждый запрос W
+func startEmulateToledo8217(d *Device) (string, error) {
+	// Запрос мог прийти в прошлый раз вместе с предыдущим
+	i := bytes.IndexByte(d.rx, toledoRequest)
+	if i < 0 {
+		// Все кроме W игнорируется
+		d.rx = nil
+		n, err := d.readMore()
+		if err != nil || n == 0 {
+			return "", err
+		}
+		if i = bytes.IndexByte(d.rx, toledoRequest); i < 0 {
+			d.rx = nil
+			return "", nil
+		}
+	}
+	d.rx = d.rx[i+1:]
+
+	answer := d.emu.toledo8217Answer()
+	faults, err := d.emulatorWrite(answer, -1)
+	if err != nil {
+		return "", err
+	}
+	if answer[1] == '?' {
+		return fmt.Sprintf("W -> ? 0x%02X", answer[2]) + faults, nil
+	}
+	return "W -> " + string(answer[1:len(answer)-1]) + faults, nil
+}
@@ -0,0 +1,131 @@
+package logic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestToledoChecksum(t *testing.T) {
+	tests := []struct {
+		data string
+		want byte
+	}{
+		{"", 0x00},
+		{"\x02", 0x7E},
+		{"\x02\x2c\x30\x20000125000000\r", 0x2D},
+		{"\x02\x2c\x31\x20000125000050\r", 0x27},
+	}
+	for _, tt := range tests {
+		if got := toledoChecksum([]byte(tt.data)); got != tt.want {
+			t.Errorf("toledoChecksum(%q) = %02X, нужно %02X", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestToledo8142Frame(t *testing.T) {
+	want := []byte("\x02\x2c\x31\x20000125000050\r\x27")
+	if got := toledo8142Frame(NewDecimal(125, 2), NewDecimal(50, 2), true, false); !bytes.Equal(got, want) {
+		t.Errorf("toledo8142Frame = %q, нужно %q", got, want)
+	}
+}
+
+// Кадр эмулятора читается разбором кадров 8142
+func TestDecodeToledo8142Frame(t *testing.T) {
+	tests := []struct {
+		weight, tare     Decimal
+		stable, overload bool
+	}{
+		{NewDecimal(125, 2), Decimal{}, true, false},
+		{NewDecimal(-310, 2), Decimal{}, false, false},
+		{NewDecimal(125, 2), NewDecimal(50, 2), true, false},
+		{NewDecimal(15000, 2), Decimal{}, true, true},
+	}
+	for _, tt := range tests {
+		frame := toledo8142Frame(tt.weight, tt.tare, tt.stable, tt.overload)
+		r, err := decodeToledo8142Frame(frame[:toledo8142FrameLen])
+		if err != nil {
+			t.Errorf("%q: %v", frame, err)
+			continue
+		}
+		if r.Weight.Value != tt.weight.Value || r.Weight.Scale != 2 || r.Unit != "kg" ||
+			r.Stable != tt.stable || r.Overload != tt.overload || r.Tare.Value != tt.tare.Value {
+			t.Errorf("%q: разобрано %+v", frame, r)
+		}
+	}
+}
+
+func TestNextToledo8142Frame(t *testing.T) {
+	good := toledo8142Frame(NewDecimal(125, 2), Decimal{}, true, false)
+	bad := append([]byte(nil), good...)
+	bad[len(bad)-1] ^= 0x01
+	// Кадр без контрольной суммы, за которым сразу следующий кадр, тоже верный
+	bare := good[:toledo8142FrameLen]
+	buf := append(append(append([]byte("x"), bad...), bare...), good...)
+
+	var stats FrameStats
+	frames := 0
+	for {
+		_, used, ok := nextToledo8142Frame(buf, &stats)
+		buf = buf[used:]
+		if !ok {
+			break
+		}
+		frames++
+	}
+	if frames != 2 || stats.Frames != 2 || stats.ChecksumErrors != 1 {
+		t.Errorf("кадров %d, в счетчике %d, ошибок КС %d, нужно 2, 2, 1", frames, stats.Frames, stats.ChecksumErrors)
+	}
+}
+
+// Контрольная сумма 0x02 совпадает с STX следующего кадра
+func TestNextToledo8142FrameChecksumSTX(t *testing.T) {
+	weight := NewDecimal(699999, 2)
+	frame := toledo8142Frame(weight, Decimal{}, true, false)
+	if frame[toledo8142FrameLen] != toledoSTX {
+		t.Fatalf("контрольная сумма %02X, нужно 02", frame[toledo8142FrameLen])
+	}
+	next := toledo8142Frame(NewDecimal(125, 2), Decimal{}, true, false)
+
+	for _, tt := range []struct {
+		name  string
+		first []byte
+	}{
+		{"без контрольной суммы", frame[:toledo8142FrameLen]},
+		{"с контрольной суммой", frame},
+	} {
+		buf := append(append([]byte(nil), tt.first...), next...)
+		var stats FrameStats
+		weights := []Decimal{}
+		for {
+			r, used, ok := nextToledo8142Frame(buf, &stats)
+			buf = buf[used:]
+			if !ok {
+				break
+			}
+			weights = append(weights, r.Weight)
+		}
+		if len(weights) != 2 || weights[0].Value != 699999 || weights[1].Value != 125 || stats.SkippedBytes != 0 {
+			t.Errorf("%s: веса %v, пропущено байт %d", tt.name, weights, stats.SkippedBytes)
+		}
+	}
+}
+
+// Вес и тара больше 6 цифр не обрезаются, а передаются как выход за диапазон
+func TestToledo8142FrameOutOfRange(t *testing.T) {
+	for _, tt := range []struct {
+		weight, tare Decimal
+	}{
+		{NewDecimal(1000000, 2), Decimal{}},
+		{NewDecimal(125, 2), NewDecimal(1000000, 2)},
+	} {
+		frame := toledo8142Frame(tt.weight, tt.tare, true, false)
+		r, err := decodeToledo8142Frame(frame[:toledo8142FrameLen])
+		if err != nil {
+			t.Errorf("%q: %v", frame, err)
+			continue
+		}
+		if !r.Overload || !r.Weight.IsZero() {
+			t.Errorf("%s, тара %s: перегруз %v, вес %s", tt.weight, tt.tare, r.Overload, r.Weight)
+		}
+	}
+}
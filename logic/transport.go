@@ -0,0 +1,280 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Ошибка для операций, которые транспорт не поддерживает (например линии модема у TCP)
+var ErrNotSupported = errors.New("операция не поддерживается данным транспортом")
+
+// Состояние входных линий модема
+type ModemStatus struct {
+	CTS bool // Clear To Send
+	DSR bool // Data Set Ready
+	RI  bool // Ring Indicator
+	DCD bool // Data Carrier Detect
+}
+
+// Канал обмена данными с устройством. Физический COM порт - лишь одна из реализаций.
+//
+// Read обязан возвращать 0, nil если за время таймаута ничего не пришло.
+// На этом поведении построены все обработчики протоколов.
+type Transport interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	SetReadTimeout(t time.Duration) error
+	SetDTR(dtr bool) error
+	SetRTS(rts bool) error
+	GetModemStatus() (*ModemStatus, error)
+	Close() error
+	Name() string // Человекочитаемое описание подключения
+}
+
+// Открывает транспорт по строке порта.
+//
+// Поддерживаемые форматы:
+//
+//	COM3, /dev/ttyUSB0                  - COM порт
+//	serial:///dev/ttyUSB0?baud=9600     - COM порт с параметрами
+//	tcp://10.0.0.5:4001                 - TCP (конвертеры Ethernet-RS232, ser2net)
+//	pty://                              - пара псевдотерминалов (только Linux)
+//	file://capture.bin?loop=1           - воспроизведение записанного обмена
+//
+// Вместе с транспортом возвращаются параметры COM порта с учетом параметров из строки порта.
+func OpenTransport(port string, settings SerialSettings) (Transport, SerialSettings, error) {
+	if port == "" {
+		return nil, settings, fmt.Errorf("не указан порт")
+	}
+	settings, err := PortSettings(port, settings)
+	if err != nil {
+		return nil, settings, err
+	}
+
+	// Просто имя порта без схемы - это COM порт
+	if !strings.Contains(port, "://") {
+		t, err := openSerialTransport(port, settings)
+		return t, settings, err
+	}
+
+	u, err := url.Parse(port)
+	if err != nil {
+		return nil, settings, fmt.Errorf("неверная строка порта %q: %w", port, err)
+	}
+
+	var t Transport
+	switch u.Scheme {
+	case "serial":
+		t, err = openSerialTransport(urlPath(u), settings)
+	case "tcp":
+		t, err = openTCPTransport(u.Host)
+	case "pty":
+		t, err = openPtyTransport()
+	case "file":
+		loop := u.Query().Get("loop")
+		t, err = openFileTransport(urlPath(u), loop == "1" || loop == "true")
+	default:
+		err = fmt.Errorf("неизвестный тип порта %q", u.Scheme)
+	}
+	return t, settings, err
+}
+
+// Параметры COM порта с учетом параметров из строки serial://...?baud=9600.
+// Для остальных строк порта параметры не меняются
+func PortSettings(port string, settings SerialSettings) (SerialSettings, error) {
+	if !strings.HasPrefix(port, "serial://") {
+		return settings, nil
+	}
+	u, err := url.Parse(port)
+	if err != nil {
+		return settings, fmt.Errorf("неверная строка порта %q: %w", port, err)
+	}
+	err = applySerialQuery(&settings, u.Query())
+	return settings, err
+}
+
+// Собирает путь из URL. serial://COM3 и serial:///COM3 дают одно и то же
+func urlPath(u *url.URL) string {
+	path := u.Host + u.Path
+	// В Windows имя порта не начинается со слэша: serial:///COM3
+	if len(path) > 1 && path[0] == '/' && strings.HasPrefix(strings.ToUpper(path[1:]), "COM") {
+		path = path[1:]
+	}
+	return path
+}
+
+// Применяет параметры из строки порта: baud, databits, parity, stopbits, flow, dtr, rts, timeout
+func applySerialQuery(settings *SerialSettings, q url.Values) error {
+	for name := range q {
+		if err := settings.Set(name, q.Get(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Признак того, что строка порта описывает COM порт и к ней применимы SerialSettings
+func IsSerialPort(port string) bool {
+	return !strings.Contains(port, "://") || strings.HasPrefix(port, "serial://")
+}
+
+// COM порт через go.bug.st/serial
+type serialTransport struct {
+	name    string
+	port    serial.Port
+	flow    FlowControl
+	timeout time.Duration
+}
+
+func openSerialTransport(name string, settings SerialSettings) (Transport, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	port, err := serial.Open(name, settings.mode())
+	if err != nil {
+		return nil, err
+	}
+	return &serialTransport{name: name, port: port, flow: settings.FlowControl}, nil
+}
+
+func (t *serialTransport) Read(p []byte) (int, error) { return t.port.Read(p) }
+func (t *serialTransport) SetDTR(dtr bool) error      { return t.port.SetDTR(dtr) }
+func (t *serialTransport) SetRTS(rts bool) error      { return t.port.SetRTS(rts) }
+func (t *serialTransport) Close() error               { return t.port.Close() }
+func (t *serialTransport) Name() string               { return t.name }
+
+// Драйвер не умеет аппаратное управление потоком,
+// поэтому при RTS/CTS перед записью ждем CTS от устройства сами
+func (t *serialTransport) Write(p []byte) (int, error) {
+	if t.flow == FlowRTSCTS {
+		deadline := time.Now().Add(t.timeout)
+		for {
+			bits, err := t.port.GetModemStatusBits()
+			if err != nil {
+				return 0, err
+			}
+			if bits.CTS {
+				break
+			}
+			if time.Now().After(deadline) {
+				return 0, fmt.Errorf("устройство не выставило CTS")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return t.port.Write(p)
+}
+
+func (t *serialTransport) SetReadTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return t.port.SetReadTimeout(timeout)
+}
+
+func (t *serialTransport) GetModemStatus() (*ModemStatus, error) {
+	bits, err := t.port.GetModemStatusBits()
+	if err != nil {
+		return nil, err
+	}
+	return &ModemStatus{CTS: bits.CTS, DSR: bits.DSR, RI: bits.RI, DCD: bits.DCD}, nil
+}
+
+// TCP подключение. Конвертеры Ethernet-RS232, ser2net и т.п.
+type tcpTransport struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func openTCPTransport(addr string) (Transport, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("не указан адрес TCP")
+	}
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &tcpTransport{conn: conn}, nil
+}
+
+func (t *tcpTransport) Read(p []byte) (int, error) {
+	if t.timeout > 0 {
+		t.conn.SetReadDeadline(time.Now().Add(t.timeout))
+	} else {
+		t.conn.SetReadDeadline(time.Time{})
+	}
+	n, err := t.conn.Read(p)
+	// Таймаут для обработчиков - это не ошибка, а отсутствие данных
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return n, nil
+	}
+	return n, err
+}
+
+func (t *tcpTransport) Write(p []byte) (int, error) { return t.conn.Write(p) }
+func (t *tcpTransport) SetDTR(bool) error           { return ErrNotSupported }
+func (t *tcpTransport) SetRTS(bool) error           { return ErrNotSupported }
+func (t *tcpTransport) Close() error                { return t.conn.Close() }
+func (t *tcpTransport) Name() string                { return "tcp://" + t.conn.RemoteAddr().String() }
+
+func (t *tcpTransport) SetReadTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return nil
+}
+
+func (t *tcpTransport) GetModemStatus() (*ModemStatus, error) {
+	return nil, ErrNotSupported
+}
+
+// Воспроизведение записанного обмена из файла.
+// Все что пишется в порт - отбрасывается, читается содержимое файла.
+type fileTransport struct {
+	name    string
+	data    []byte
+	pos     int
+	loop    bool
+	timeout time.Duration
+}
+
+func openFileTransport(name string, loop bool) (Transport, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileTransport{name: name, data: data, loop: loop}, nil
+}
+
+func (t *fileTransport) Read(p []byte) (int, error) {
+	if t.pos >= len(t.data) && t.loop {
+		t.pos = 0
+	}
+	// Данные закончились - ведем себя как порт, в который ничего не пришло
+	if t.pos >= len(t.data) {
+		time.Sleep(t.timeout)
+		return 0, nil
+	}
+	n := copy(p, t.data[t.pos:])
+	t.pos += n
+	return n, nil
+}
+
+func (t *fileTransport) Write(p []byte) (int, error) { return len(p), nil }
+func (t *fileTransport) SetDTR(bool) error           { return nil }
+func (t *fileTransport) SetRTS(bool) error           { return nil }
+func (t *fileTransport) Close() error                { return nil }
+func (t *fileTransport) Name() string                { return "file://" + t.name }
+
+func (t *fileTransport) SetReadTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return nil
+}
+
+func (t *fileTransport) GetModemStatus() (*ModemStatus, error) {
+	return &ModemStatus{CTS: true, DSR: true, DCD: true}, nil
+}
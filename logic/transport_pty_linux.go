@@ -0,0 +1,111 @@
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Пара псевдотерминалов. Программа работает с master стороной,
+// а тестируемое ПО подключается к slave (/dev/pts/N) как к обычному COM порту.
+type ptyTransport struct {
+	master  int
+	slave   int // держим slave открытым, иначе чтение master вернет EIO пока никто не подключился
+	name    string
+	timeout time.Duration
+}
+
+func openPtyTransport() (Transport, error) {
+	master, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Разблокируем slave и узнаем его номер
+	if err := unix.IoctlSetPointerInt(master, unix.TIOCSPTLCK, 0); err != nil {
+		unix.Close(master)
+		return nil, err
+	}
+	n, err := unix.IoctlGetInt(master, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(master)
+		return nil, err
+	}
+	name := fmt.Sprintf("/dev/pts/%d", n)
+
+	slave, err := unix.Open(name, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		unix.Close(master)
+		return nil, err
+	}
+
+	// Двоичный режим без эха и преобразования символов
+	tio, err := unix.IoctlGetTermios(slave, unix.TCGETS)
+	if err == nil {
+		tio.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		tio.Oflag &^= unix.OPOST
+		tio.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		tio.Cflag &^= unix.CSIZE | unix.PARENB
+		tio.Cflag |= unix.CS8
+		err = unix.IoctlSetTermios(slave, unix.TCSETS, tio)
+	}
+	if err != nil {
+		unix.Close(slave)
+		unix.Close(master)
+		return nil, err
+	}
+
+	return &ptyTransport{master: master, slave: slave, name: name}, nil
+}
+
+func (t *ptyTransport) Read(p []byte) (int, error) {
+	timeout := -1
+	if t.timeout >= 0 {
+		timeout = int(t.timeout / time.Millisecond)
+	}
+
+	fds := []unix.PollFd{{Fd: int32(t.master), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, timeout)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, nil // таймаут
+		}
+		break
+	}
+
+	n, err := unix.Read(t.master, p)
+	if n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+func (t *ptyTransport) Write(p []byte) (int, error) {
+	return unix.Write(t.master, p)
+}
+
+func (t *ptyTransport) SetReadTimeout(timeout time.Duration) error {
+	t.timeout = timeout
+	return nil
+}
+
+func (t *ptyTransport) SetDTR(bool) error { return ErrNotSupported }
+func (t *ptyTransport) SetRTS(bool) error { return ErrNotSupported }
+
+func (t *ptyTransport) GetModemStatus() (*ModemStatus, error) {
+	return nil, ErrNotSupported
+}
+
+func (t *ptyTransport) Close() error {
+	unix.Close(t.slave)
+	return unix.Close(t.master)
+}
+
+func (t *ptyTransport) Name() string { return "pty: " + t.name }
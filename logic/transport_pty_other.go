@@ -0,0 +1,9 @@
+//go:build !linux
+
+package logic
+
+import "fmt"
+
+func openPtyTransport() (Transport, error) {
+	return nil, fmt.Errorf("псевдотерминалы поддерживаются только в Linux. Используйте com0com")
+}